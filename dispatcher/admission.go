@@ -0,0 +1,323 @@
+package dispatcher
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryAfter    = time.Duration(1000) * time.Millisecond
+	defaultCoDelTarget   = time.Duration(5) * time.Millisecond
+	defaultCoDelInterval = time.Duration(100) * time.Millisecond
+	defaultAIMDMinLimit  = 1
+	defaultAIMDMaxLimit  = 1000
+	defaultAIMDBackoff   = 0.9
+	defaultAIMDLatency   = time.Duration(1000) * time.Millisecond
+)
+
+// AdmissionError task refused by admission controller.
+type AdmissionError struct {
+	TaskUID    string
+	Lane       string
+	State      State
+	RetryAfter time.Duration // hint of when to add task again
+}
+
+func (e *AdmissionError) Error() string {
+	return fmt.Sprintf("dispatcher too busy, task = %s has been refused by lane = %s, retry after %s",
+		e.TaskUID, e.Lane, e.RetryAfter)
+}
+
+// AdmissionStats load of dispatcher and lane when a task is added.
+type AdmissionStats struct {
+	Lane         string
+	LaneTodoNum  int           // tasks wait in lane
+	LaneMaxNum   int           // max tasks of lane
+	LaneHeadWait time.Duration // how long the first task of lane has waited
+	TodoNum      int           // tasks wait in all lanes
+	RunningNum   int           // tasks dispatched to workers
+	MaxWorkerNum int
+	RetryingNum  int // tasks wait backoff to retry
+}
+
+// AdmissionController decide state of lane when a task is added, StateOfDeny refuse the task.
+type AdmissionController interface {
+	// Admit get state of lane and a retry after hint if deny, it is called with dispatcher lock,
+	// now is the time of dispatcher clock.
+	Admit(now time.Time, s AdmissionStats) (State, time.Duration)
+	// Observe a finished task at now, wait is the time in queue, run is the time operated by worker.
+	Observe(now time.Time, wait time.Duration, run time.Duration, err error)
+}
+
+// StaticAdmission state by queue length of lane, half at 50%, busy at 70%, deny at 95%.
+type StaticAdmission struct {
+	RetryAfter time.Duration // default 1s
+}
+
+// Admit implement AdmissionController.
+func (a StaticAdmission) Admit(now time.Time, s AdmissionStats) (State, time.Duration) {
+	state := StateOfNormal
+	if s.LaneTodoNum >= s.LaneMaxNum/2 {
+		state = StateOfHalf
+	}
+
+	if s.LaneTodoNum >= s.LaneMaxNum*7/10 {
+		state = StateOfBusy
+	}
+
+	if s.LaneTodoNum >= s.LaneMaxNum*95/100 {
+		state = StateOfDeny
+	}
+
+	retryAfter := a.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+
+	return state, retryAfter
+}
+
+// Observe implement AdmissionController.
+func (a StaticAdmission) Observe(now time.Time, wait time.Duration, run time.Duration, err error) {}
+
+// CoDelAdmission refuse tasks when queue delay stay above target for an interval, like CoDel,
+// queue length limit of lane still works.
+type CoDelAdmission struct {
+	target   time.Duration
+	interval time.Duration
+
+	mutex      sync.Mutex
+	aboveSince int64 // per - Nanosecond, 0 means delay below target
+	static     StaticAdmission
+}
+
+// NewCoDelAdmission create a CoDel admission controller, default target 5ms and interval 100ms.
+func NewCoDelAdmission(target time.Duration, interval time.Duration) *CoDelAdmission {
+	if target <= 0 {
+		target = defaultCoDelTarget
+	}
+
+	if interval <= 0 {
+		interval = defaultCoDelInterval
+	}
+
+	return &CoDelAdmission{target: target, interval: interval, static: StaticAdmission{RetryAfter: interval}}
+}
+
+// sojourn record a queue delay, must hold lock.
+func (a *CoDelAdmission) sojourn(wait time.Duration, now int64) {
+	if wait < a.target {
+		a.aboveSince = 0
+		return
+	}
+
+	if a.aboveSince == 0 {
+		a.aboveSince = now
+	}
+}
+
+// Admit implement AdmissionController.
+func (a *CoDelAdmission) Admit(now time.Time, s AdmissionStats) (State, time.Duration) {
+	state, retryAfter := a.static.Admit(now, s)
+	if state == StateOfDeny {
+		return state, retryAfter
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	nanos := now.UnixNano()
+
+	// an empty lane has no delay
+	if s.LaneTodoNum == 0 {
+		a.aboveSince = 0
+	} else {
+		a.sojourn(s.LaneHeadWait, nanos)
+	}
+
+	if a.aboveSince == 0 {
+		return state, retryAfter
+	}
+
+	if nanos-a.aboveSince >= int64(a.interval) {
+		return StateOfDeny, a.interval
+	}
+
+	return StateOfBusy, retryAfter
+}
+
+// Observe implement AdmissionController.
+func (a *CoDelAdmission) Observe(now time.Time, wait time.Duration, run time.Duration, err error) {
+	a.mutex.Lock()
+	a.sojourn(wait, now.UnixNano())
+	a.mutex.Unlock()
+}
+
+// AIMDConfig config of AIMD admission controller.
+type AIMDConfig struct {
+	MinLimit     int           // default 1
+	MaxLimit     int           // default 1000
+	InitialLimit int           // default MinLimit
+	Latency      time.Duration // task run longer than it is treated as overload, default 1s
+	Backoff      float64       // limit multiplied by it when overload, default 0.9
+}
+
+// AIMDAdmission limit tasks in dispatcher (waiting and running), the limit increases by one
+// every limit tasks succeed, and decreases multiplicatively when task error or slow.
+type AIMDAdmission struct {
+	c AIMDConfig
+
+	mutex  sync.Mutex
+	limit  float64
+	avgRun float64 // per - Second, moving average of run time
+	hasRun bool
+}
+
+// NewAIMDAdmission create an AIMD admission controller.
+func NewAIMDAdmission(c AIMDConfig) *AIMDAdmission {
+	if c.MinLimit <= 0 {
+		c.MinLimit = defaultAIMDMinLimit
+	}
+
+	if c.MaxLimit < c.MinLimit {
+		c.MaxLimit = defaultAIMDMaxLimit
+		if c.MaxLimit < c.MinLimit {
+			c.MaxLimit = c.MinLimit
+		}
+	}
+
+	if c.InitialLimit < c.MinLimit || c.InitialLimit > c.MaxLimit {
+		c.InitialLimit = c.MinLimit
+	}
+
+	if c.Latency <= 0 {
+		c.Latency = defaultAIMDLatency
+	}
+
+	if c.Backoff <= 0 || c.Backoff >= 1 {
+		c.Backoff = defaultAIMDBackoff
+	}
+
+	return &AIMDAdmission{c: c, limit: float64(c.InitialLimit)}
+}
+
+// GetLimit get current limit.
+func (a *AIMDAdmission) GetLimit() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return int(a.limit)
+}
+
+// Admit implement AdmissionController.
+func (a *AIMDAdmission) Admit(now time.Time, s AdmissionStats) (State, time.Duration) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	inFlight := float64(s.TodoNum + s.RunningNum + s.RetryingNum)
+	limit := math.Floor(a.limit)
+
+	state := StateOfNormal
+	if inFlight >= limit/2 {
+		state = StateOfHalf
+	}
+
+	if inFlight >= limit*7/10 {
+		state = StateOfBusy
+	}
+
+	if inFlight >= limit {
+		state = StateOfDeny
+	}
+
+	retryAfter := a.c.Latency
+	if a.hasRun {
+		retryAfter = time.Duration(a.avgRun * float64(time.Second))
+	}
+
+	return state, retryAfter
+}
+
+// Observe implement AdmissionController.
+func (a *AIMDAdmission) Observe(now time.Time, wait time.Duration, run time.Duration, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.hasRun {
+		a.avgRun = a.avgRun*0.9 + run.Seconds()*0.1
+	} else {
+		a.avgRun = run.Seconds()
+		a.hasRun = true
+	}
+
+	if err != nil || run > a.c.Latency {
+		a.limit = math.Max(float64(a.c.MinLimit), a.limit*a.c.Backoff)
+		return
+	}
+
+	a.limit = math.Min(float64(a.c.MaxLimit), a.limit+1/a.limit)
+}
+
+// stateChange a transition of dispatcher state.
+type stateChange struct {
+	old State
+	new State
+}
+
+// checkLane update lane state by admission controller, must hold dispatcher lock.
+func (d *Dispatcher) checkLane(l *lane) (State, time.Duration) {
+	now := d.now()
+
+	headWait := l.headWait(now)
+	if headWait < 0 {
+		headWait = 0
+	}
+
+	todo := 0
+	for _, ln := range d.lanes {
+		todo += ln.queue.Len()
+	}
+
+	state, retryAfter := d.admission.Admit(time.Unix(0, now), AdmissionStats{
+		Lane:         l.name,
+		LaneTodoNum:  l.queue.Len(),
+		LaneMaxNum:   l.maxTaskNum,
+		LaneHeadWait: time.Duration(headWait),
+		TodoNum:      todo,
+		RunningNum:   d.GetCurrentRunningNum(),
+		MaxWorkerNum: d.GetMaxWorkerNum(),
+		RetryingNum:  d.GetCurrentRetryingNum(),
+	})
+
+	l.state = state
+
+	return state, retryAfter
+}
+
+// notifyState deliver state transitions to callback in order.
+func (d *Dispatcher) notifyState() {
+	for {
+		isQuit := false
+
+		select {
+		case <-d.stateWakeCh:
+		case <-d.quitCh:
+			isQuit = true
+		}
+
+		d.mutex.Lock()
+		list := d.stateChanges
+		d.stateChanges = nil
+		d.mutex.Unlock()
+
+		for _, sc := range list {
+			d.hooks.OnStateChange(sc.old, sc.new)
+		}
+
+		if isQuit {
+			return
+		}
+	}
+}
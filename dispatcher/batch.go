@@ -0,0 +1,187 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultBatchSize = 16
+)
+
+// ErrorOfBatchResultMissing batch handler return less results than tasks.
+var ErrorOfBatchResultMissing = errors.New("batch handler not return result of task")
+
+// batchDoing operate a batch of tasks, return result of every task in the same order.
+type batchDoing func(ctx context.Context, res Resource, tasks []Task) []OutData
+
+// collectBatch get more tasks after the first one, until batch is full, or queue is empty
+// and linger time passed.
+func (d *Dispatcher) collectBatch(first Task) []Task {
+	batch := []Task{first}
+
+	var lingerCh <-chan time.Time
+	if d.batchLinger > 0 {
+		timer := d.clock.NewTimer(d.batchLinger)
+		defer timer.Stop()
+		lingerCh = timer.C()
+	}
+
+	for len(batch) < d.batchSize {
+		t, wait, ok := d.nextTask()
+		if ok {
+			batch = append(batch, t)
+			continue
+		}
+
+		if lingerCh == nil {
+			return batch
+		}
+
+		if !d.lingerBatch(lingerCh, wait) {
+			return batch
+		}
+	}
+
+	return batch
+}
+
+// lingerBatch wait more tasks for batch, return false if linger time passed or dispatcher quit.
+func (d *Dispatcher) lingerBatch(lingerCh <-chan time.Time, wait time.Duration) bool {
+	var limitCh <-chan time.Time
+	if wait > 0 {
+		timer := d.clock.NewTimer(wait)
+		defer timer.Stop()
+		limitCh = timer.C()
+	}
+
+	select {
+	case <-d.wakeCh:
+	case <-limitCh:
+	case <-lingerCh:
+		return false
+	case <-d.quitCh:
+		return false
+	}
+
+	return true
+}
+
+// doBatch operate a batch of tasks, timeout is the min timeout of tasks and apply to the whole batch,
+// return true if batch handler panic.
+func (w *Worker) doBatch(tasks []Task) bool {
+	var err error
+	var isPanic bool
+
+	runStart := w.dispatcher.now()
+
+	timeout := time.Duration(0)
+	for _, t := range tasks {
+		if t.TimeOut > 0 && (timeout == 0 || t.TimeOut < timeout) {
+			timeout = t.TimeOut
+		}
+	}
+
+	if timeout <= 0 {
+		timeout = defaultTaskTimeout
+	}
+
+	newCtx, cancel := w.dispatcher.clock.WithTimeout(context.Background(), timeout*time.Millisecond)
+	defer cancel()
+
+	running := make([]Task, 0, len(tasks))
+	ctxs := make([]context.Context, 0, len(tasks))
+	defer func() {
+		for _, t := range tasks {
+			w.dispatcher.removeRunning(t.runID)
+		}
+	}()
+
+	for _, t := range tasks {
+		t.Attempt++
+		t.RunTime = runStart
+
+		if t.OriginalCtx == nil {
+			t.OriginalCtx = context.Background()
+		}
+
+		// cancel one task should not cancel the whole batch, it is checked after batch done
+		w.dispatcher.startRunning(t, cancel)
+		if !t.state.setRunning(func() {}) {
+			t.Reply(OutData{Err: ErrorOfTaskCancelled})
+			w.dispatcher.taskCancelled(t)
+			continue
+		}
+
+		running = append(running, t)
+		ctxs = append(ctxs, w.dispatcher.hooks.OnStart(newCtx, t))
+	}
+
+	var outs []OutData
+	var res Resource
+
+	if len(running) == 0 {
+		goto BatchEnd
+	}
+
+	res, err = w.getResource(newCtx)
+	if err != nil {
+		goto BatchEnd
+	}
+
+	isPanic, outs, err = w.safeBatch(newCtx, res, running)
+	w.putResource(res, isPanic)
+
+BatchEnd:
+	end := w.dispatcher.now()
+
+	for i, t := range running {
+		out := OutData{Err: err}
+		if err == nil {
+			out.Err = ErrorOfBatchResultMissing
+			if i < len(outs) {
+				out = outs[i]
+			}
+		}
+
+		if out.Err == nil && t.state.cancelled() {
+			out.Err = ErrorOfTaskCancelled
+		}
+
+		if out.Err != nil {
+			w.dispatcher.taskFailed(t, out.Err, true)
+		} else {
+			t.Reply(out)
+			w.dispatcher.countDone(t)
+		}
+
+		t.EndTime = end
+		w.dispatcher.observe(t, runStart, out.Err)
+		w.dispatcher.hooks.OnFinish(ctxs[i], t, out.Err, time.Duration(end-runStart))
+	}
+
+	return isPanic
+}
+
+// safeBatch call batchDo and recover panic of it.
+func (w *Worker) safeBatch(ctx context.Context, res Resource, tasks []Task) (isPanic bool, outs []OutData, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = w.recovered(v, fmt.Sprintf("batch of %s", tasks[0].InData.TaskUID))
+			isPanic = true
+		}
+	}()
+
+	return false, w.dispatcher.batchDo(ctx, res, tasks), nil
+}
+
+// GetBatchDispatch get a dispatcher which operate tasks in batch, see Config.BatchSize.
+func GetBatchDispatch(c Config, batchDo batchDoing, r Resource) *Dispatcher {
+	dispatcher := newDispatcher(c)
+	dispatcher.batchDo = batchDo
+	dispatcher.run(nil, r)
+
+	return dispatcher
+}
@@ -0,0 +1,58 @@
+package dispatcher
+
+import (
+	"context"
+	"time"
+)
+
+// Clock source of time of dispatcher, set Config.Clock to a virtual clock in tests,
+// see package dispatchertest.
+type Clock interface {
+	Now() time.Time
+	// NewTimer like time.NewTimer.
+	NewTimer(d time.Duration) Timer
+	// AfterFunc like time.AfterFunc.
+	AfterFunc(d time.Duration, f func()) Timer
+	// WithTimeout like context.WithTimeout, the context is done with context.DeadlineExceeded
+	// when the clock pass the timeout.
+	WithTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc)
+}
+
+// Timer created by Clock, C is nil for timer created by AfterFunc.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// realClock clock of package time.
+type realClock struct{}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time        { return t.t.C }
+func (t realTimer) Stop() bool                 { return t.t.Stop() }
+func (t realTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{t: time.NewTimer(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{t: time.AfterFunc(d, f)}
+}
+
+func (realClock) WithTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, d)
+}
+
+// now get time of dispatcher clock, per - Nanosecond.
+func (d *Dispatcher) now() int64 {
+	return d.clock.Now().UTC().UnixNano()
+}
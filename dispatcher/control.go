@@ -0,0 +1,115 @@
+package dispatcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	maxControlBodySize = 1 << 20
+)
+
+// ControlCommand command to change dispatcher at runtime, zero value fields keep the current
+// config, like {"maxWorkerNum":32,"maxTaskNum":10000,"pause":false}.
+type ControlCommand struct {
+	MaxWorkerNum int          `json:"maxWorkerNum"`
+	MinWorkerNum int          `json:"minWorkerNum"`
+	MaxTaskNum   int          `json:"maxTaskNum"`
+	Lanes        []LaneConfig `json:"lanes"`
+	Pause        *bool        `json:"pause"` // true to pause dispatch, false to resume
+	// PauseWorkers id of workers to pause, ResumeWorkers id of workers to resume.
+	PauseWorkers  []int `json:"pauseWorkers"`
+	ResumeWorkers []int `json:"resumeWorkers"`
+}
+
+// Control apply a json ControlCommand.
+func (d *Dispatcher) Control(data []byte) error {
+	var cmd ControlCommand
+
+	err := json.Unmarshal(bytes.TrimSpace(data), &cmd)
+	if err != nil {
+		return fmt.Errorf("dispatcher = %s control command = %s error : %s", d.name, data, err)
+	}
+
+	err = d.Reconfigure(Config{
+		MaxWorkerNum: cmd.MaxWorkerNum,
+		MinWorkerNum: cmd.MinWorkerNum,
+		MaxTaskNum:   cmd.MaxTaskNum,
+		Lanes:        cmd.Lanes,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range cmd.PauseWorkers {
+		if !d.PauseWorker(id) {
+			return fmt.Errorf("dispatcher = %s pause worker = %d error : %w", d.name, id, ErrorOfWorkerNotExist)
+		}
+	}
+
+	for _, id := range cmd.ResumeWorkers {
+		if !d.ResumeWorker(id) {
+			return fmt.Errorf("dispatcher = %s resume worker = %d error : %w", d.name, id, ErrorOfWorkerNotExist)
+		}
+	}
+
+	if cmd.Pause != nil {
+		if *cmd.Pause {
+			d.Pause()
+		} else {
+			d.Resume()
+		}
+	}
+
+	return nil
+}
+
+// ServeControl apply commands from ch until it closed or dispatcher shutdown, such as data chan
+// of zlog pipe server, see package control.
+func (d *Dispatcher) ServeControl(ch <-chan []byte) {
+	for {
+		select {
+		case data, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			err := d.Control(data)
+			if err != nil {
+				d.logf("dispatcher = %s control error = %s", d.name, err)
+			}
+		case <-d.quitCh:
+			return
+		}
+	}
+}
+
+// AdminHandler get a http handler, GET write status, POST apply ControlCommand in body.
+func (d *Dispatcher) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			d.WriteStatus(w)
+		case http.MethodPost:
+			data, err := io.ReadAll(io.LimitReader(r.Body, maxControlBodySize))
+			if err == nil {
+				err = d.Control(data)
+			}
+
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			d.WriteStatus(w)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,25 @@
+// Package control apply dispatcher control commands from a named pipe file like zlog config pipe,
+// it is not part of package dispatcher so dispatcher does not depend on zlog.
+package control
+
+import (
+	"time"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+	"github.com/ezgroot/ezUtils/zlog/server"
+)
+
+// StartPipe create a named pipe file, commands written to it line by line are applied to d,
+// e.g. echo '{"maxWorkerNum":32}' > file. Close the returned pipe server to remove the file.
+func StartPipe(d *dispatcher.Dispatcher, file string, period time.Duration) (*server.PipeServer, error) {
+	ps := server.NewPipeServer(file, period)
+
+	err := ps.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	go d.ServeControl(ps.GetDataCh())
+
+	return ps, nil
+}
@@ -0,0 +1,235 @@
+package dispatcher
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cron field bound.
+type cronBound struct {
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	cronMinute = cronBound{min: 0, max: 59}
+	cronHour   = cronBound{min: 0, max: 23}
+	cronDom    = cronBound{min: 1, max: 31}
+	cronMonth  = cronBound{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	cronDow = cronBound{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// CronSchedule a parsed cron expression.
+type CronSchedule struct {
+	minute   uint64
+	hour     uint64
+	dom      uint64
+	month    uint64
+	dow      uint64
+	isDomAll bool
+	isDowAll bool
+	every    time.Duration
+}
+
+// ParseCron parse a standard five fields cron expression "minute hour day-of-month month day-of-week",
+// every field support "*", "a-b", "*/n", "a-b/n" and lists split by ",", month and day-of-week
+// support names like "jan" and "mon", descriptors like "@daily" and "@every 5m" are also supported.
+func ParseCron(spec string) (*CronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if strings.HasPrefix(spec, "@every ") {
+		every, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("cron spec = %s parse duration error : %s", spec, err)
+		}
+
+		if every < time.Second {
+			return nil, fmt.Errorf("cron spec = %s duration less than 1s", spec)
+		}
+
+		return &CronSchedule{every: every}, nil
+	}
+
+	if d, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron spec = %s should have 5 fields", spec)
+	}
+
+	var err error
+	s := &CronSchedule{
+		isDomAll: fields[2] == "*" || fields[2] == "?",
+		isDowAll: fields[4] == "*" || fields[4] == "?",
+	}
+
+	if s.minute, err = parseCronField(fields[0], cronMinute); err != nil {
+		return nil, err
+	}
+
+	if s.hour, err = parseCronField(fields[1], cronHour); err != nil {
+		return nil, err
+	}
+
+	if s.dom, err = parseCronField(fields[2], cronDom); err != nil {
+		return nil, err
+	}
+
+	if s.month, err = parseCronField(fields[3], cronMonth); err != nil {
+		return nil, err
+	}
+
+	if s.dow, err = parseCronField(fields[4], cronDow); err != nil {
+		return nil, err
+	}
+
+	// 7 is also sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+
+	return s, nil
+}
+
+func parseCronValue(value string, b cronBound) (int, error) {
+	if n, ok := b.names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("cron value = %s is invalid", value)
+	}
+
+	if n < b.min || n > b.max {
+		return 0, fmt.Errorf("cron value = %d out of range [%d, %d]", n, b.min, b.max)
+	}
+
+	return n, nil
+}
+
+func parseCronField(field string, b cronBound) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		var err error
+		begin, end, step := b.min, b.max, 1
+
+		rangePart := part
+		if i := strings.Index(part, "/"); i >= 0 {
+			rangePart = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("cron step of %s is invalid", part)
+			}
+		}
+
+		if rangePart != "*" && rangePart != "?" {
+			if i := strings.Index(rangePart, "-"); i >= 0 {
+				if begin, err = parseCronValue(rangePart[:i], b); err != nil {
+					return 0, err
+				}
+
+				if end, err = parseCronValue(rangePart[i+1:], b); err != nil {
+					return 0, err
+				}
+			} else {
+				if begin, err = parseCronValue(rangePart, b); err != nil {
+					return 0, err
+				}
+
+				end = begin
+				if step > 1 {
+					end = b.max
+				}
+			}
+		}
+
+		if begin > end {
+			return 0, fmt.Errorf("cron range of %s is invalid", part)
+		}
+
+		for i := begin; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
+
+func (s *CronSchedule) dayMatch(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.isDomAll || s.isDowAll {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
+
+// Next get the first time match schedule after t, zero time means never.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+
+	loc := t.Location()
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	yearLimit := t.Year() + 5
+
+WRAP:
+	for t.Year() <= yearLimit {
+		for s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			if t.Month() == time.January {
+				continue WRAP
+			}
+		}
+
+		for !s.dayMatch(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			if t.Day() == 1 {
+				continue WRAP
+			}
+		}
+
+		for s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			if t.Hour() == 0 {
+				continue WRAP
+			}
+		}
+
+		for s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			if t.Minute() == 0 {
+				continue WRAP
+			}
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,49 @@
+package dispatcher_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+)
+
+func TestCronNext(t *testing.T) {
+	base := time.Date(2021, time.December, 31, 23, 58, 30, 0, time.UTC)
+
+	cases := []struct {
+		spec   string
+		expect time.Time
+	}{
+		{"* * * * *", time.Date(2021, time.December, 31, 23, 59, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 9 * * mon-fri", time.Date(2022, time.January, 3, 9, 30, 0, 0, time.UTC)},
+		{"0 12 1,15 feb *", time.Date(2022, time.February, 1, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2022, time.January, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2022, time.January, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * */7", time.Date(2022, time.January, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1-7", time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0-5/7", time.Date(2022, time.January, 2, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		s, err := dispatcher.ParseCron(c.spec)
+		if err != nil {
+			t.Fatalf("parse cron = %s error = %s", c.spec, err)
+		}
+
+		next := s.Next(base)
+		if !next.Equal(c.expect) {
+			t.Fatalf("cron = %s next = %s, expect %s", c.spec, next, c.expect)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "* * * * 8", "@every 1ms"} {
+		_, err := dispatcher.ParseCron(spec)
+		if err == nil {
+			t.Fatalf("parse cron = %s should fail", spec)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package dispatcher
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// DedupMode how to operate tasks with the same uid.
+type DedupMode int
+
+// dedup mode enum
+const (
+	DedupOff      DedupMode = iota // not check task uid
+	DedupReject                    // refuse duplicate task by DuplicateTaskError
+	DedupCoalesce                  // attach duplicate task to the existing one, share its result
+)
+
+// DuplicateTaskError task uid is queued, running or finished recently.
+type DuplicateTaskError struct {
+	TaskUID string
+	Status  TaskStatus // status of the existing task
+}
+
+func (e *DuplicateTaskError) Error() string {
+	return fmt.Sprintf("duplicate task = %s has been refused, existing task is %s", e.TaskUID, e.Status)
+}
+
+// recentTask a finished task remembered in dedup window.
+type recentTask struct {
+	state      *taskState
+	finishTime int64 // per - Nanosecond
+}
+
+// subscribe attach an out chan to task, it will receive the result of task.
+func (s *taskState) subscribe(ch chan OutData) {
+	s.mutex.Lock()
+
+	if !s.hasOut {
+		s.subscribers = append(s.subscribers, ch)
+		s.mutex.Unlock()
+		return
+	}
+
+	out := s.out
+	s.mutex.Unlock()
+
+	// caller may read out chan after submit return
+	go func() {
+		ch <- out
+	}()
+}
+
+// takeSubscribers get and clear subscribers.
+func (s *taskState) takeSubscribers() []chan OutData {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	list := s.subscribers
+	s.subscribers = nil
+
+	return list
+}
+
+// notifySubscribers send out to subscribers which not received result yet, a subscriber not
+// ready to receive is skipped like tryReply, so it never block worker or dispatcher.
+func (s *taskState) notifySubscribers(out OutData) {
+	for _, ch := range s.takeSubscribers() {
+		select {
+		case ch <- out:
+		default:
+		}
+	}
+}
+
+// dedup check task uid, must hold dispatcher lock, return handle of the existing task if coalesced.
+func (d *Dispatcher) dedup(t Task) (*Handle, error) {
+	if d.dedupMode == DedupOff || t.InData.TaskUID == "" {
+		return nil, nil
+	}
+
+	d.taskMutex.Lock()
+	defer d.taskMutex.Unlock()
+
+	d.pruneRecent()
+
+	s, ok := d.taskMap[t.InData.TaskUID]
+	if !ok {
+		rt, isRecent := d.recentMap[t.InData.TaskUID]
+		if !isRecent {
+			return nil, nil
+		}
+
+		s = rt.state
+	}
+
+	if d.dedupMode == DedupReject {
+		atomic.AddUint64(&(d.totalDuplicateTask), 1)
+
+		s.mutex.Lock()
+		status := s.status
+		s.mutex.Unlock()
+
+		return nil, &DuplicateTaskError{TaskUID: t.InData.TaskUID, Status: status}
+	}
+
+	atomic.AddUint64(&(d.totalCoalescedTask), 1)
+
+	if t.OutCh != nil {
+		s.subscribe(t.OutCh)
+	}
+
+	return &Handle{dispatcher: d, state: s}, nil
+}
+
+// remember a finished task in dedup window, must hold task lock.
+func (d *Dispatcher) remember(s *taskState) {
+	if d.dedupMode == DedupOff || d.dedupWindow <= 0 || s.taskUID == "" {
+		return
+	}
+
+	d.recentMap[s.taskUID] = recentTask{state: s, finishTime: d.now()}
+	d.recentList.PushBack(s)
+}
+
+// pruneRecent forget tasks finished before dedup window, must hold task lock.
+func (d *Dispatcher) pruneRecent() {
+	expire := d.now() - int64(d.dedupWindow)
+
+	for e := d.recentList.Front(); e != nil; e = d.recentList.Front() {
+		s := e.Value.(*taskState)
+
+		rt, ok := d.recentMap[s.taskUID]
+		if ok && rt.state == s && rt.finishTime > expire {
+			return
+		}
+
+		if ok && rt.state == s {
+			delete(d.recentMap, s.taskUID)
+		}
+
+		d.recentList.Remove(e)
+	}
+}
+
+// GetTotalDuplicateTask get total number of job refused because of duplicate uid since dispatcher start.
+func (d *Dispatcher) GetTotalDuplicateTask() uint64 {
+	return atomic.LoadUint64(&(d.totalDuplicateTask))
+}
+
+// GetTotalCoalescedTask get total number of job attached to an existing one since dispatcher start.
+func (d *Dispatcher) GetTotalCoalescedTask() uint64 {
+	return atomic.LoadUint64(&(d.totalCoalescedTask))
+}
@@ -0,0 +1,555 @@
+// Package diskqueue is a dispatcher.TaskStore which persist tasks in a segmented append-only log
+// on local disk, consumption is checkpointed so finished segments can be deleted.
+//
+// Use it to keep queued tasks over restarts:
+//
+//	store, err := diskqueue.Open(diskqueue.Config{Dir: "./queue"})
+//	d := dispatcher.GetDispatch(dispatcher.Config{Name: "x", Store: store}, workDo, nil)
+//	// OutCh and OriginalCtx can't be persisted, reattach them to recovered tasks
+//	num, err := d.Recover(func(t *dispatcher.Task) {
+//		t.OutCh = resultCh
+//	})
+package diskqueue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+)
+
+const (
+	defaultSegmentSize     = 64 * 1024 * 1024
+	defaultCheckpointEvery = 1000
+
+	segmentSuffix  = ".seg"
+	checkpointFile = "checkpoint"
+
+	recordPut = 1
+	recordAck = 2
+
+	recordHeadLen = 8 // length(4) + crc(4)
+	recordBodyMin = 9 // type(1) + seq(8)
+	recordMaxLen  = 1 << 30
+)
+
+// ErrorOfQueueClosed queue has closed.
+var ErrorOfQueueClosed = errors.New("disk queue has closed")
+
+// Config of disk queue.
+type Config struct {
+	Dir             string // dir of segment files, default "./"
+	SegmentSize     int64  // max size of a segment file, per - byte, default 64M
+	CheckpointEvery int    // write checkpoint file every n acks, default 1000
+	SyncEveryWrite  bool   // fsync after every append and ack, default false
+
+	// Logger receive warnings like truncating broken segment, nil means not log them.
+	Logger dispatcher.Logger
+}
+
+type segment struct {
+	startSeq uint64
+	path     string
+}
+
+// Queue a segmented append-only log of tasks.
+type Queue struct {
+	mutex  sync.Mutex
+	config Config
+	closed bool
+
+	segments []segment
+	active   *os.File
+	size     int64
+
+	nextSeq    uint64
+	checkpoint uint64 // all seq less than it are acked
+	pending    []uint64
+	acked      map[uint64]bool
+	ackNum     int
+
+	recovered []dispatcher.StoredTask
+}
+
+// Open a disk queue, unfinished tasks are loaded and can be got by Recover.
+func Open(c Config) (*Queue, error) {
+	if c.Dir == "" {
+		c.Dir = "./"
+	}
+
+	if c.SegmentSize <= 0 {
+		c.SegmentSize = defaultSegmentSize
+	}
+
+	if c.CheckpointEvery <= 0 {
+		c.CheckpointEvery = defaultCheckpointEvery
+	}
+
+	err := os.MkdirAll(c.Dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Queue{config: c, acked: make(map[uint64]bool)}
+
+	err = q.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+func (q *Queue) segmentPath(startSeq uint64) string {
+	return filepath.Join(q.config.Dir, fmt.Sprintf("%020d%s", startSeq, segmentSuffix))
+}
+
+func (q *Queue) readCheckpoint() error {
+	data, err := ioutil.ReadFile(filepath.Join(q.config.Dir, checkpointFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			q.checkpoint = 1
+			return nil
+		}
+
+		return err
+	}
+
+	q.checkpoint, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("parse checkpoint error : %s", err)
+	}
+
+	return nil
+}
+
+func (q *Queue) writeCheckpoint() error {
+	path := filepath.Join(q.config.Dir, checkpointFile)
+	tmp := path + ".tmp"
+
+	err := ioutil.WriteFile(tmp, []byte(strconv.FormatUint(q.checkpoint, 10)), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// load read checkpoint and all segments, rebuild pending tasks.
+func (q *Queue) load() error {
+	err := q.readCheckpoint()
+	if err != nil {
+		return err
+	}
+
+	rd, err := ioutil.ReadDir(q.config.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range rd {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), segmentSuffix) {
+			continue
+		}
+
+		start, err := strconv.ParseUint(strings.TrimSuffix(fi.Name(), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		q.segments = append(q.segments, segment{startSeq: start, path: filepath.Join(q.config.Dir, fi.Name())})
+	}
+
+	sort.Slice(q.segments, func(i, j int) bool {
+		return q.segments[i].startSeq < q.segments[j].startSeq
+	})
+
+	q.nextSeq = q.checkpoint
+	tasks := make(map[uint64]dispatcher.StoredTask)
+
+	for i, seg := range q.segments {
+		if seg.startSeq > q.nextSeq {
+			q.nextSeq = seg.startSeq
+		}
+
+		// segment entirely checkpointed
+		if i+1 < len(q.segments) && q.segments[i+1].startSeq <= q.checkpoint {
+			continue
+		}
+
+		isLast := i == len(q.segments)-1
+		err = q.readSegment(seg, isLast, tasks)
+		if err != nil {
+			return err
+		}
+	}
+
+	for seq, t := range tasks {
+		q.recovered = append(q.recovered, t)
+		q.pending = append(q.pending, seq)
+	}
+
+	sort.Slice(q.recovered, func(i, j int) bool {
+		return q.recovered[i].Seq < q.recovered[j].Seq
+	})
+
+	sort.Slice(q.pending, func(i, j int) bool {
+		return q.pending[i] < q.pending[j]
+	})
+
+	q.removeSegments()
+
+	return q.openSegment()
+}
+
+// readSegment read records of a segment, a broken tail of the last segment is truncated.
+func (q *Queue) readSegment(seg segment, isLast bool, tasks map[uint64]dispatcher.StoredTask) error {
+	f, err := os.OpenFile(seg.path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var offset int64
+	head := make([]byte, recordHeadLen)
+
+	for {
+		_, err = io.ReadFull(f, head)
+		if err == io.EOF {
+			return nil
+		}
+
+		var body []byte
+		if err == nil {
+			length := binary.BigEndian.Uint32(head[0:4])
+			if length < recordBodyMin || length > recordMaxLen {
+				err = fmt.Errorf("bad record length = %d", length)
+			} else {
+				body = make([]byte, length)
+				_, err = io.ReadFull(f, body)
+				if err == nil && crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(head[4:8]) {
+					err = fmt.Errorf("bad record crc")
+				}
+			}
+		}
+
+		if err != nil {
+			if !isLast {
+				return fmt.Errorf("read segment = %s offset = %d error : %s", seg.path, offset, err)
+			}
+
+			q.logf("segment = %s broken at offset = %d, truncate it, error = %s", seg.path, offset, err)
+			return f.Truncate(offset)
+		}
+
+		offset += int64(recordHeadLen + len(body))
+
+		seq := binary.BigEndian.Uint64(body[1:9])
+		if seq >= q.nextSeq {
+			q.nextSeq = seq + 1
+		}
+
+		if seq < q.checkpoint {
+			continue
+		}
+
+		switch body[0] {
+		case recordPut:
+			t, err := decodeTask(seq, body[9:])
+			if err != nil {
+				return fmt.Errorf("decode segment = %s offset = %d error : %s", seg.path, offset, err)
+			}
+
+			tasks[seq] = t
+		case recordAck:
+			delete(tasks, seq)
+		}
+	}
+}
+
+func (q *Queue) openSegment() error {
+	var seg segment
+	if len(q.segments) > 0 {
+		seg = q.segments[len(q.segments)-1]
+	} else {
+		seg = segment{startSeq: q.nextSeq, path: q.segmentPath(q.nextSeq)}
+		q.segments = append(q.segments, seg)
+	}
+
+	f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	q.active = f
+	q.size = fi.Size()
+
+	return nil
+}
+
+// rotate close active segment and create a new one start from next seq.
+func (q *Queue) rotate() error {
+	// active segment only has acks, keep using it
+	if q.segments[len(q.segments)-1].startSeq == q.nextSeq {
+		return nil
+	}
+
+	err := q.active.Close()
+	if err != nil {
+		return err
+	}
+
+	q.segments = append(q.segments, segment{startSeq: q.nextSeq, path: q.segmentPath(q.nextSeq)})
+
+	return q.openSegment()
+}
+
+// logf log a warning by Config.Logger.
+func (q *Queue) logf(format string, v ...interface{}) {
+	if q.config.Logger != nil {
+		q.config.Logger(format, v...)
+	}
+}
+
+// removeSegments delete segments which all records less than checkpoint, except the active one.
+func (q *Queue) removeSegments() {
+	for len(q.segments) > 1 && q.segments[1].startSeq <= q.checkpoint {
+		err := os.Remove(q.segments[0].path)
+		if err != nil && !os.IsNotExist(err) {
+			q.logf("delete segment = %s error = %s", q.segments[0].path, err)
+			return
+		}
+
+		q.segments = q.segments[1:]
+	}
+}
+
+func (q *Queue) write(recordType byte, seq uint64, payload []byte) error {
+	body := make([]byte, recordBodyMin+len(payload))
+	body[0] = recordType
+	binary.BigEndian.PutUint64(body[1:9], seq)
+	copy(body[9:], payload)
+
+	record := make([]byte, recordHeadLen+len(body))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(body))
+	copy(record[recordHeadLen:], body)
+
+	_, err := q.active.Write(record)
+	if err != nil {
+		return err
+	}
+
+	q.size += int64(len(record))
+
+	if q.config.SyncEveryWrite {
+		return q.active.Sync()
+	}
+
+	return nil
+}
+
+// Append persist a task, return sequence of it.
+func (q *Queue) Append(lane string, in dispatcher.InData) (uint64, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return 0, ErrorOfQueueClosed
+	}
+
+	if q.size >= q.config.SegmentSize {
+		err := q.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	seq := q.nextSeq
+
+	err := q.write(recordPut, seq, encodeTask(lane, in))
+	if err != nil {
+		return 0, err
+	}
+
+	q.nextSeq++
+	q.pending = append(q.pending, seq)
+
+	return seq, nil
+}
+
+// Ack a task, move checkpoint forward if all tasks before it are acked.
+// Seq not pending (already acked or never appended) is ignored.
+func (q *Queue) Ack(seq uint64) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return ErrorOfQueueClosed
+	}
+
+	if !q.isPending(seq) {
+		return nil
+	}
+
+	err := q.write(recordAck, seq, nil)
+	if err != nil {
+		return err
+	}
+
+	q.acked[seq] = true
+	for len(q.pending) > 0 && q.acked[q.pending[0]] {
+		delete(q.acked, q.pending[0])
+		q.pending = q.pending[1:]
+	}
+
+	if len(q.pending) > 0 {
+		q.checkpoint = q.pending[0]
+	} else {
+		q.checkpoint = q.nextSeq
+	}
+
+	q.ackNum++
+	if q.ackNum >= q.config.CheckpointEvery {
+		q.ackNum = 0
+
+		err = q.writeCheckpoint()
+		if err != nil {
+			return err
+		}
+
+		q.removeSegments()
+	}
+
+	return nil
+}
+
+// isPending check seq is appended and not acked yet.
+func (q *Queue) isPending(seq uint64) bool {
+	if seq < q.checkpoint || q.acked[seq] {
+		return false
+	}
+
+	i := sort.Search(len(q.pending), func(i int) bool {
+		return q.pending[i] >= seq
+	})
+
+	return i < len(q.pending) && q.pending[i] == seq
+}
+
+// Recover get tasks not acked when queue opened, can only get once.
+func (q *Queue) Recover() ([]dispatcher.StoredTask, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return nil, ErrorOfQueueClosed
+	}
+
+	list := q.recovered
+	q.recovered = nil
+
+	return list, nil
+}
+
+// Pending get number of tasks not acked.
+func (q *Queue) Pending() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return len(q.pending) - len(q.acked)
+}
+
+// Close sync and close queue, write checkpoint.
+func (q *Queue) Close() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return nil
+	}
+
+	q.closed = true
+
+	err := q.active.Sync()
+	if err != nil {
+		q.active.Close()
+		return err
+	}
+
+	err = q.active.Close()
+	if err != nil {
+		return err
+	}
+
+	err = q.writeCheckpoint()
+	if err != nil {
+		return err
+	}
+
+	q.removeSegments()
+
+	return nil
+}
+
+// encodeTask payload : lane length(2) + lane + uid length(4) + uid + data
+func encodeTask(lane string, in dispatcher.InData) []byte {
+	payload := make([]byte, 2+len(lane)+4+len(in.TaskUID)+len(in.Data))
+
+	binary.BigEndian.PutUint16(payload[0:2], uint16(len(lane)))
+	offset := 2 + copy(payload[2:], lane)
+
+	binary.BigEndian.PutUint32(payload[offset:offset+4], uint32(len(in.TaskUID)))
+	offset += 4
+	offset += copy(payload[offset:], in.TaskUID)
+
+	copy(payload[offset:], in.Data)
+
+	return payload
+}
+
+func decodeTask(seq uint64, payload []byte) (dispatcher.StoredTask, error) {
+	t := dispatcher.StoredTask{Seq: seq}
+
+	if len(payload) < 2 {
+		return t, fmt.Errorf("payload too short")
+	}
+
+	laneLen := int(binary.BigEndian.Uint16(payload[0:2]))
+	offset := 2
+	if len(payload) < offset+laneLen+4 {
+		return t, fmt.Errorf("payload too short")
+	}
+
+	t.Lane = string(payload[offset : offset+laneLen])
+	offset += laneLen
+
+	uidLen := int(binary.BigEndian.Uint32(payload[offset : offset+4]))
+	offset += 4
+	if len(payload) < offset+uidLen {
+		return t, fmt.Errorf("payload too short")
+	}
+
+	t.TaskUID = string(payload[offset : offset+uidLen])
+	offset += uidLen
+
+	t.Data = append([]byte(nil), payload[offset:]...)
+
+	return t, nil
+}
@@ -0,0 +1,275 @@
+package diskqueue_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+	"github.com/ezgroot/ezUtils/dispatcher/diskqueue"
+)
+
+func TestQueueRecover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskqueue")
+	if err != nil {
+		t.Fatalf("create temp dir error = %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := diskqueue.Config{Dir: dir, SegmentSize: 64, CheckpointEvery: 1}
+
+	q, err := diskqueue.Open(c)
+	if err != nil {
+		t.Fatalf("open queue error = %s", err)
+	}
+
+	var seqList []uint64
+	for i := 0; i < 10; i++ {
+		seq, err := q.Append("default", dispatcher.InData{TaskUID: fmt.Sprintf("task-%d", i), Data: []byte{byte(i)}})
+		if err != nil {
+			t.Fatalf("append error = %s", err)
+		}
+
+		seqList = append(seqList, seq)
+	}
+
+	for _, i := range []int{0, 1, 2, 5} {
+		err = q.Ack(seqList[i])
+		if err != nil {
+			t.Fatalf("ack error = %s", err)
+		}
+	}
+
+	err = q.Close()
+	if err != nil {
+		t.Fatalf("close error = %s", err)
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if len(segments) >= 10 {
+		t.Fatalf("checkpointed segments not deleted, segments = %d", len(segments))
+	}
+
+	q, err = diskqueue.Open(c)
+	if err != nil {
+		t.Fatalf("reopen queue error = %s", err)
+	}
+	defer q.Close()
+
+	if q.Pending() != 6 {
+		t.Fatalf("pending = %d, expect 6", q.Pending())
+	}
+
+	out := make(chan dispatcher.OutData, 10)
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "disk", Store: q},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			task.Reply(dispatcher.OutData{Data: task.InData.Data})
+			return nil
+		}, nil)
+	defer d.Shutdown(context.Background())
+
+	num, err := d.Recover(func(t *dispatcher.Task) {
+		t.OutCh = out
+	})
+	if err != nil || num != 6 {
+		t.Fatalf("recover num = %d, error = %v", num, err)
+	}
+
+	expect := map[byte]bool{3: true, 4: true, 6: true, 7: true, 8: true, 9: true}
+	for i := 0; i < num; i++ {
+		result := <-out
+		if !expect[result.Data[0]] {
+			t.Fatalf("unexpected recovered task data = %v", result.Data)
+		}
+	}
+
+	deadline := time.Now().Add(time.Duration(5) * time.Second)
+	for d.GetTotalDoneTask() != uint64(num) {
+		if time.Now().After(deadline) {
+			t.Fatalf("done = %d, expect %d", d.GetTotalDoneTask(), num)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	if q.Pending() != 0 {
+		t.Fatalf("pending = %d after all recovered task done", q.Pending())
+	}
+}
+
+func TestQueueBrokenTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskqueue")
+	if err != nil {
+		t.Fatalf("create temp dir error = %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := diskqueue.Open(diskqueue.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("open queue error = %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err = q.Append("", dispatcher.InData{TaskUID: fmt.Sprintf("task-%d", i)})
+		if err != nil {
+			t.Fatalf("append error = %s", err)
+		}
+	}
+
+	q.Close()
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	f, err := os.OpenFile(segments[len(segments)-1], os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("open segment error = %s", err)
+	}
+
+	f.Write([]byte{0, 0, 0, 100, 1, 2})
+	f.Close()
+
+	q, err = diskqueue.Open(diskqueue.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("reopen queue error = %s", err)
+	}
+	defer q.Close()
+
+	list, _ := q.Recover()
+	if len(list) != 3 || list[2].TaskUID != "task-2" {
+		t.Fatalf("recovered tasks = %+v", list)
+	}
+
+	seq, err := q.Append("", dispatcher.InData{TaskUID: "task-3"})
+	if err != nil || seq != list[2].Seq+1 {
+		t.Fatalf("append after truncate seq = %d, error = %v", seq, err)
+	}
+}
+
+func TestQueueRefused(t *testing.T) {
+	q, err := diskqueue.Open(diskqueue.Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("open queue error = %s", err)
+	}
+	defer q.Close()
+
+	release := make(chan struct{})
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "refused", MaxWorkerNum: 1, Store: q, Dedup: dispatcher.DedupReject},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			<-release
+			return nil
+		}, nil)
+	defer d.Shutdown(context.Background())
+	defer close(release)
+
+	for i := 0; i < 3; i++ {
+		_, err = d.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: "same"}})
+		if (i == 0) != (err == nil) {
+			t.Fatalf("submit %d error = %v", i, err)
+		}
+	}
+
+	// refused tasks are acked, so they are not recovered after restart
+	if q.Pending() != 1 {
+		t.Fatalf("pending = %d, expect 1", q.Pending())
+	}
+}
+
+func TestQueueShutdownAbandon(t *testing.T) {
+	q, err := diskqueue.Open(diskqueue.Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("open queue error = %s", err)
+	}
+	defer q.Close()
+
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "abandon-store", MaxWorkerNum: 1, Store: q},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}, nil)
+
+	for _, uid := range []string{"running", "queued"} {
+		err = d.AddTask(dispatcher.Task{InData: dispatcher.InData{TaskUID: uid}, TimeOut: 60 * 1000})
+		if err != nil {
+			t.Fatalf("add task error = %s", err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Duration(5) * time.Second)
+	for d.GetCurrentRunningNum() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("task not running")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(20)*time.Millisecond)
+	defer cancel()
+
+	if err = d.Shutdown(ctx); err == nil {
+		t.Fatalf("shutdown not abandon tasks")
+	}
+
+	for d.GetTotalCancelTask() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("running task not cancelled")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	// tasks interrupted by shutdown are not acked, so they are recovered after restart
+	if q.Pending() != 2 {
+		t.Fatalf("pending = %d, expect 2", q.Pending())
+	}
+}
+
+func TestQueueAckNotPending(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := diskqueue.Open(diskqueue.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("open queue error = %s", err)
+	}
+
+	seq, err := q.Append("", dispatcher.InData{TaskUID: "task-0"})
+	if err != nil {
+		t.Fatalf("append error = %s", err)
+	}
+
+	// ack of seq not appended yet, and ack twice, are ignored
+	for _, s := range []uint64{seq + 1, seq + 100, seq, seq} {
+		if err = q.Ack(s); err != nil {
+			t.Fatalf("ack %d error = %s", s, err)
+		}
+	}
+
+	if q.Pending() != 0 {
+		t.Fatalf("pending = %d, expect 0", q.Pending())
+	}
+
+	next, err := q.Append("", dispatcher.InData{TaskUID: "task-1"})
+	if err != nil || next != seq+1 {
+		t.Fatalf("append seq = %d, error = %v", next, err)
+	}
+
+	if q.Pending() != 1 {
+		t.Fatalf("pending = %d, expect 1", q.Pending())
+	}
+
+	q.Close()
+
+	q, err = diskqueue.Open(diskqueue.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("reopen queue error = %s", err)
+	}
+	defer q.Close()
+
+	list, _ := q.Recover()
+	if len(list) != 1 || list[0].TaskUID != "task-1" {
+		t.Fatalf("recovered tasks = %+v", list)
+	}
+}
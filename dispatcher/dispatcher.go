@@ -1,15 +1,21 @@
 package dispatcher
 
 import (
+	"container/list"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"runtime"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 const (
 	defaultTaskQueueMaxNum = 100 * 10000
+	defaultStarvationTime  = time.Duration(5000) * time.Millisecond
 )
 
 // ErrorOfDispatcherHasStop dispatcher is stop
@@ -31,22 +37,161 @@ type Config struct {
 	Name         string
 	MaxWorkerNum int
 	MaxTaskNum   int
-	IsTrance     bool
+	IsTrance     bool // log task cost and refused tasks by Logger, stdout if Logger is nil
+
+	// Logger receive warnings like worker resource or task store error, nil means not log them.
+	Logger Logger
+
+	// Hooks receive events of tasks and workers, see hooks.NewLog and hooks.NewTrace.
+	Hooks Hooks
+
+	// MinWorkerNum workers keep alive, more workers will be created when task queue backing up
+	// and retired when idle longer than IdleTimeout, default MaxWorkerNum.
+	MinWorkerNum int
+	IdleTimeout  time.Duration // default 60s
+	// NewResource create own resource for every worker, which will be released when worker retired,
+	// nil means all workers share the resource pass to GetDispatch.
+	NewResource ResourceFactory
+	// ResourcePool resources shared by all workers, worker acquire one for every task
+	// instead of using its own, see NewResourcePool. It is not closed by Shutdown.
+	ResourcePool *ResourcePool
+
+	// Lanes of task queue, task choose lane by Task.Lane, empty means the first lane.
+	// default only one lane named "default".
+	Lanes []LaneConfig
+	// StarvationTime the first task of a lane wait longer than it will be operated
+	// before other lanes regardless of weight, default 5s.
+	StarvationTime time.Duration
+
+	// Retry policy of task which operate error, can be override by Task.Retry,
+	// workDo should only reply success result when retry enable, dispatcher will
+	// reply the last error when task use up all attempts.
+	Retry *RetryPolicy
+	// DeadLetter receive tasks which use up all attempts, nil means drop them.
+	DeadLetter DeadLetterSink
+
+	// Dedup how to operate tasks with the same uid when one is queued or running, default DedupOff,
+	// in DedupCoalesce mode workDo should reply by Task.Reply so every submitter get the result,
+	// out chan of coalesced tasks should be buffered, or the result is dropped if not being read.
+	Dedup DedupMode
+	// DedupWindow remember uid of finished tasks for a while, duplicate tasks in window are
+	// refused or get the remembered result, default 0 means not remember.
+	DedupWindow time.Duration
+
+	// RateLimit limit how fast tasks of dispatcher start, nil means no limit.
+	RateLimit *RateLimit
+	// LimitKey get limit key of task, tasks of the same key share KeyRateLimit and
+	// MaxKeyRunningNum, empty key means not limited by key.
+	LimitKey func(in InData) string
+	// KeyRateLimit limit how fast tasks of a key start, nil means no limit.
+	KeyRateLimit *RateLimit
+	// MaxKeyRunningNum max running tasks of a key, default 0 means no limit.
+	// Tasks exceed limits wait in queue, tasks of other keys are not blocked by them.
+	MaxKeyRunningNum int
+
+	// BatchSize max tasks of a batch when dispatcher created by GetBatchDispatch, default 16.
+	BatchSize int
+	// BatchLinger wait more tasks to fill a batch, default 0 means only take tasks already queued.
+	BatchLinger time.Duration
+
+	// Admission decide state of lane when task added, tasks are refused by AdmissionError
+	// when state is StateOfDeny, default StaticAdmission.
+	Admission AdmissionController
+	// OnStateChange receive transitions of dispatcher state in order, it is called in
+	// a separate goroutine.
+	OnStateChange func(old State, new State)
+
+	// Store persist queued tasks, call Dispatcher.Recover to requeue unfinished tasks after restart,
+	// nil means tasks only in memory.
+	Store TaskStore
+
+	// Clock source of time for timeout, retry backoff, limits and scheduled tasks, default real clock.
+	Clock Clock
+	// Synchronous operate tasks in the goroutine which add them before Submit return, instead of
+	// worker goroutines, retried and scheduled tasks are operated in the goroutine of clock timer.
+	// It is used by tests with a virtual clock, see package dispatchertest.
+	Synchronous bool
 }
 
 // Dispatcher job to worker to do.
 type Dispatcher struct {
-	maxWorkerNum     int
-	workerCh         chan *Worker
-	taskCh           chan Task
-	name             string
-	state            State
-	isStop           bool
-	isTrance         bool
-	totalInTask      uint64
-	totalDoneTask    uint64
-	totalErrorTask   uint64
-	totalRefusedTask uint64
+	maxWorkerNum       int32
+	minWorkerNum       int32
+	idleTimeout        time.Duration
+	workerNum          int32
+	workerSeq          int32
+	workDo             workDoing
+	batchDo            batchDoing
+	batchSize          int
+	batchLinger        time.Duration
+	resource           Resource
+	newResource        ResourceFactory
+	pool               *ResourcePool
+	workerCh           chan *Worker
+	clock              Clock
+	isSynchronous      bool
+	inline             *Worker
+	inlineRunning      int32
+	inlineDirty        int32
+	workerChMutex      sync.RWMutex
+	paused             int32
+	workerMapMutex     sync.Mutex
+	workerMap          map[int]*Worker
+	parkedMap          map[int]*Worker
+	wakeCh             chan struct{}
+	quitCh             chan struct{}
+	assignDoneCh       chan struct{} // closed when assignTask quit, no task is assigned after
+	mutex              sync.Mutex
+	lanes              []*lane
+	laneMap            map[string]*lane
+	starvationTime     time.Duration
+	limiter            *limiter
+	name               string
+	state              State
+	admission          AdmissionController
+	hooks              Hooks
+	logger             Logger
+	isHooked           bool
+	stateChanges       []stateChange
+	stateWakeCh        chan struct{}
+	isStop             bool
+	retry              *RetryPolicy
+	deadLetter         DeadLetterSink
+	store              TaskStore
+	scheduleMutex      sync.Mutex
+	scheduleHeap       scheduleHeap
+	scheduleMap        map[string]*scheduleEntry
+	scheduleWakeCh     chan struct{}
+	taskMutex          sync.Mutex
+	taskMap            map[string]*taskState
+	dedupMode          DedupMode
+	dedupWindow        time.Duration
+	recentMap          map[string]recentTask
+	recentList         *list.List
+	totalDuplicateTask uint64
+	totalCoalescedTask uint64
+	totalCancelTask    uint64
+	running            map[uint64]runningTask
+	runSeq             uint64
+	retrying           map[uint64]retryingTask
+	retrySeq           uint64
+	abandoned          bool
+	activeNum          int64
+	finishCh           chan struct{}
+	workerWg           sync.WaitGroup
+	waitHistogram      *Histogram
+	runHistogram       *Histogram
+	closed             int32
+	retryingNum        int64
+	totalRetryTask     uint64
+	totalInTask        uint64
+	totalDoneTask      uint64
+	totalErrorTask     uint64
+	totalPanicTask     uint64
+	totalRefusedTask   uint64
+	totalScaleUp       uint64
+	totalScaleDown     uint64
+	lastScaleTime      int64
 }
 
 func newDispatcher(c Config) *Dispatcher {
@@ -54,39 +199,414 @@ func newDispatcher(c Config) *Dispatcher {
 		c.MaxWorkerNum = runtime.NumCPU() * 2
 	}
 
+	if c.MinWorkerNum <= 0 || c.MinWorkerNum > c.MaxWorkerNum {
+		c.MinWorkerNum = c.MaxWorkerNum
+	}
+
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = defaultWorkerIdleTimeout
+	}
+
 	if c.MaxTaskNum <= 0 {
 		c.MaxTaskNum = defaultTaskQueueMaxNum
 	}
 
+	if c.StarvationTime <= 0 {
+		c.StarvationTime = defaultStarvationTime
+	}
+
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultBatchSize
+	}
+
+	if c.Admission == nil {
+		c.Admission = StaticAdmission{}
+	}
+
+	if c.Clock == nil {
+		c.Clock = realClock{}
+	}
+
+	if c.Synchronous {
+		c.MaxWorkerNum = 1
+		c.MinWorkerNum = 1
+	}
+
+	if len(c.Lanes) == 0 {
+		c.Lanes = []LaneConfig{{Name: defaultLaneName, Weight: defaultLaneWeight}}
+	}
+
 	d := &Dispatcher{name: c.Name,
-		maxWorkerNum: c.MaxWorkerNum,
-		workerCh:     make(chan *Worker, c.MaxWorkerNum),
-		taskCh:       make(chan Task, c.MaxTaskNum),
-		isTrance:     c.IsTrance,
-		state:        StateOfNormal,
-		isStop:       false}
+		maxWorkerNum:   int32(c.MaxWorkerNum),
+		minWorkerNum:   int32(c.MinWorkerNum),
+		idleTimeout:    c.IdleTimeout,
+		newResource:    c.NewResource,
+		pool:           c.ResourcePool,
+		workerCh:       make(chan *Worker, c.MaxWorkerNum),
+		workerMap:      make(map[int]*Worker),
+		parkedMap:      make(map[int]*Worker),
+		wakeCh:         make(chan struct{}, 1),
+		quitCh:         make(chan struct{}),
+		assignDoneCh:   make(chan struct{}),
+		laneMap:        make(map[string]*lane),
+		starvationTime: c.StarvationTime,
+		limiter:        newLimiter(c, c.Clock.Now().UTC().UnixNano()),
+		clock:          c.Clock,
+		isSynchronous:  c.Synchronous,
+		batchSize:      c.BatchSize,
+		admission:      c.Admission,
+		stateWakeCh:    make(chan struct{}, 1),
+		batchLinger:    c.BatchLinger,
+		retry:          c.Retry,
+		deadLetter:     c.DeadLetter,
+		store:          c.Store,
+		scheduleMap:    make(map[string]*scheduleEntry),
+		scheduleWakeCh: make(chan struct{}, 1),
+		taskMap:        make(map[string]*taskState),
+		dedupMode:      c.Dedup,
+		dedupWindow:    c.DedupWindow,
+		recentMap:      make(map[string]recentTask),
+		recentList:     list.New(),
+		running:        make(map[uint64]runningTask),
+		retrying:       make(map[uint64]retryingTask),
+		finishCh:       make(chan struct{}, 1),
+		waitHistogram:  NewHistogram(DefaultHistogramBuckets),
+		runHistogram:   NewHistogram(DefaultHistogramBuckets),
+		state:          StateOfNormal,
+		isStop:         false}
+
+	d.logger = c.Logger
+
+	var list []Hooks
+	if c.IsTrance {
+		if d.logger == nil {
+			d.logger = StdoutLogger
+		}
+
+		list = append(list, tranceHooks{d: d})
+	}
+
+	if c.OnStateChange != nil {
+		list = append(list, stateFuncHooks{f: c.OnStateChange})
+	}
+
+	d.hooks = MultiHooks(append(list, c.Hooks)...)
+	d.isHooked = len(list) > 0 || c.Hooks != nil
+
+	for _, lc := range c.Lanes {
+		l := newLane(lc, c.MaxTaskNum)
+		if _, ok := d.laneMap[l.name]; ok {
+			continue
+		}
+
+		d.lanes = append(d.lanes, l)
+		d.laneMap[l.name] = l
+	}
 
 	return d
 }
 
+// getLane get lane by name, empty name means the first lane.
+func (d *Dispatcher) getLane(name string) (*lane, error) {
+	if name == "" {
+		return d.lanes[0], nil
+	}
+
+	l, ok := d.laneMap[name]
+	if !ok {
+		return nil, ErrorOfLaneNotExist
+	}
+
+	return l, nil
+}
+
+func (d *Dispatcher) wake() {
+	if d.isSynchronous {
+		d.runInline()
+		return
+	}
+
+	select {
+	case d.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// nextTask choose a task from lanes, a starving lane first, otherwise
+// use smooth weighted round robin between not empty lanes, tasks exceed limits are skipped.
+// If no task can start, return how long to wait, 0 means queue is empty and
+// negative means wait a running task finish.
+func (d *Dispatcher) nextTask() (Task, time.Duration, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := d.now()
+
+	if wait := d.limiter.wait(now); wait > 0 {
+		return Task{}, wait, false
+	}
+
+	var wait time.Duration
+	heads := make([]*list.Element, len(d.lanes))
+	for i, l := range d.lanes {
+		var w time.Duration
+		heads[i], w = d.limiter.head(l, now)
+		wait = minLimitWait(wait, w)
+	}
+
+	picked := -1
+
+	var maxWait int64
+	for i, e := range heads {
+		if e == nil {
+			continue
+		}
+
+		w := now - e.Value.(Task).StartTime
+		if w >= int64(d.starvationTime) && w > maxWait {
+			picked = i
+			maxWait = w
+		}
+	}
+
+	if picked < 0 {
+		total := 0
+		for i, l := range d.lanes {
+			if heads[i] == nil {
+				continue
+			}
+
+			l.current += l.weight
+			total += l.weight
+			if picked < 0 || l.current > d.lanes[picked].current {
+				picked = i
+			}
+		}
+
+		if picked < 0 {
+			return Task{}, wait, false
+		}
+
+		d.lanes[picked].current -= total
+	}
+
+	atomic.AddInt64(&(d.activeNum), 1)
+
+	t := d.lanes[picked].queue.Remove(heads[picked]).(Task)
+	if t.state != nil {
+		t.state.mutex.Lock()
+		t.state.element = nil
+		t.state.mutex.Unlock()
+	}
+
+	d.limiter.acquire(t, now)
+
+	// running since popped, so abandon cancel it even not received by worker yet
+	d.runSeq++
+	t.runID = d.runSeq
+	d.running[t.runID] = runningTask{taskUID: t.InData.TaskUID, state: t.state, cancel: func() {}}
+
+	return t, 0, true
+}
+
 func (d *Dispatcher) assignTask() {
-	for t := range d.taskCh {
-		go func(task Task) {
-			worker := <-d.workerCh
-			worker.taskCh <- task
-		}(t)
+	defer close(d.assignDoneCh)
+
+	for {
+		if d.IsPaused() || d.GetCurrentTaskTodoNum() == 0 {
+			select {
+			case <-d.wakeCh:
+			case <-d.quitCh:
+				return
+			}
+
+			continue
+		}
+
+		var worker *Worker
+		select {
+		case worker = <-d.getWorkerCh():
+		default:
+			worker = d.scaleUp()
+		}
+
+		// wake when resized, since chan of free workers may be replaced
+		if worker == nil {
+			select {
+			case worker = <-d.getWorkerCh():
+			case <-d.wakeCh:
+				continue
+			case <-d.clock.NewTimer(defaultScaleRetryPeriod).C():
+				continue
+			case <-d.quitCh:
+				return
+			}
+		}
+
+		if d.parkPaused(worker) {
+			continue
+		}
+
+		task, wait, ok := d.nextTask()
+		if !ok {
+			d.putWorker(worker)
+			if !d.waitLimit(wait) {
+				return
+			}
+
+			continue
+		}
+
+		if d.batchDo != nil {
+			worker.batchCh <- d.collectBatch(task)
+			continue
+		}
+
+		worker.taskCh <- task
+	}
+}
+
+func (d *Dispatcher) countDone(t Task) {
+	d.ack(t)
+
+	atomic.AddUint64(&(d.totalDoneTask), 1)
+	if t.lane != nil {
+		atomic.AddUint64(&(t.lane.totalDoneTask), 1)
+	}
+
+	d.finishTask(t, TaskStatusDone, OutData{Attempts: t.Attempt})
+}
+
+func (d *Dispatcher) countError(t Task) {
+	atomic.AddUint64(&(d.totalErrorTask), 1)
+	if t.lane != nil {
+		atomic.AddUint64(&(t.lane.totalErrorTask), 1)
+	}
+}
+
+// taskFailed retry the task if policy allow, otherwise count error and put it to dead letter,
+// isReply means the error is not from workDo and should reply to task.
+func (d *Dispatcher) taskFailed(t Task, err error, isReply bool) {
+	if t.state.cancelled() {
+		if !t.state.replied() {
+			t.Reply(OutData{Err: ErrorOfTaskCancelled})
+		}
+
+		d.taskCancelled(t)
+		return
+	}
+
+	policy := t.Retry
+	if policy == nil {
+		policy = d.retry
+	}
+
+	if policy.canRetry(t.Attempt, err) && t.OriginalCtx.Err() == nil {
+		atomic.AddUint64(&(d.totalRetryTask), 1)
+		atomic.AddInt64(&(d.retryingNum), 1)
+
+		d.addRetrying(t, policy.backoff(t.Attempt))
+
+		return
 	}
+
+	d.ack(t)
+	d.countError(t)
+
+	if isReply || (policy != nil && policy.MaxAttempts > 1) {
+		t.Reply(OutData{Err: err})
+	}
+
+	if d.deadLetter != nil {
+		d.deadLetter.Put(DeadLetter{Task: t, Err: err, Attempts: t.Attempt, Time: d.now()})
+	}
+
+	d.finishTask(t, TaskStatusFailed, OutData{Err: err, Attempts: t.Attempt})
+}
+
+// requeue put a retry task back to its lane when backoff timer fired, never refuse.
+func (d *Dispatcher) requeue(id uint64) {
+	d.mutex.Lock()
+	rt, ok := d.retrying[id]
+	if !ok {
+		// abandoned by shutdown
+		d.mutex.Unlock()
+		return
+	}
+
+	delete(d.retrying, id)
+
+	t := rt.task
+	isAbandoned := d.abandoned
+	isCancelled := t.state.cancelled()
+	if !isAbandoned && !isCancelled {
+		t.StartTime = d.now()
+		d.push(t.lane, t)
+		d.checkLane(t.lane)
+		d.updateState()
+	}
+	d.mutex.Unlock()
+
+	if isAbandoned {
+		d.dropRetrying(t)
+		return
+	}
+
+	if isCancelled {
+		t.tryReply(OutData{Err: ErrorOfTaskCancelled})
+		d.taskCancelled(t)
+	}
+
+	atomic.AddInt64(&(d.retryingNum), -1)
+
+	d.wake()
+
+	select {
+	case d.finishCh <- struct{}{}:
+	default:
+	}
+}
+
+// updateState dispatcher state is the busiest state of all lanes, must hold lock.
+func (d *Dispatcher) updateState() {
+	state := StateOfNormal
+	for _, l := range d.lanes {
+		if l.state > state {
+			state = l.state
+		}
+	}
+
+	if state != d.state && d.isHooked {
+		d.stateChanges = append(d.stateChanges, stateChange{old: d.state, new: state})
+
+		select {
+		case d.stateWakeCh <- struct{}{}:
+		default:
+		}
+	}
+
+	d.state = state
 }
 
 func (d *Dispatcher) run(workDo workDoing, r Resource) {
-	for i := 0; i < d.maxWorkerNum; i++ {
-		worker := newWorker(d, i, workDo, r)
-		worker.working()
+	d.workDo = workDo
+	d.resource = r
 
-		d.workerCh <- worker
+	if d.isSynchronous {
+		d.runSynchronous()
+		return
 	}
 
+	d.fillWorkers()
+
 	go d.assignTask()
+	go d.runSchedule()
+
+	if d.isHooked {
+		go d.notifyState()
+	}
+
+	go d.shrink()
 }
 
 func (d *Dispatcher) setStop() {
@@ -103,32 +623,79 @@ func (d *Dispatcher) getStopFlag() bool {
 
 // AddTask add a job to do.
 func (d *Dispatcher) AddTask(t Task) error {
+	_, err := d.Submit(t)
+
+	return err
+}
+
+// Submit add a job to do, return handle of it to get status, wait result or cancel.
+func (d *Dispatcher) Submit(t Task) (*Handle, error) {
+	h, err := d.submit(t)
+	if err != nil {
+		d.hooks.OnRefuse(t, err)
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (d *Dispatcher) submit(t Task) (*Handle, error) {
 	if d.getStopFlag() {
-		return ErrorOfDispatcherHasStop
+		return nil, ErrorOfDispatcherHasStop
 	}
 
-	if d.GetCurrentTaskTodoNum() >= d.GetMaxTaskNum()/2 {
-		d.state = StateOfHalf
+	l, err := d.getLane(t.Lane)
+	if err != nil {
+		return nil, err
 	}
 
-	if d.GetCurrentTaskTodoNum() >= d.GetMaxTaskNum()*7/10 {
-		d.state = StateOfBusy
+	t.Lane = l.name
+	t.lane = l
+
+	// store may write disk, so append before lock and ack it if task is not queued at last
+	if d.store != nil {
+		t.storeSeq, err = d.store.Append(l.name, t.InData)
+		if err != nil {
+			return nil, fmt.Errorf("dispatcher store task = %s error : %s", t.InData.TaskUID, err)
+		}
+	}
+
+	d.mutex.Lock()
+
+	h, err := d.dedup(t)
+	if err != nil || h != nil {
+		d.mutex.Unlock()
+		d.ack(t)
+		return h, err
 	}
 
-	if d.GetCurrentTaskTodoNum() >= d.GetMaxTaskNum()*95/100 {
+	state, retryAfter := d.checkLane(l)
+	d.updateState()
+
+	if state == StateOfDeny {
+		d.mutex.Unlock()
+		d.ack(t)
+
 		atomic.AddUint64(&(d.totalRefusedTask), 1)
-		d.state = StateOfDeny
-		d.Status()
-		return fmt.Errorf("dispatcher too busy, task = %s has been refused", t.InData.TaskUID)
+		atomic.AddUint64(&(l.totalRefusedTask), 1)
+		return nil, &AdmissionError{TaskUID: t.InData.TaskUID, Lane: l.name, State: state, RetryAfter: retryAfter}
 	}
 
-	t.StartTime = time.Now().UTC().UnixNano()
+	t.StartTime = d.now()
 
 	atomic.AddUint64(&(d.totalInTask), 1)
+	atomic.AddUint64(&(l.totalInTask), 1)
+
+	t.state = newTaskState(t.InData.TaskUID)
+	d.register(t.state)
 
-	d.taskCh <- t
+	d.push(l, t)
+	d.mutex.Unlock()
 
-	return nil
+	d.hooks.OnEnqueue(t)
+	d.wake()
+
+	return &Handle{dispatcher: d, state: t.state}, nil
 }
 
 // StopTemporary dispatcher, not accept task any more, but should finish all task that in queue,
@@ -137,52 +704,76 @@ func (d *Dispatcher) StopTemporary() {
 	d.setStop()
 }
 
-// StartAgain dispatcher.
+// StartAgain dispatcher, not work after shutdown.
 func (d *Dispatcher) StartAgain() {
+	if d.isClosed() {
+		return
+	}
+
 	d.setStart()
 }
 
 // StopForever dispatcher, not accept task any more, but should finish all task that in queue,
-// then every worker will quit, can't be start again.
+// then every worker will quit, can't be start again. Use Shutdown to wait with deadline.
 func (d *Dispatcher) StopForever(done chan struct{}) {
-	d.setStop()
-
 	go func() {
-		for {
-			if d.GetCurrentTaskTodoNum() == 0 {
-				if d.GetCurrentFreeWorkerNum() == 0 {
-					fmt.Printf("All workers stop accepting new task and continue to finish the work on their hand now.\n")
-					done <- struct{}{}
-					return
-				}
-
-				worker := <-d.workerCh
-				worker.stop()
-			}
+		err := d.Shutdown(context.Background())
+		if err != nil {
+			d.logf("dispatcher = %s shutdown error = %s", d.name, err)
 		}
+
+		d.logf("dispatcher = %s all workers stop accepting new task and finish the work on their hand now", d.name)
+		done <- struct{}{}
 	}()
 }
 
-// Status show the status of the current dispatcher.
+// Status show the status of the current dispatcher to stdout.
 func (d *Dispatcher) Status() {
-	fmt.Printf(
+	d.WriteStatus(os.Stdout)
+}
+
+// WriteStatus write the status of the current dispatcher to w.
+func (d *Dispatcher) WriteStatus(w io.Writer) {
+	fmt.Fprintf(w,
 		"\n****************************************************************\n"+
 			"*               %s dispatcher status\n"+
 			"*         ----------------------------------------------\n"+
 			"* state : %d\n"+
 			"* isStop : %t\n"+
-			"* total worker number : %d\n"+
+			"* total worker number : %d (min : %d, max : %d)\n"+
+			"* total scale up : %d, scale down : %d, last scale at : %s\n"+
 			"* max task number : %d\n"+
-			"* current free workers : %d\n"+
+			"* current free workers : %d, paused workers : %v\n"+
 			"* current task wait todo : %d\n"+
+			"* current task running : %d\n"+
 			"* total in task number : %d\n"+
 			"* total done task number : %d\n"+
 			"* total error task number : %d\n"+
+			"* total panic task number : %d\n"+
 			"* total refused task number : %d\n"+
-			"****************************************************************\n",
-		d.GetName(), d.state, d.getStopFlag(), d.GetTotalWorkNum(), d.GetMaxTaskNum(),
-		d.GetCurrentFreeWorkerNum(), d.GetCurrentTaskTodoNum(), d.GetTotalInTask(),
-		d.GetTotalDoneTask(), d.GetTotalErrorTask(), d.GetTotalRefusedTask())
+			"* total cancel task number : %d\n"+
+			"* total duplicate task number : %d, coalesced : %d\n"+
+			"* total retry task number : %d\n"+
+			"* current task wait retry : %d\n"+
+			"* current task scheduled : %d\n",
+		d.GetName(), d.GetState(), d.getStopFlag(),
+		d.GetTotalWorkNum(), d.GetMinWorkerNum(), d.GetMaxWorkerNum(),
+		d.GetTotalScaleUp(), d.GetTotalScaleDown(), d.getLastScaleTimeStr(), d.GetMaxTaskNum(),
+		d.GetCurrentFreeWorkerNum(), d.GetPausedWorkerIDs(), d.GetCurrentTaskTodoNum(), d.GetCurrentRunningNum(), d.GetTotalInTask(),
+		d.GetTotalDoneTask(), d.GetTotalErrorTask(), d.GetTotalPanicTask(), d.GetTotalRefusedTask(),
+		d.GetTotalCancelTask(), d.GetTotalDuplicateTask(), d.GetTotalCoalescedTask(), d.GetTotalRetryTask(), d.GetCurrentRetryingNum(), d.GetCurrentScheduledNum())
+
+	for _, ls := range d.GetLanesStatus() {
+		fmt.Fprintf(w,
+			"*         ----------------------------------------------\n"+
+				"* lane : %s, weight : %d, state : %d\n"+
+				"*   task wait todo : %d / %d\n"+
+				"*   in : %d, done : %d, error : %d, refused : %d\n",
+			ls.Name, ls.Weight, ls.State, ls.TaskTodoNum, ls.MaxTaskNum,
+			ls.TotalInTask, ls.TotalDoneTask, ls.TotalErrorTask, ls.TotalRefusedTask)
+	}
+
+	fmt.Fprintf(w, "****************************************************************\n")
 }
 
 // GetName get dispatcher name.
@@ -190,24 +781,69 @@ func (d *Dispatcher) GetName() string {
 	return d.name
 }
 
-// GetTotalWorkNum get max number of worker.
+// GetTotalWorkNum get current number of worker.
 func (d *Dispatcher) GetTotalWorkNum() int {
-	return cap(d.workerCh)
+	return int(atomic.LoadInt32(&(d.workerNum)))
+}
+
+// GetMaxWorkerNum get max number of worker.
+func (d *Dispatcher) GetMaxWorkerNum() int {
+	return int(atomic.LoadInt32(&(d.maxWorkerNum)))
+}
+
+// GetMinWorkerNum get min number of worker.
+func (d *Dispatcher) GetMinWorkerNum() int {
+	return int(atomic.LoadInt32(&(d.minWorkerNum)))
+}
+
+// GetTotalScaleUp get total number of worker created since dispatcher start.
+func (d *Dispatcher) GetTotalScaleUp() uint64 {
+	return atomic.LoadUint64(&(d.totalScaleUp))
+}
+
+// GetTotalScaleDown get total number of worker retired because of idle since dispatcher start.
+func (d *Dispatcher) GetTotalScaleDown() uint64 {
+	return atomic.LoadUint64(&(d.totalScaleDown))
 }
 
-// GetMaxTaskNum get max number of job queue.
+func (d *Dispatcher) getLastScaleTimeStr() string {
+	last := atomic.LoadInt64(&(d.lastScaleTime))
+	if last == 0 {
+		return "-"
+	}
+
+	return time.Unix(0, last).Format("2006-01-02 15:04:05")
+}
+
+// GetMaxTaskNum get max number of job queue, sum of all lanes.
 func (d *Dispatcher) GetMaxTaskNum() int {
-	return cap(d.taskCh)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var num int
+	for _, l := range d.lanes {
+		num += l.maxTaskNum
+	}
+
+	return num
 }
 
 // GetCurrentFreeWorkerNum get current free worker number.
 func (d *Dispatcher) GetCurrentFreeWorkerNum() int {
-	return len(d.workerCh)
+	return len(d.getWorkerCh())
 }
 
-// GetCurrentTaskTodoNum get current job number wait to operate.
+// GetCurrentTaskTodoNum get current job number wait to operate, sum of all lanes.
 func (d *Dispatcher) GetCurrentTaskTodoNum() int {
-	return len(d.taskCh)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var num int
+	for _, l := range d.lanes {
+		num += l.queue.Len()
+	}
+
+	return num
 }
 
 // GetTotalInTask  get total number of job which put in job queue since dispatcher start.
@@ -230,11 +866,55 @@ func (d *Dispatcher) GetTotalRefusedTask() uint64 {
 	return atomic.LoadUint64(&(d.totalRefusedTask))
 }
 
-// GetState get dispatcher state.
+// GetCurrentRunningNum get current job number dispatched to worker and not finished.
+func (d *Dispatcher) GetCurrentRunningNum() int {
+	return int(atomic.LoadInt64(&(d.activeNum)))
+}
+
+// GetTotalRetryTask get total number of retry attempts since dispatcher start.
+func (d *Dispatcher) GetTotalRetryTask() uint64 {
+	return atomic.LoadUint64(&(d.totalRetryTask))
+}
+
+// GetCurrentRetryingNum get current job number wait backoff to retry.
+func (d *Dispatcher) GetCurrentRetryingNum() int {
+	return int(atomic.LoadInt64(&(d.retryingNum)))
+}
+
+// GetState get dispatcher state, the busiest state of all lanes.
 func (d *Dispatcher) GetState() State {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
 	return d.state
 }
 
+// GetLaneStatus get status of a lane.
+func (d *Dispatcher) GetLaneStatus(name string) (LaneStatus, error) {
+	l, err := d.getLane(name)
+	if err != nil {
+		return LaneStatus{}, err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return l.status(), nil
+}
+
+// GetLanesStatus get status of all lanes.
+func (d *Dispatcher) GetLanesStatus() []LaneStatus {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	list := make([]LaneStatus, 0, len(d.lanes))
+	for _, l := range d.lanes {
+		list = append(list, l.status())
+	}
+
+	return list
+}
+
 // IsStop is dispatcher has stop.
 func (d *Dispatcher) IsStop() bool {
 	return d.getStopFlag()
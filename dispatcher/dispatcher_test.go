@@ -0,0 +1,1363 @@
+package dispatcher_test
+
+/*
+ * go test -v dispatcher_test.go
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+)
+
+// waitFor wait until cond is true, fail test if it is not true in 5s.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(time.Duration(5) * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("wait %s timeout", what)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// shutdown dispatcher at the end of test, tasks still running after 1s are cancelled.
+func shutdown(d *dispatcher.Dispatcher) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_ = d.Shutdown(ctx)
+}
+
+func TestLaneWeight(t *testing.T) {
+	var mutex sync.Mutex
+	var order []string
+	block := make(chan struct{})
+
+	c := dispatcher.Config{
+		Name:         "lane",
+		MaxWorkerNum: 1,
+		Lanes: []dispatcher.LaneConfig{
+			{Name: "high", Weight: 3},
+			{Name: "low", Weight: 1},
+		},
+	}
+
+	d := dispatcher.GetDispatch(c, func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+		if task.InData.TaskUID == "block" {
+			<-block
+			return nil
+		}
+
+		mutex.Lock()
+		order = append(order, task.Lane)
+		mutex.Unlock()
+
+		task.OutCh <- dispatcher.OutData{}
+		return nil
+	}, nil)
+	defer shutdown(d)
+
+	err := d.AddTask(dispatcher.Task{InData: dispatcher.InData{TaskUID: "block"}, Lane: "high"})
+	if err != nil {
+		t.Fatalf("add task error = %s", err)
+	}
+
+	waitFor(t, "workers busy", func() bool {
+		return d.GetCurrentFreeWorkerNum() == 0 && d.GetCurrentTaskTodoNum() == 0
+	})
+
+	out := make(chan dispatcher.OutData, 8)
+	for i := 0; i < 4; i++ {
+		for _, name := range []string{"low", "high"} {
+			err = d.AddTask(dispatcher.Task{InData: dispatcher.InData{TaskUID: name}, Lane: name, OutCh: out})
+			if err != nil {
+				t.Fatalf("add task error = %s", err)
+			}
+		}
+	}
+
+	err = d.AddTask(dispatcher.Task{Lane: "unknown"})
+	if err != dispatcher.ErrorOfLaneNotExist {
+		t.Fatalf("add task to unknown lane error = %v", err)
+	}
+
+	close(block)
+	for i := 0; i < 8; i++ {
+		<-out
+	}
+
+	expect := []string{"high", "high", "low", "high"}
+	for i, name := range expect {
+		if order[i] != name {
+			t.Fatalf("task order = %v, expect prefix %v", order, expect)
+		}
+	}
+
+	ls, err := d.GetLaneStatus("high")
+	if err != nil {
+		t.Fatalf("get lane status error = %s", err)
+	}
+
+	if ls.TotalInTask != 5 || ls.TotalDoneTask != 5 {
+		t.Fatalf("high lane status = %+v", ls)
+	}
+}
+
+func TestLaneDeny(t *testing.T) {
+	block := make(chan struct{})
+
+	c := dispatcher.Config{
+		Name:         "deny",
+		MaxWorkerNum: 1,
+		Lanes: []dispatcher.LaneConfig{
+			{Name: "small", MaxTaskNum: 10},
+			{Name: "large", MaxTaskNum: 100},
+		},
+	}
+
+	d := dispatcher.GetDispatch(c, func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+		<-block
+		return nil
+	}, nil)
+	defer shutdown(d)
+	defer close(block)
+
+	var refused int
+	for i := 0; i < 20; i++ {
+		if d.AddTask(dispatcher.Task{Lane: "small"}) != nil {
+			refused++
+		}
+	}
+
+	if refused == 0 {
+		t.Fatalf("small lane should refuse tasks")
+	}
+
+	if err := d.AddTask(dispatcher.Task{Lane: "large"}); err != nil {
+		t.Fatalf("large lane should accept task, error = %s", err)
+	}
+
+	ls, _ := d.GetLaneStatus("small")
+	if ls.State != dispatcher.StateOfDeny || ls.TotalRefusedTask != uint64(refused) {
+		t.Fatalf("small lane status = %+v", ls)
+	}
+}
+
+func TestRetryAndDeadLetter(t *testing.T) {
+	errTemporary := errors.New("temporary")
+	errFatal := errors.New("fatal")
+
+	dead := dispatcher.NewDeadLetterQueue(10)
+	c := dispatcher.Config{
+		Name:         "retry",
+		MaxWorkerNum: 2,
+		Retry: &dispatcher.RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			Retryable: func(err error) bool {
+				return err == errTemporary
+			},
+		},
+		DeadLetter: dead,
+	}
+
+	d := dispatcher.GetDispatch(c, func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+		switch task.InData.TaskUID {
+		case "flaky":
+			if task.Attempt < 2 {
+				return errTemporary
+			}
+		case "broken":
+			return errTemporary
+		case "fatal":
+			return errFatal
+		}
+
+		task.Reply(dispatcher.OutData{Code: 200})
+		return nil
+	}, nil)
+	defer shutdown(d)
+
+	expect := map[string]int{"flaky": 2, "broken": 3, "fatal": 1}
+	for uid, attempts := range expect {
+		out := make(chan dispatcher.OutData, 1)
+		err := d.AddTask(dispatcher.Task{InData: dispatcher.InData{TaskUID: uid}, OutCh: out})
+		if err != nil {
+			t.Fatalf("add task error = %s", err)
+		}
+
+		result := <-out
+		if result.Attempts != attempts {
+			t.Fatalf("task = %s attempts = %d, expect %d", uid, result.Attempts, attempts)
+		}
+	}
+
+	if d.GetTotalDoneTask() != 1 || d.GetTotalErrorTask() != 2 || d.GetTotalRetryTask() != 3 {
+		t.Fatalf("done = %d, error = %d, retry = %d", d.GetTotalDoneTask(), d.GetTotalErrorTask(), d.GetTotalRetryTask())
+	}
+
+	letters := dead.Drain()
+	if len(letters) != 2 {
+		t.Fatalf("dead letters = %d, expect 2", len(letters))
+	}
+
+	for _, dl := range letters {
+		dead.Put(dl)
+	}
+
+	num, err := dead.Replay(d)
+	if err != nil || num != 2 {
+		t.Fatalf("replay num = %d, error = %v", num, err)
+	}
+}
+
+type countResource struct {
+	released *int32
+}
+
+func (r countResource) Check(ctx context.Context) (dispatcher.Resource, error) {
+	return r, nil
+}
+
+func (r countResource) Release() error {
+	atomic.AddInt32(r.released, 1)
+	return nil
+}
+
+func TestElasticWorker(t *testing.T) {
+	var released int32
+	block := make(chan struct{})
+
+	c := dispatcher.Config{
+		Name:         "elastic",
+		MinWorkerNum: 1,
+		MaxWorkerNum: 4,
+		IdleTimeout:  time.Duration(50) * time.Millisecond,
+		NewResource: func() (dispatcher.Resource, error) {
+			return countResource{released: &released}, nil
+		},
+	}
+
+	d := dispatcher.GetDispatch(c, func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+		<-block
+		task.Reply(dispatcher.OutData{})
+		return nil
+	}, nil)
+	defer shutdown(d)
+
+	if d.GetTotalWorkNum() != 1 {
+		t.Fatalf("worker number = %d, expect 1", d.GetTotalWorkNum())
+	}
+
+	out := make(chan dispatcher.OutData, 4)
+	for i := 0; i < 4; i++ {
+		err := d.AddTask(dispatcher.Task{OutCh: out})
+		if err != nil {
+			t.Fatalf("add task error = %s", err)
+		}
+	}
+
+	waitFor(t, "queue empty", func() bool { return d.GetCurrentTaskTodoNum() == 0 })
+
+	if d.GetTotalWorkNum() != 4 || d.GetTotalScaleUp() != 4 {
+		t.Fatalf("worker number = %d, scale up = %d, expect 4", d.GetTotalWorkNum(), d.GetTotalScaleUp())
+	}
+
+	close(block)
+	for i := 0; i < 4; i++ {
+		<-out
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for (d.GetTotalWorkNum() != 1 || atomic.LoadInt32(&released) != 3) && time.Now().Before(deadline) {
+		time.Sleep(time.Duration(10) * time.Millisecond)
+	}
+
+	if d.GetTotalWorkNum() != 1 || d.GetTotalScaleDown() != 3 || atomic.LoadInt32(&released) != 3 {
+		t.Fatalf("worker number = %d, scale down = %d, released = %d",
+			d.GetTotalWorkNum(), d.GetTotalScaleDown(), atomic.LoadInt32(&released))
+	}
+}
+
+func TestDelayedTask(t *testing.T) {
+	out := make(chan dispatcher.OutData, 2)
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "delay"},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			task.Reply(dispatcher.OutData{Data: []byte(task.InData.TaskUID)})
+			return nil
+		}, nil)
+	defer shutdown(d)
+
+	now := time.Now()
+	for _, uid := range []string{"late", "early", "cancel"} {
+		at := now.Add(time.Duration(20) * time.Millisecond)
+		if uid == "late" {
+			at = now.Add(time.Duration(60) * time.Millisecond)
+		}
+
+		err := d.AddDelayedTask(dispatcher.Task{InData: dispatcher.InData{TaskUID: uid}, OutCh: out}, at)
+		if err != nil {
+			t.Fatalf("add delayed task error = %s", err)
+		}
+	}
+
+	if d.AddDelayedTask(dispatcher.Task{InData: dispatcher.InData{TaskUID: "late"}}, now) != dispatcher.ErrorOfScheduleExist {
+		t.Fatalf("duplicate task uid should be refused")
+	}
+
+	if !d.CancelScheduled("cancel") || d.CancelScheduled("cancel") {
+		t.Fatalf("cancel scheduled task failed")
+	}
+
+	for _, expect := range []string{"early", "late"} {
+		result := <-out
+		if string(result.Data) != expect {
+			t.Fatalf("task = %s, expect %s", result.Data, expect)
+		}
+	}
+
+	if time.Since(now) < time.Duration(60)*time.Millisecond {
+		t.Fatalf("delayed task run too early")
+	}
+
+	if d.GetCurrentScheduledNum() != 0 || d.GetTotalInTask() != 2 {
+		t.Fatalf("scheduled = %d, in = %d", d.GetCurrentScheduledNum(), d.GetTotalInTask())
+	}
+}
+
+func TestDelayedTaskEmptyUID(t *testing.T) {
+	out := make(chan dispatcher.OutData, 2)
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "delay-empty"},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			task.Reply(dispatcher.OutData{Data: task.InData.Data})
+			return nil
+		}, nil)
+	defer shutdown(d)
+
+	// tasks without uid are not refused as duplicate
+	at := time.Now().Add(time.Duration(20) * time.Millisecond)
+	for _, data := range []string{"a", "b"} {
+		err := d.AddDelayedTask(dispatcher.Task{InData: dispatcher.InData{Data: []byte(data)}, OutCh: out}, at)
+		if err != nil {
+			t.Fatalf("add delayed task error = %s", err)
+		}
+	}
+
+	if d.GetCurrentScheduledNum() != 2 {
+		t.Fatalf("scheduled = %d, expect 2", d.GetCurrentScheduledNum())
+	}
+
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		got[string((<-out).Data)] = true
+	}
+
+	if !got["a"] || !got["b"] || d.GetCurrentScheduledNum() != 0 {
+		t.Fatalf("tasks = %v, scheduled = %d", got, d.GetCurrentScheduledNum())
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	var released int32
+
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "shutdown", MaxWorkerNum: 2},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			time.Sleep(time.Duration(5) * time.Millisecond)
+			return nil
+		}, countResource{released: &released})
+
+	for i := 0; i < 10; i++ {
+		err := d.AddTask(dispatcher.Task{})
+		if err != nil {
+			t.Fatalf("add task error = %s", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := d.Shutdown(ctx)
+	if err != nil {
+		t.Fatalf("shutdown error = %s", err)
+	}
+
+	if d.GetTotalDoneTask() != 10 || atomic.LoadInt32(&released) != 2 || d.GetTotalWorkNum() != 0 {
+		t.Fatalf("done = %d, released = %d, workers = %d", d.GetTotalDoneTask(), released, d.GetTotalWorkNum())
+	}
+
+	if d.AddTask(dispatcher.Task{}) != dispatcher.ErrorOfDispatcherHasStop {
+		t.Fatalf("add task after shutdown should fail")
+	}
+
+	if d.Shutdown(ctx) != dispatcher.ErrorOfDispatcherHasStop {
+		t.Fatalf("shutdown twice should fail")
+	}
+}
+
+func TestShutdownAbandon(t *testing.T) {
+	cancelled := make(chan string, 1)
+
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "abandon", MaxWorkerNum: 1},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			<-ctx.Done()
+			cancelled <- task.InData.TaskUID
+			return ctx.Err()
+		}, nil)
+
+	// only queued task has reply channel, workDo never reply
+	out := make(chan dispatcher.OutData, 1)
+	for _, uid := range []string{"running", "queued"} {
+		task := dispatcher.Task{InData: dispatcher.InData{TaskUID: uid}, TimeOut: 60 * 1000}
+		if uid == "queued" {
+			task.OutCh = out
+		}
+
+		if err := d.AddTask(task); err != nil {
+			t.Fatalf("add task error = %s", err)
+		}
+	}
+
+	waitFor(t, "task running", func() bool { return d.GetCurrentRunningNum() == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(20)*time.Millisecond)
+	defer cancel()
+
+	err := d.Shutdown(ctx)
+
+	var shutdownErr *dispatcher.ShutdownError
+	if !errors.As(err, &shutdownErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown error = %v", err)
+	}
+
+	if len(shutdownErr.Abandoned) != 2 {
+		t.Fatalf("abandoned = %v", shutdownErr.Abandoned)
+	}
+
+	if uid := <-cancelled; uid != "running" {
+		t.Fatalf("cancelled task = %s", uid)
+	}
+
+	// queued task is replied when dropped
+	select {
+	case o := <-out:
+		if o.Err != dispatcher.ErrorOfTaskCancelled {
+			t.Fatalf("queued task out error = %v", o.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("queued task not replied")
+	}
+}
+
+func TestShutdownAbandonAssigned(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		d := dispatcher.GetDispatch(dispatcher.Config{Name: "abandon-assigned", MaxWorkerNum: 16, MaxTaskNum: 1000},
+			func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+				task.Reply(dispatcher.OutData{})
+				return nil
+			}, nil)
+
+		var handles []*dispatcher.Handle
+		for j := 0; j < 500; j++ {
+			h, err := d.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: strconv.Itoa(j)}})
+			if err != nil {
+				t.Fatalf("submit error = %s", err)
+			}
+
+			handles = append(handles, h)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i%5)*100*time.Microsecond)
+
+		var abandoned []string
+		var shutdownErr *dispatcher.ShutdownError
+		if err := d.Shutdown(ctx); errors.As(err, &shutdownErr) {
+			abandoned = shutdownErr.Abandoned
+		}
+		cancel()
+
+		// every task popped from queue is operated or abandoned
+		waitCtx, waitCancel := context.WithTimeout(context.Background(), 3*time.Second)
+		cancelled := 0
+		for _, h := range handles {
+			out, err := h.Wait(waitCtx)
+			if err != nil {
+				waitCancel()
+				t.Fatalf("wait task = %s error = %s", h.TaskUID(), err)
+			}
+
+			if out.Err == dispatcher.ErrorOfTaskCancelled {
+				cancelled++
+			}
+		}
+		waitCancel()
+
+		if cancelled > len(abandoned) {
+			t.Fatalf("cancelled = %d, abandoned = %d", cancelled, len(abandoned))
+		}
+	}
+}
+
+func TestShutdownAbandonRetrying(t *testing.T) {
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "abandon-retry", MaxWorkerNum: 1,
+		Retry: &dispatcher.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute}},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			return errors.New("fail")
+		}, nil)
+
+	h, err := d.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: "retrying"}})
+	if err != nil {
+		t.Fatalf("submit error = %s", err)
+	}
+
+	waitFor(t, "task retrying", func() bool { return d.GetCurrentRetryingNum() == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(20)*time.Millisecond)
+	defer cancel()
+
+	var shutdownErr *dispatcher.ShutdownError
+	if err = d.Shutdown(ctx); !errors.As(err, &shutdownErr) || len(shutdownErr.Abandoned) != 1 ||
+		shutdownErr.Abandoned[0] != "retrying" {
+		t.Fatalf("shutdown error = %v", err)
+	}
+
+	select {
+	case <-h.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("retrying task not finished after shutdown")
+	}
+
+	if h.Status() != dispatcher.TaskStatusCancelled || d.GetCurrentRetryingNum() != 0 {
+		t.Fatalf("status = %s, retrying = %d", h.Status(), d.GetCurrentRetryingNum())
+	}
+}
+
+func TestTaskHandle(t *testing.T) {
+	started := make(chan struct{})
+
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "handle", MaxWorkerNum: 1},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			if task.InData.TaskUID == "running" {
+				close(started)
+				<-ctx.Done()
+				return ctx.Err()
+			}
+
+			task.Reply(dispatcher.OutData{Data: task.InData.Data})
+			return nil
+		}, nil)
+	defer shutdown(d)
+
+	running, err := d.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: "running"}, TimeOut: 60 * 1000})
+	if err != nil {
+		t.Fatalf("submit error = %s", err)
+	}
+
+	queued, _ := d.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: "queued"}})
+	done, _ := d.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: "done", Data: []byte("ok")}})
+
+	<-started
+	if running.Status() != dispatcher.TaskStatusRunning || queued.Status() != dispatcher.TaskStatusQueued {
+		t.Fatalf("running status = %s, queued status = %s", running.Status(), queued.Status())
+	}
+
+	if !d.CancelTask("queued") || queued.Status() != dispatcher.TaskStatusCancelled {
+		t.Fatalf("cancel queued task failed, status = %s", queued.Status())
+	}
+
+	h, ok := d.GetHandle("running")
+	if !ok || !h.Cancel() || h.Cancel() {
+		t.Fatalf("cancel running task failed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	out, err := running.Wait(ctx)
+	if err != nil || out.Err != dispatcher.ErrorOfTaskCancelled || running.Status() != dispatcher.TaskStatusCancelled {
+		t.Fatalf("wait running task out = %+v, error = %v, status = %s", out, err, running.Status())
+	}
+
+	out, err = done.Wait(ctx)
+	if err != nil || string(out.Data) != "ok" || out.Attempts != 1 || done.Status() != dispatcher.TaskStatusDone {
+		t.Fatalf("wait done task out = %+v, error = %v, status = %s", out, err, done.Status())
+	}
+
+	if _, ok = d.GetHandle("done"); ok {
+		t.Fatalf("finished task should be removed from registry")
+	}
+
+	if d.GetTotalCancelTask() != 2 || d.GetTotalDoneTask() != 1 {
+		t.Fatalf("cancel = %d, done = %d", d.GetTotalCancelTask(), d.GetTotalDoneTask())
+	}
+}
+
+func TestDedup(t *testing.T) {
+	release := make(chan struct{})
+	var runNum int32
+
+	workDo := func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+		atomic.AddInt32(&runNum, 1)
+		<-release
+
+		task.Reply(dispatcher.OutData{Data: task.InData.Data})
+		return nil
+	}
+
+	reject := dispatcher.GetDispatch(dispatcher.Config{Name: "reject", MaxWorkerNum: 1,
+		Dedup: dispatcher.DedupReject}, workDo, nil)
+	defer shutdown(reject)
+
+	first, err := reject.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: "a"}})
+	if err != nil {
+		t.Fatalf("submit error = %s", err)
+	}
+
+	_, err = reject.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: "a"}})
+	var dupErr *dispatcher.DuplicateTaskError
+	if !errors.As(err, &dupErr) || dupErr.TaskUID != "a" || reject.GetTotalDuplicateTask() != 1 {
+		t.Fatalf("duplicate task error = %v", err)
+	}
+
+	coalesce := dispatcher.GetDispatch(dispatcher.Config{Name: "coalesce", MaxWorkerNum: 1,
+		Dedup: dispatcher.DedupCoalesce, DedupWindow: time.Minute}, workDo, nil)
+	defer shutdown(coalesce)
+
+	outs := make([]chan dispatcher.OutData, 3)
+	for i := range outs {
+		outs[i] = make(chan dispatcher.OutData, 1)
+	}
+
+	// a subscriber never read out chan should not block worker
+	stuck := make(chan dispatcher.OutData)
+	for _, ch := range append(outs[:2:2], stuck) {
+		_, err = coalesce.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: "b", Data: []byte("ok")}, OutCh: ch})
+		if err != nil {
+			t.Fatalf("submit error = %s", err)
+		}
+	}
+
+	close(release)
+
+	for i, ch := range outs[:2] {
+		out := <-ch
+		if string(out.Data) != "ok" {
+			t.Fatalf("out %d = %+v", i, out)
+		}
+	}
+
+	// finished task is remembered in window
+	h, err := coalesce.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: "b"}, OutCh: outs[2]})
+	if err != nil || h.Status() != dispatcher.TaskStatusDone {
+		t.Fatalf("submit recent task error = %v", err)
+	}
+
+	if out := <-outs[2]; string(out.Data) != "ok" {
+		t.Fatalf("recent out = %+v", out)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	first.Wait(ctx)
+
+	if atomic.LoadInt32(&runNum) != 2 || coalesce.GetTotalCoalescedTask() != 3 {
+		t.Fatalf("run = %d, coalesced = %d", runNum, coalesce.GetTotalCoalescedTask())
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	var mutex sync.Mutex
+	running := make(map[string]int)
+	maxRunning := make(map[string]int)
+
+	c := dispatcher.Config{
+		Name:             "limit",
+		MaxWorkerNum:     4,
+		RateLimit:        &dispatcher.RateLimit{Rate: 50, Burst: 2},
+		LimitKey:         func(in dispatcher.InData) string { return string(in.Data) },
+		MaxKeyRunningNum: 1,
+	}
+
+	d := dispatcher.GetDispatch(c, func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+		key := string(task.InData.Data)
+
+		mutex.Lock()
+		running[key]++
+		if running[key] > maxRunning[key] {
+			maxRunning[key] = running[key]
+		}
+		mutex.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mutex.Lock()
+		running[key]--
+		mutex.Unlock()
+
+		task.Reply(dispatcher.OutData{})
+		return nil
+	}, nil)
+	defer shutdown(d)
+
+	begin := time.Now()
+
+	var handles []*dispatcher.Handle
+	for i := 0; i < 12; i++ {
+		key := "a"
+		if i%3 == 0 {
+			key = "b"
+		}
+
+		h, err := d.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: strconv.Itoa(i), Data: []byte(key)}})
+		if err != nil {
+			t.Fatalf("submit error = %s", err)
+		}
+
+		handles = append(handles, h)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, h := range handles {
+		if _, err := h.Wait(ctx); err != nil {
+			t.Fatalf("wait task = %s error = %s", h.TaskUID(), err)
+		}
+	}
+
+	// 2 tasks in burst, others start by 50 per second
+	if cost := time.Since(begin); cost < 180*time.Millisecond {
+		t.Fatalf("rate limit not work, cost = %s", cost)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if maxRunning["a"] != 1 || maxRunning["b"] != 1 {
+		t.Fatalf("max running of key = %v", maxRunning)
+	}
+}
+
+func TestKeyLimitBacklog(t *testing.T) {
+	release := make(chan struct{})
+	c := dispatcher.Config{
+		Name:             "backlog",
+		MaxWorkerNum:     4,
+		MaxTaskNum:       2000,
+		LimitKey:         func(in dispatcher.InData) string { return string(in.Data) },
+		MaxKeyRunningNum: 1,
+	}
+
+	d := dispatcher.GetDispatch(c, func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+		if string(task.InData.Data) == "hot" {
+			<-release
+		}
+
+		task.Reply(dispatcher.OutData{})
+		return nil
+	}, nil)
+	defer d.Shutdown(context.Background())
+
+	submit := func(uid string, key string) *dispatcher.Handle {
+		h, err := d.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: uid, Data: []byte(key)}})
+		if err != nil {
+			t.Fatalf("submit task = %s error = %s", uid, err)
+		}
+
+		return h
+	}
+
+	var hot []*dispatcher.Handle
+	for i := 0; i < 500; i++ {
+		hot = append(hot, submit("hot-"+strconv.Itoa(i), "hot"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// tasks of other keys pushed behind blocked ones still start
+	for i := 0; i < 500; i++ {
+		uid := "cold-" + strconv.Itoa(i)
+		if _, err := submit(uid, uid).Wait(ctx); err != nil {
+			t.Fatalf("wait task = %s error = %s", uid, err)
+		}
+
+		if i%100 == 0 {
+			submit("hot-more-"+strconv.Itoa(i), "hot")
+		}
+	}
+
+	close(release)
+
+	for _, h := range hot {
+		if _, err := h.Wait(ctx); err != nil {
+			t.Fatalf("wait task = %s error = %s", h.TaskUID(), err)
+		}
+	}
+}
+
+func TestPanic(t *testing.T) {
+	var mutex sync.Mutex
+	var warns []string
+	logger := func(format string, v ...interface{}) {
+		mutex.Lock()
+		warns = append(warns, fmt.Sprintf(format, v...))
+		mutex.Unlock()
+	}
+
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "panic", MaxWorkerNum: 1, Logger: logger},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			if task.InData.TaskUID == "panic" {
+				panic("boom")
+			}
+
+			task.OutCh <- dispatcher.OutData{}
+			return nil
+		}, nil)
+	defer shutdown(d)
+
+	out := make(chan dispatcher.OutData, 1)
+	for _, uid := range []string{"panic", "ok"} {
+		err := d.AddTask(dispatcher.Task{InData: dispatcher.InData{TaskUID: uid}, OutCh: out})
+		if err != nil {
+			t.Fatalf("add task error = %s", err)
+		}
+
+		select {
+		case o := <-out:
+			var panicErr *dispatcher.PanicError
+			if (uid == "panic") != errors.As(o.Err, &panicErr) {
+				t.Fatalf("task = %s out error = %v", uid, o.Err)
+			}
+
+			if panicErr != nil && (panicErr.Value != "boom" || !strings.Contains(string(panicErr.Stack), "TestPanic")) {
+				t.Fatalf("panic value = %v, stack = %s", panicErr.Value, panicErr.Stack)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("task = %s not finished, worker may die", uid)
+		}
+	}
+
+	if d.GetTotalPanicTask() != 1 || d.GetTotalWorkNum() != 1 || d.GetTotalScaleUp() != 2 {
+		t.Fatalf("panic = %d, workers = %d, scale up = %d",
+			d.GetTotalPanicTask(), d.GetTotalWorkNum(), d.GetTotalScaleUp())
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(warns) != 1 || !strings.Contains(warns[0], "task = panic panic : boom") {
+		t.Fatalf("warnings = %q", warns)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var mutex sync.Mutex
+	var sizes []int
+
+	c := dispatcher.Config{Name: "batch", MaxWorkerNum: 1, BatchSize: 4, BatchLinger: 50 * time.Millisecond}
+	d := dispatcher.GetBatchDispatch(c, func(ctx context.Context, res dispatcher.Resource,
+		tasks []dispatcher.Task) []dispatcher.OutData {
+		mutex.Lock()
+		sizes = append(sizes, len(tasks))
+		mutex.Unlock()
+
+		outs := make([]dispatcher.OutData, len(tasks))
+		for i, task := range tasks {
+			outs[i].Data = task.InData.Data
+			if task.InData.TaskUID == "3" {
+				outs[i].Err = errors.New("bad task")
+			}
+		}
+
+		return outs
+	}, nil)
+
+	outs := make([]chan dispatcher.OutData, 6)
+	for i := range outs {
+		outs[i] = make(chan dispatcher.OutData, 1)
+
+		uid := strconv.Itoa(i)
+		err := d.AddTask(dispatcher.Task{InData: dispatcher.InData{TaskUID: uid, Data: []byte(uid)}, OutCh: outs[i]})
+		if err != nil {
+			t.Fatalf("add task error = %s", err)
+		}
+	}
+
+	for i, ch := range outs {
+		out := <-ch
+		if (i == 3) != (out.Err != nil) || (i != 3 && string(out.Data) != strconv.Itoa(i)) {
+			t.Fatalf("task = %d out = %+v", i, out)
+		}
+	}
+
+	// counters are updated after reply
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown error = %s", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(sizes) != 2 || sizes[0] != 4 || sizes[1] != 2 {
+		t.Fatalf("batch sizes = %v", sizes)
+	}
+
+	if d.GetTotalDoneTask() != 5 || d.GetTotalErrorTask() != 1 {
+		t.Fatalf("done = %d, error = %d", d.GetTotalDoneTask(), d.GetTotalErrorTask())
+	}
+}
+
+type poolResource struct {
+	id       int
+	broken   *int32
+	released *int32
+}
+
+func (r *poolResource) Check(ctx context.Context) (dispatcher.Resource, error) {
+	if atomic.LoadInt32(r.broken) == int32(r.id) {
+		return nil, errors.New("broken")
+	}
+
+	return r, nil
+}
+
+func (r *poolResource) Release() error {
+	atomic.AddInt32(r.released, 1)
+	return nil
+}
+
+func TestResourcePool(t *testing.T) {
+	var seq, released int32
+	broken := int32(-1)
+
+	pool, err := dispatcher.NewResourcePool(dispatcher.PoolConfig{
+		Name:           "pool",
+		MinSize:        1,
+		MaxSize:        2,
+		CheckPeriod:    20 * time.Millisecond,
+		AcquireTimeout: 20 * time.Millisecond,
+		New: func() (dispatcher.Resource, error) {
+			return &poolResource{id: int(atomic.AddInt32(&seq, 1)), broken: &broken, released: &released}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("create pool error = %s", err)
+	}
+	defer pool.Close()
+
+	ctx := context.Background()
+	r1, _ := pool.Acquire(ctx)
+	r2, _ := pool.Acquire(ctx)
+	if _, err = pool.Acquire(ctx); err != dispatcher.ErrorOfPoolAcquireTimeout {
+		t.Fatalf("acquire from full pool error = %v", err)
+	}
+
+	pool.Put(r1)
+	pool.Put(r2)
+
+	// broken resource is evicted by health check
+	atomic.StoreInt32(&broken, int32(r1.(*poolResource).id))
+	waitFor(t, "broken resource evicted", func() bool { return pool.Stats().TotalEvicted != 0 })
+
+	if s := pool.Stats(); s.Size != 1 || s.TotalTimeout != 1 || atomic.LoadInt32(&released) != 1 {
+		t.Fatalf("pool stats = %+v, released = %d", s, released)
+	}
+
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "pool", MaxWorkerNum: 4, ResourcePool: pool},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			if res == nil || res.(*poolResource).id == int(atomic.LoadInt32(&broken)) {
+				return errors.New("invalid resource")
+			}
+
+			time.Sleep(5 * time.Millisecond)
+			task.Reply(dispatcher.OutData{})
+			return nil
+		}, nil)
+	defer shutdown(d)
+
+	var handles []*dispatcher.Handle
+	for i := 0; i < 8; i++ {
+		h, err := d.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: strconv.Itoa(i)}})
+		if err != nil {
+			t.Fatalf("submit error = %s", err)
+		}
+
+		handles = append(handles, h)
+	}
+
+	for _, h := range handles {
+		out, err := h.Wait(ctx)
+		if err != nil || out.Err != nil {
+			t.Fatalf("task = %s out = %+v, error = %v", h.TaskUID(), out, err)
+		}
+	}
+
+	if s := pool.Stats(); s.Size > 2 || s.InUse != 0 {
+		t.Fatalf("pool stats = %+v", s)
+	}
+}
+
+// renewResource replace itself by a new one when checked.
+type renewResource struct {
+	released *int32
+}
+
+func (r *renewResource) Check(ctx context.Context) (dispatcher.Resource, error) {
+	return &renewResource{released: r.released}, nil
+}
+
+func (r *renewResource) Release() error {
+	atomic.AddInt32(r.released, 1)
+	return nil
+}
+
+func TestResourcePoolRenew(t *testing.T) {
+	var released int32
+
+	pool, err := dispatcher.NewResourcePool(dispatcher.PoolConfig{
+		Name:        "renew",
+		MinSize:     1,
+		CheckPeriod: 5 * time.Millisecond,
+		New: func() (dispatcher.Resource, error) {
+			return &renewResource{released: &released}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("create pool error = %s", err)
+	}
+
+	// replaced resources are released by pool
+	waitFor(t, "replaced resource released", func() bool { return atomic.LoadInt32(&released) >= 2 })
+
+	pool.Close()
+
+	if s := pool.Stats(); s.Size != 0 || s.TotalCreated != 1 {
+		t.Fatalf("pool stats = %+v", s)
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	block := make(chan struct{})
+	changes := make(chan dispatcher.State, 8)
+
+	aimd := dispatcher.NewAIMDAdmission(dispatcher.AIMDConfig{MinLimit: 1, InitialLimit: 2, Latency: time.Second})
+
+	c := dispatcher.Config{
+		Name:         "admission",
+		MaxWorkerNum: 1,
+		Admission:    aimd,
+		OnStateChange: func(old dispatcher.State, new dispatcher.State) {
+			changes <- new
+		},
+	}
+
+	d := dispatcher.GetDispatch(c, func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+		<-block
+		return errors.New("overload")
+	}, nil)
+
+	for i := 0; i < 2; i++ {
+		if err := d.AddTask(dispatcher.Task{InData: dispatcher.InData{TaskUID: strconv.Itoa(i)}}); err != nil {
+			t.Fatalf("add task error = %s", err)
+		}
+	}
+
+	err := d.AddTask(dispatcher.Task{InData: dispatcher.InData{TaskUID: "refused"}})
+
+	var admissionErr *dispatcher.AdmissionError
+	if !errors.As(err, &admissionErr) || admissionErr.State != dispatcher.StateOfDeny || admissionErr.RetryAfter <= 0 {
+		t.Fatalf("admission error = %v", err)
+	}
+
+	close(block)
+	if err = d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown error = %s", err)
+	}
+
+	// errors decrease limit
+	if aimd.GetLimit() != 1 {
+		t.Fatalf("aimd limit = %d", aimd.GetLimit())
+	}
+
+	var last dispatcher.State
+	for len(changes) > 0 {
+		last = <-changes
+	}
+
+	if last != dispatcher.StateOfDeny {
+		t.Fatalf("last state change = %d", last)
+	}
+
+	codel := dispatcher.NewCoDelAdmission(time.Millisecond, 20*time.Millisecond)
+	stats := dispatcher.AdmissionStats{LaneTodoNum: 1, LaneMaxNum: 100, LaneHeadWait: 10 * time.Millisecond}
+	now := time.Unix(1, 0)
+	if state, _ := codel.Admit(now, stats); state != dispatcher.StateOfBusy {
+		t.Fatalf("codel state = %d", state)
+	}
+
+	if state, _ := codel.Admit(now.Add(19*time.Millisecond), stats); state != dispatcher.StateOfBusy {
+		t.Fatalf("codel state = %d", state)
+	}
+
+	now = now.Add(20 * time.Millisecond)
+	if state, retryAfter := codel.Admit(now, stats); state != dispatcher.StateOfDeny || retryAfter <= 0 {
+		t.Fatalf("codel state = %d, retry after = %s", state, retryAfter)
+	}
+
+	codel.Observe(now, 0, time.Millisecond, nil)
+	stats.LaneHeadWait = 0
+	if state, _ := codel.Admit(now, stats); state != dispatcher.StateOfNormal {
+		t.Fatalf("codel state = %d", state)
+	}
+}
+
+func TestExporter(t *testing.T) {
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: `metric"s`, MaxWorkerNum: 1},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			time.Sleep(time.Duration(2) * time.Millisecond)
+			return nil
+		}, nil)
+
+	for i := 0; i < 3; i++ {
+		h, err := d.Submit(dispatcher.Task{})
+		if err != nil {
+			t.Fatalf("submit error = %s", err)
+		}
+
+		<-h.Done()
+	}
+
+	// wait workers observe task time
+	err := d.Shutdown(context.Background())
+	if err != nil {
+		t.Fatalf("shutdown error = %s", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	dispatcher.NewExporter(d).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := recorder.Body.String()
+	for _, line := range []string{
+		"# TYPE dispatcher_tasks_done_total counter",
+		`dispatcher_tasks_done_total{dispatcher="metric\"s",lane="default"} 3`,
+		`dispatcher_workers{dispatcher="metric\"s"} 0`,
+		"# TYPE dispatcher_task_run_seconds histogram",
+		`dispatcher_task_run_seconds_bucket{dispatcher="metric\"s",le="0.001"} 0`,
+		`dispatcher_task_run_seconds_bucket{dispatcher="metric\"s",le="+Inf"} 3`,
+		`dispatcher_task_wait_seconds_count{dispatcher="metric\"s"} 3`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("metrics miss line %s\n%s", line, body)
+		}
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	var running, done int32
+	block := make(chan struct{})
+
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "resize", MaxWorkerNum: 1},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			atomic.AddInt32(&running, 1)
+			<-block
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&done, 1)
+			return nil
+		}, nil)
+
+	// paused dispatcher still accept tasks
+	d.Pause()
+	for i := 0; i < 3; i++ {
+		if err := d.AddTask(dispatcher.Task{InData: dispatcher.InData{TaskUID: strconv.Itoa(i)}, TimeOut: 60 * 1000}); err != nil {
+			t.Fatalf("add task error = %s", err)
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&running) != 0 {
+		t.Fatalf("paused dispatcher run tasks")
+	}
+
+	d.Resume()
+	waitFor(t, "task running", func() bool { return atomic.LoadInt32(&running) == 1 })
+
+	admin := httptest.NewServer(d.AdminHandler())
+	defer admin.Close()
+
+	resp, err := http.Post(admin.URL, "application/json", strings.NewReader(`{"maxWorkerNum":3}`))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("post command error = %v, resp = %+v", err, resp)
+	}
+	resp.Body.Close()
+
+	waitFor(t, "tasks running", func() bool { return atomic.LoadInt32(&running) == 3 })
+
+	resp, err = http.Post(admin.URL, "application/json", strings.NewReader(`{"maxWorkerNum":"3"}`))
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("post bad command error = %v, resp = %+v", err, resp)
+	}
+	resp.Body.Close()
+
+	ch := make(chan []byte)
+	go d.ServeControl(ch)
+	ch <- []byte(`{"maxWorkerNum":1,"maxTaskNum":2}`)
+	close(ch)
+
+	waitFor(t, "max task number changed", func() bool { return d.GetMaxTaskNum() == 2 })
+
+	// busy workers retire after task finished
+	close(block)
+	waitFor(t, "busy workers retired", func() bool {
+		return d.GetTotalWorkNum() == 1 && atomic.LoadInt32(&done) == 3
+	})
+
+	if err = d.Reconfigure(dispatcher.Config{Lanes: []dispatcher.LaneConfig{{Name: "none"}}}); !errors.Is(err, dispatcher.ErrorOfLaneNotExist) {
+		t.Fatalf("reconfigure not exist lane error = %v", err)
+	}
+
+	if err = d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown error = %s", err)
+	}
+
+	if d.GetMaxWorkerNum() != 1 || d.GetTotalScaleDown() != 2 {
+		t.Fatalf("max worker = %d, scale down = %d", d.GetMaxWorkerNum(), d.GetTotalScaleDown())
+	}
+}
+
+func TestPauseWorker(t *testing.T) {
+	var running int32
+	block := make(chan struct{})
+
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "pause-worker", MaxWorkerNum: 2},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			atomic.AddInt32(&running, 1)
+			<-block
+			return nil
+		}, nil)
+	defer d.Shutdown(context.Background())
+
+	if ids := d.GetWorkerIDs(); len(ids) != 2 || ids[0] != 0 || ids[1] != 1 {
+		t.Fatalf("worker ids = %v", ids)
+	}
+
+	if d.PauseWorker(2) {
+		t.Fatalf("pause not exist worker")
+	}
+
+	if err := d.Control([]byte(`{"pauseWorkers":[0]}`)); err != nil {
+		t.Fatalf("control error = %s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := d.AddTask(dispatcher.Task{TimeOut: 60 * 1000}); err != nil {
+			t.Fatalf("add task error = %s", err)
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&running) != 1 || d.GetCurrentTaskTodoNum() != 1 {
+		t.Fatalf("running = %d, todo = %d with a paused worker", running, d.GetCurrentTaskTodoNum())
+	}
+
+	if ids := d.GetPausedWorkerIDs(); len(ids) != 1 || ids[0] != 0 {
+		t.Fatalf("paused worker ids = %v", ids)
+	}
+
+	if err := d.Control([]byte(`{"resumeWorkers":[0]}`)); err != nil {
+		t.Fatalf("control error = %s", err)
+	}
+
+	waitFor(t, "resumed worker run task", func() bool { return atomic.LoadInt32(&running) == 2 })
+
+	close(block)
+}
+
+func TestTranceLog(t *testing.T) {
+	var mutex sync.Mutex
+	var logs []string
+	logger := func(format string, v ...interface{}) {
+		mutex.Lock()
+		logs = append(logs, fmt.Sprintf(format, v...))
+		mutex.Unlock()
+	}
+
+	release := make(chan struct{})
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "trance", MaxWorkerNum: 1, IsTrance: true,
+		Logger: logger, Dedup: dispatcher.DedupReject},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			<-release
+			return nil
+		}, nil)
+
+	for i := 0; i < 2; i++ {
+		_, err := d.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: "same"}})
+		if (i == 0) != (err == nil) {
+			t.Fatalf("submit %d error = %v", i, err)
+		}
+	}
+
+	close(release)
+
+	done := make(chan struct{}, 1)
+	d.StopForever(done)
+	<-done
+
+	// refused status and stop message go to logger instead of stdout
+	mutex.Lock()
+	all := strings.Join(logs, "\n")
+	mutex.Unlock()
+
+	if !strings.Contains(all, "refused") || !strings.Contains(all, "trance dispatcher status") {
+		t.Errorf("refused status not logged : %s", all)
+	}
+
+	if !strings.Contains(all, "all workers stop accepting new task") {
+		t.Errorf("stop not logged : %s", all)
+	}
+}
+
+func TestCancelRetrying(t *testing.T) {
+	policy := &dispatcher.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute}
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "cancel-retrying", MaxWorkerNum: 1, Retry: policy},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			return errors.New("fail")
+		}, nil)
+	defer shutdown(d)
+
+	h, err := d.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: "retrying"}})
+	if err != nil {
+		t.Fatalf("submit error = %s", err)
+	}
+
+	waitFor(t, "task retrying", func() bool { return d.GetCurrentRetryingNum() == 1 })
+
+	if !h.Cancel() {
+		t.Fatalf("cancel retrying task failed")
+	}
+
+	// finished without waiting the backoff
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	out, err := h.Wait(ctx)
+	if err != nil || out.Err != dispatcher.ErrorOfTaskCancelled || h.Status() != dispatcher.TaskStatusCancelled {
+		t.Fatalf("wait retrying task out = %+v, error = %v, status = %s", out, err, h.Status())
+	}
+
+	if d.GetCurrentRetryingNum() != 0 || d.GetTotalCancelTask() != 1 {
+		t.Fatalf("retrying = %d, cancel = %d", d.GetCurrentRetryingNum(), d.GetTotalCancelTask())
+	}
+}
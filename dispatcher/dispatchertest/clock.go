@@ -0,0 +1,231 @@
+// Package dispatchertest test code using dispatcher without sleeping real time, by a virtual clock
+// and a synchronous dispatcher which operate tasks inline.
+package dispatchertest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+)
+
+// Clock virtual clock implement dispatcher.Clock, time only move by Advance. Timers due are fired
+// in the goroutine which call Advance in the order of their time, timers of zero duration are
+// fired by the next Advance.
+type Clock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	seq    uint64
+	timers map[*timer]struct{}
+}
+
+// NewClock create a virtual clock start at start, zero means 2020-01-01 00:00:00 UTC.
+func NewClock(start time.Time) *Clock {
+	if start.IsZero() {
+		start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	return &Clock{now: start, timers: make(map[*timer]struct{})}
+}
+
+type timer struct {
+	clock *Clock
+	when  time.Time
+	seq   uint64 // timers of the same time fire in the order set
+	ch    chan time.Time
+	f     func()
+}
+
+func (t *timer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *timer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+
+	_, ok := t.clock.timers[t]
+	delete(t.clock.timers, t)
+
+	return ok
+}
+
+func (t *timer) Reset(d time.Duration) bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+
+	_, ok := t.clock.timers[t]
+	t.clock.set(t, d)
+
+	return ok
+}
+
+// set timer fire after d, must hold lock.
+func (c *Clock) set(t *timer, d time.Duration) {
+	c.seq++
+	t.when = c.now.Add(d)
+	t.seq = c.seq
+	c.timers[t] = struct{}{}
+}
+
+// Now implement dispatcher.Clock.
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+// NewTimer implement dispatcher.Clock.
+func (c *Clock) NewTimer(d time.Duration) dispatcher.Timer {
+	t := &timer{clock: c, ch: make(chan time.Time, 1)}
+
+	c.mutex.Lock()
+	c.set(t, d)
+	c.mutex.Unlock()
+
+	return t
+}
+
+// AfterFunc implement dispatcher.Clock, f is called in the goroutine which call Advance.
+func (c *Clock) AfterFunc(d time.Duration, f func()) dispatcher.Timer {
+	t := &timer{clock: c, f: f}
+
+	c.mutex.Lock()
+	c.set(t, d)
+	c.mutex.Unlock()
+
+	return t
+}
+
+// Pending get number of timers not fired.
+func (c *Clock) Pending() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.timers)
+}
+
+// next get the first timer due before target, must hold lock.
+func (c *Clock) next(target time.Time) *timer {
+	var first *timer
+	for t := range c.timers {
+		if t.when.After(target) {
+			continue
+		}
+
+		if first == nil || t.when.Before(first.when) || (t.when.Equal(first.when) && t.seq < first.seq) {
+			first = t
+		}
+	}
+
+	return first
+}
+
+// Advance move the clock forward and fire timers due, time of clock is the time of timer
+// when it fire.
+func (c *Clock) Advance(d time.Duration) {
+	c.mutex.Lock()
+
+	target := c.now.Add(d)
+	for {
+		t := c.next(target)
+		if t == nil {
+			break
+		}
+
+		delete(c.timers, t)
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+
+		now := c.now
+		c.mutex.Unlock()
+
+		if t.f != nil {
+			t.f()
+		} else {
+			select {
+			case t.ch <- now:
+			default:
+			}
+		}
+
+		c.mutex.Lock()
+	}
+
+	if target.After(c.now) {
+		c.now = target
+	}
+
+	c.mutex.Unlock()
+}
+
+// timeoutContext context done when virtual clock pass deadline.
+type timeoutContext struct {
+	context.Context
+	deadline time.Time
+	done     chan struct{}
+
+	mutex sync.Mutex
+	err   error
+	timer dispatcher.Timer
+}
+
+func (ctx *timeoutContext) Deadline() (time.Time, bool) {
+	return ctx.deadline, true
+}
+
+func (ctx *timeoutContext) Done() <-chan struct{} {
+	return ctx.done
+}
+
+func (ctx *timeoutContext) Err() error {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+
+	return ctx.err
+}
+
+func (ctx *timeoutContext) cancel(err error) {
+	ctx.mutex.Lock()
+	if ctx.err != nil {
+		ctx.mutex.Unlock()
+		return
+	}
+
+	ctx.err = err
+	close(ctx.done)
+	timer := ctx.timer
+	ctx.mutex.Unlock()
+
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+// WithTimeout implement dispatcher.Clock.
+func (c *Clock) WithTimeout(parent context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	ctx := &timeoutContext{Context: parent, deadline: c.Now().Add(d), done: make(chan struct{})}
+
+	ctx.mutex.Lock()
+	ctx.timer = c.AfterFunc(d, func() {
+		ctx.cancel(context.DeadlineExceeded)
+	})
+	ctx.mutex.Unlock()
+
+	if err := parent.Err(); err != nil {
+		ctx.cancel(err)
+	} else if parent.Done() != nil {
+		go func() {
+			select {
+			case <-parent.Done():
+				ctx.cancel(parent.Err())
+			case <-ctx.done:
+			}
+		}()
+	}
+
+	return ctx, func() { ctx.cancel(context.Canceled) }
+}
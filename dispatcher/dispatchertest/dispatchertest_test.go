@@ -0,0 +1,230 @@
+package dispatchertest_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+	"github.com/ezgroot/ezUtils/dispatcher/dispatchertest"
+)
+
+func TestTimeout(t *testing.T) {
+	var h *dispatchertest.Harness
+	h = dispatchertest.New(t, dispatcher.Config{Name: "timeout"},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			h.Advance(2999 * time.Millisecond)
+			if ctx.Err() != nil {
+				t.Errorf("task = %s done before timeout", task.InData.TaskUID)
+			}
+
+			h.Advance(time.Millisecond)
+			<-ctx.Done()
+
+			return ctx.Err()
+		})
+
+	handle, err := h.D.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: "a"}, TimeOut: 3000})
+	if err != nil {
+		t.Fatalf("submit error = %s", err)
+	}
+
+	out, err := handle.Wait(context.Background())
+	if err != nil {
+		t.Fatalf("wait error = %s", err)
+	}
+
+	if !errors.Is(out.Err, context.DeadlineExceeded) {
+		t.Errorf("task error = %v, want %s", out.Err, context.DeadlineExceeded)
+	}
+
+	h.AssertStarted("a")
+	h.AssertCounters(dispatchertest.Counters{In: 1, Error: 1})
+}
+
+func TestRetry(t *testing.T) {
+	errFail := errors.New("fail")
+	policy := &dispatcher.RetryPolicy{MaxAttempts: 3, InitialBackoff: 100 * time.Millisecond, Jitter: 0.1}
+
+	h := dispatchertest.New(t, dispatcher.Config{Name: "retry", Retry: policy},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			if task.InData.TaskUID == "a" && task.Attempt < 3 {
+				return errFail
+			}
+
+			return nil
+		})
+
+	ha := h.Submit("a")
+	h.Submit("b")
+	h.AssertStarted("a", "b")
+
+	// backoff of the second attempt in [90ms, 110ms]
+	h.Advance(89 * time.Millisecond)
+	h.AssertStarted("a", "b")
+	h.Advance(21 * time.Millisecond)
+	h.AssertStarted("a", "b", "a")
+
+	// backoff of the third attempt in [180ms, 220ms]
+	h.Advance(220 * time.Millisecond)
+	h.AssertStarted("a", "b", "a", "a")
+
+	out, err := ha.Wait(context.Background())
+	if err != nil || out.Err != nil || out.Attempts != 3 {
+		t.Errorf("out = %+v error = %v, want 3 attempts without error", out, err)
+	}
+
+	h.AssertCounters(dispatchertest.Counters{In: 2, Done: 2, Retry: 2})
+}
+
+func TestRetryNoJitter(t *testing.T) {
+	policy := &dispatcher.RetryPolicy{MaxAttempts: 3, InitialBackoff: 100 * time.Millisecond}
+
+	h := dispatchertest.New(t, dispatcher.Config{Name: "retry-no-jitter", Retry: policy},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			return errors.New("fail")
+		})
+
+	h.Submit("a")
+	h.AssertStarted("a")
+
+	// zero jitter backoff is exactly 100ms then 200ms
+	h.Advance(99 * time.Millisecond)
+	h.AssertStarted("a")
+	h.Advance(time.Millisecond)
+	h.AssertStarted("a", "a")
+
+	h.Advance(199 * time.Millisecond)
+	h.AssertStarted("a", "a")
+	h.Advance(time.Millisecond)
+	h.AssertStarted("a", "a", "a")
+}
+
+func TestRefuse(t *testing.T) {
+	h := dispatchertest.New(t, dispatcher.Config{Name: "refuse", MaxTaskNum: 10},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			return nil
+		})
+
+	h.D.Pause()
+
+	var uids []string
+	for i := 0; i < 9; i++ {
+		uid := strconv.Itoa(i)
+		h.Submit(uid)
+		uids = append(uids, uid)
+	}
+
+	_, err := h.D.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: "x"}})
+
+	var admissionErr *dispatcher.AdmissionError
+	if !errors.As(err, &admissionErr) || admissionErr.TaskUID != "x" {
+		t.Fatalf("submit error = %v, want admission error", err)
+	}
+
+	h.AssertStarted()
+	h.AssertCounters(dispatchertest.Counters{In: 9, Refused: 1})
+
+	h.D.Resume()
+	h.AssertStarted(uids...)
+	h.AssertCounters(dispatchertest.Counters{In: 9, Done: 9, Refused: 1})
+
+	refused := h.EventsOf(dispatchertest.EventRefuse)
+	if len(refused) != 1 || refused[0].TaskUID != "x" {
+		t.Errorf("refuse events = %v", refused)
+	}
+}
+
+func TestCoDel(t *testing.T) {
+	h := dispatchertest.New(t, dispatcher.Config{Name: "codel",
+		Admission: dispatcher.NewCoDelAdmission(5*time.Millisecond, 100*time.Millisecond)},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			return nil
+		})
+
+	h.D.Pause()
+	h.Submit("a")
+
+	// head of queue wait above target since now
+	h.Advance(10 * time.Millisecond)
+	h.Submit("b")
+
+	h.Advance(99 * time.Millisecond)
+	h.Submit("c")
+
+	h.Advance(time.Millisecond)
+	_, err := h.D.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: "d"}})
+
+	var admissionErr *dispatcher.AdmissionError
+	if !errors.As(err, &admissionErr) || admissionErr.RetryAfter != 100*time.Millisecond {
+		t.Fatalf("submit error = %v, want admission error", err)
+	}
+
+	h.D.Resume()
+	h.AssertStarted("a", "b", "c")
+	h.AssertCounters(dispatchertest.Counters{In: 3, Done: 3, Refused: 1})
+}
+
+func TestCron(t *testing.T) {
+	h := dispatchertest.New(t, dispatcher.Config{Name: "cron", Dedup: dispatcher.DedupCoalesce},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+			return nil
+		})
+
+	if err := h.D.AddCronTask(dispatcher.Task{InData: dispatcher.InData{TaskUID: "job"}}, "@every 1m"); err != nil {
+		t.Fatalf("add cron task error = %s", err)
+	}
+
+	// every fire has its own uid, so it is not coalesced by dedup
+	for i := 1; i <= 2; i++ {
+		h.Advance(time.Minute)
+
+		deadline := time.Now().Add(3 * time.Second)
+		for len(h.Started()) < i {
+			if time.Now().After(deadline) {
+				t.Fatalf("cron task not fired %d times", i)
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	h.AssertStarted("job@2020-01-01T00:01:00Z", "job@2020-01-01T00:02:00Z")
+}
+
+func TestClock(t *testing.T) {
+	c := dispatchertest.NewClock(time.Time{})
+	start := c.Now()
+
+	var fired []int
+	c.AfterFunc(20*time.Millisecond, func() { fired = append(fired, 2) })
+	c.AfterFunc(10*time.Millisecond, func() { fired = append(fired, 1) })
+	stopped := c.AfterFunc(15*time.Millisecond, func() { fired = append(fired, 0) })
+	timer := c.NewTimer(30 * time.Millisecond)
+
+	if !stopped.Stop() {
+		t.Errorf("stop active timer = false")
+	}
+
+	c.Advance(25 * time.Millisecond)
+	if len(fired) != 2 || fired[0] != 1 || fired[1] != 2 {
+		t.Errorf("fired = %v, want [1 2]", fired)
+	}
+
+	select {
+	case <-timer.C():
+		t.Errorf("timer fired early")
+	default:
+	}
+
+	c.Advance(5 * time.Millisecond)
+	if now := <-timer.C(); !now.Equal(start.Add(30 * time.Millisecond)) {
+		t.Errorf("timer fired at %s", now)
+	}
+
+	if c.Pending() != 0 {
+		t.Errorf("pending = %d, want 0", c.Pending())
+	}
+}
@@ -0,0 +1,213 @@
+package dispatchertest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+)
+
+const (
+	shutdownTimeout = time.Duration(1000) * time.Millisecond
+)
+
+// EventKind kind of task event.
+type EventKind int
+
+// event kind enum
+const (
+	EventEnqueue EventKind = iota
+	EventStart
+	EventFinish
+	EventRefuse
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventEnqueue:
+		return "enqueue"
+	case EventStart:
+		return "start"
+	case EventFinish:
+		return "finish"
+	case EventRefuse:
+		return "refuse"
+	default:
+		return "unknown"
+	}
+}
+
+// Event of task recorded by harness.
+type Event struct {
+	Kind    EventKind
+	TaskUID string
+	Attempt int
+	Err     error     // error of finish or refuse
+	Time    time.Time // time of virtual clock
+}
+
+func (e Event) String() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s %s #%d : %s", e.Kind, e.TaskUID, e.Attempt, e.Err)
+	}
+
+	return fmt.Sprintf("%s %s #%d", e.Kind, e.TaskUID, e.Attempt)
+}
+
+// Counters counters of dispatcher.
+type Counters struct {
+	In      uint64
+	Done    uint64
+	Error   uint64
+	Panic   uint64
+	Refused uint64
+	Cancel  uint64
+	Retry   uint64
+}
+
+// GetCounters get counters of dispatcher.
+func GetCounters(d *dispatcher.Dispatcher) Counters {
+	return Counters{
+		In:      d.GetTotalInTask(),
+		Done:    d.GetTotalDoneTask(),
+		Error:   d.GetTotalErrorTask(),
+		Panic:   d.GetTotalPanicTask(),
+		Refused: d.GetTotalRefusedTask(),
+		Cancel:  d.GetTotalCancelTask(),
+		Retry:   d.GetTotalRetryTask(),
+	}
+}
+
+// recorder hooks record events.
+type recorder struct {
+	dispatcher.NopHooks
+	clock  *Clock
+	mutex  sync.Mutex
+	events []Event
+}
+
+func (r *recorder) add(kind EventKind, t dispatcher.Task, err error) {
+	r.mutex.Lock()
+	r.events = append(r.events, Event{Kind: kind, TaskUID: t.InData.TaskUID, Attempt: t.Attempt, Err: err,
+		Time: r.clock.Now()})
+	r.mutex.Unlock()
+}
+
+func (r *recorder) OnEnqueue(t dispatcher.Task) {
+	r.add(EventEnqueue, t, nil)
+}
+
+func (r *recorder) OnStart(ctx context.Context, t dispatcher.Task) context.Context {
+	r.add(EventStart, t, nil)
+	return ctx
+}
+
+func (r *recorder) OnFinish(ctx context.Context, t dispatcher.Task, err error, cost time.Duration) {
+	r.add(EventFinish, t, err)
+}
+
+func (r *recorder) OnRefuse(t dispatcher.Task, err error) {
+	r.add(EventRefuse, t, err)
+}
+
+// Harness a synchronous dispatcher with virtual clock, tasks are operated before Submit return,
+// retried tasks are operated by Advance. workDo can call Advance to simulate a slow task,
+// but should not wait handle of other tasks.
+type Harness struct {
+	t     testing.TB
+	Clock *Clock
+	D     *dispatcher.Dispatcher
+	rec   *recorder
+}
+
+// New create a harness by config, Clock and Synchronous of config are overridden, events are
+// recorded besides Hooks of config. Dispatcher is shutdown when test end.
+func New(t testing.TB, c dispatcher.Config, workDo func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error) *Harness {
+	clock := NewClock(time.Time{})
+	rec := &recorder{clock: clock}
+
+	c.Clock = clock
+	c.Synchronous = true
+	c.Hooks = dispatcher.MultiHooks(c.Hooks, rec)
+
+	h := &Harness{t: t, Clock: clock, D: dispatcher.GetDispatch(c, workDo, nil), rec: rec}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		_ = h.D.Shutdown(ctx)
+	})
+
+	return h
+}
+
+// Advance move the virtual clock forward, retried and scheduled tasks due are operated.
+func (h *Harness) Advance(d time.Duration) {
+	h.Clock.Advance(d)
+}
+
+// Submit a task of uid, test fail if refused.
+func (h *Harness) Submit(uid string) *dispatcher.Handle {
+	h.t.Helper()
+
+	handle, err := h.D.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: uid}})
+	if err != nil {
+		h.t.Fatalf("submit task = %s error = %s", uid, err)
+	}
+
+	return handle
+}
+
+// Events get events recorded in order.
+func (h *Harness) Events() []Event {
+	h.rec.mutex.Lock()
+	defer h.rec.mutex.Unlock()
+
+	return append([]Event(nil), h.rec.events...)
+}
+
+// EventsOf get events of a kind in order.
+func (h *Harness) EventsOf(kind EventKind) []Event {
+	var list []Event
+	for _, e := range h.Events() {
+		if e.Kind == kind {
+			list = append(list, e)
+		}
+	}
+
+	return list
+}
+
+// Started get uid of tasks in the order attempts started, a retried task appear many times.
+func (h *Harness) Started() []string {
+	var list []string
+	for _, e := range h.EventsOf(EventStart) {
+		list = append(list, e.TaskUID)
+	}
+
+	return list
+}
+
+// AssertStarted check the order attempts started.
+func (h *Harness) AssertStarted(uids ...string) {
+	h.t.Helper()
+
+	got := h.Started()
+	if fmt.Sprint(got) != fmt.Sprint(uids) {
+		h.t.Errorf("started = %v, want %v", got, uids)
+	}
+}
+
+// AssertCounters check counters of dispatcher.
+func (h *Harness) AssertCounters(want Counters) {
+	h.t.Helper()
+
+	got := GetCounters(h.D)
+	if got != want {
+		h.t.Errorf("counters = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,552 @@
+// Package distributed share one task queue between dispatchers on many nodes by etcd,
+// tasks are etcd keys, a node claim a task with its lease before operate it by local dispatcher,
+// so tasks claimed by a crashed node are claimed by other nodes after its lease expired.
+package distributed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+	"github.com/ezgroot/ezUtils/zetcd"
+)
+
+const (
+	defaultLeaseTTL    = 10 // per - Second
+	defaultRequestTime = time.Duration(3000) * time.Millisecond
+	defaultRescanTime  = time.Duration(5000) * time.Millisecond
+	defaultRegrantTime = time.Duration(1000) * time.Millisecond
+
+	defaultRefuseBackoff    = time.Duration(100) * time.Millisecond
+	defaultMaxRefuseBackoff = time.Duration(30000) * time.Millisecond
+)
+
+// node errors.
+var (
+	ErrorOfTaskExist    = errors.New("distributed task uid exist")
+	ErrorOfEmptyTaskUID = errors.New("distributed task uid is empty")
+	ErrorOfNodeStarted  = errors.New("distributed node has been started")
+)
+
+// Config of node.
+type Config struct {
+	Prefix   string // prefix of etcd keys, nodes share queue by the same prefix
+	NodeID   string // unique id of node
+	LeaseTTL int64  // per - Second, claimed tasks are released after node lost so long, default 10
+	// MaxClaimNum max tasks claimed by this node and not finished, default max workers of dispatcher.
+	MaxClaimNum int
+	// RescanTime period to scan unclaimed tasks, in case of watch events missed, default 5s.
+	RescanTime time.Duration
+	// Logger receive warnings like etcd errors and lease lost, nil means not log them.
+	Logger dispatcher.Logger
+}
+
+// taskValue value of task key.
+type taskValue struct {
+	TaskUID    string `json:"taskUID"`
+	Lane       string `json:"lane"`
+	Data       []byte `json:"data"`
+	TimeOut    int64  `json:"timeout"`
+	CreateTime int64  `json:"createTime"`
+}
+
+// claim a task claimed by node, handle is nil before the task added to local dispatcher.
+type claim struct {
+	handle *dispatcher.Handle
+}
+
+// refusal a task refused by local dispatcher, it is not claimed again until backoff passed.
+type refusal struct {
+	times int
+	until time.Time
+}
+
+// Node a member of distributed dispatcher, it claims tasks and operate them by local dispatcher.
+type Node struct {
+	client      *clientv3.Client
+	d           *dispatcher.Dispatcher
+	taskPrefix  string
+	claimPrefix string
+	nodeID      string
+	leaseTTL    int64
+	maxClaimNum int
+	rescanTime  time.Duration
+	logger      dispatcher.Logger
+
+	mutex     sync.Mutex
+	claimed   map[string]*claim
+	refused   map[string]refusal
+	leaseID   clientv3.LeaseID // 0 when lease lost and a new one not granted yet
+	isRunning bool
+	cancel    context.CancelFunc
+	stopCh    chan struct{}
+	scanCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewNode create a node with etcd client and local dispatcher.
+func NewNode(client *clientv3.Client, d *dispatcher.Dispatcher, c Config) (*Node, error) {
+	if client == nil || d == nil {
+		return nil, fmt.Errorf("distributed node client or dispatcher is nil")
+	}
+
+	if c.NodeID == "" {
+		return nil, fmt.Errorf("distributed node id is empty")
+	}
+
+	if c.LeaseTTL <= 0 {
+		c.LeaseTTL = defaultLeaseTTL
+	}
+
+	if c.MaxClaimNum <= 0 {
+		c.MaxClaimNum = d.GetMaxWorkerNum()
+	}
+
+	if c.RescanTime <= 0 {
+		c.RescanTime = defaultRescanTime
+	}
+
+	prefix := strings.TrimSuffix(c.Prefix, "/")
+
+	return &Node{
+		client:      client,
+		d:           d,
+		taskPrefix:  prefix + "/tasks/",
+		claimPrefix: prefix + "/claims/",
+		nodeID:      c.NodeID,
+		leaseTTL:    c.LeaseTTL,
+		maxClaimNum: c.MaxClaimNum,
+		rescanTime:  c.RescanTime,
+		logger:      c.Logger,
+		claimed:     make(map[string]*claim),
+		refused:     make(map[string]refusal),
+		scanCh:      make(chan struct{}, 1),
+	}, nil
+}
+
+// Enqueue put a task to distributed queue, only TaskUID, Data, Lane and TimeOut of task are shared.
+func (n *Node) Enqueue(ctx context.Context, t dispatcher.Task) error {
+	if t.InData.TaskUID == "" {
+		return ErrorOfEmptyTaskUID
+	}
+
+	value, err := json.Marshal(taskValue{
+		TaskUID:    t.InData.TaskUID,
+		Lane:       t.Lane,
+		Data:       t.InData.Data,
+		TimeOut:    int64(t.TimeOut),
+		CreateTime: time.Now().UTC().UnixNano(),
+	})
+	if err != nil {
+		return err
+	}
+
+	ok, err := zetcd.TxnPutIfNotExist(ctx, n.client, n.taskPrefix+t.InData.TaskUID, string(value), 0)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrorOfTaskExist
+	}
+
+	return nil
+}
+
+// Start join the distributed queue, claim tasks until Stop.
+func (n *Node) Start(ctx context.Context) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.isRunning {
+		return ErrorOfNodeStarted
+	}
+
+	_, leaseID, err := zetcd.CreateLease(ctx, n.client, n.leaseTTL)
+	if err != nil {
+		return fmt.Errorf("distributed node = %s create lease error : %s", n.nodeID, err)
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+
+	keepCh, err := zetcd.KeepAliveAways(runCtx, n.client, leaseID)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("distributed node = %s keep lease error : %s", n.nodeID, err)
+	}
+
+	stopCh := make(chan struct{})
+
+	n.leaseID = leaseID
+	n.isRunning = true
+	n.cancel = cancel
+	n.stopCh = stopCh
+
+	taskCh := make(chan zetcd.WatchData, 64)
+	claimCh := make(chan zetcd.WatchData, 64)
+	watchDoneCh := make(chan struct{})
+
+	var watchWg sync.WaitGroup
+	watchWg.Add(2)
+
+	go func() {
+		defer watchWg.Done()
+		zetcd.WatchPrefix(runCtx, n.client, n.taskPrefix, taskCh, stopCh)
+	}()
+
+	go func() {
+		defer watchWg.Done()
+		zetcd.WatchPrefix(runCtx, n.client, n.claimPrefix, claimCh, stopCh)
+	}()
+
+	go func() {
+		watchWg.Wait()
+		close(watchDoneCh)
+	}()
+
+	n.wg.Add(2)
+
+	go func() {
+		defer n.wg.Done()
+		n.keepLease(runCtx, keepCh, stopCh)
+	}()
+
+	go func() {
+		defer n.wg.Done()
+		n.run(taskCh, claimCh, stopCh)
+
+		// watchers may block on sending events
+		for {
+			select {
+			case <-taskCh:
+			case <-claimCh:
+			case <-watchDoneCh:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// keepLease drain keep alive responses until lease lost, such as etcd unreachable longer than ttl,
+// then cancel tasks claimed by the lost lease and grant a new one.
+func (n *Node) keepLease(ctx context.Context, keepCh <-chan *clientv3.LeaseKeepAliveResponse, stopCh chan struct{}) {
+	for {
+		for range keepCh {
+		}
+
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+
+		n.logf("distributed node = %s lease lost, cancel claimed tasks", n.nodeID)
+		n.leaseLost()
+
+		keepCh = n.grantLease(ctx, stopCh)
+		if keepCh == nil {
+			return
+		}
+
+		n.rescan()
+	}
+}
+
+// leaseLost stop claiming and cancel tasks claimed by the lost lease, since other nodes may claim
+// them, the claims are released when tasks finished.
+func (n *Node) leaseLost() {
+	n.mutex.Lock()
+	n.leaseID = 0
+
+	var handles []*dispatcher.Handle
+	for _, c := range n.claimed {
+		if c.handle != nil {
+			handles = append(handles, c.handle)
+		}
+	}
+	n.mutex.Unlock()
+
+	for _, h := range handles {
+		h.Cancel()
+	}
+}
+
+// grantLease grant a new lease and keep it alive, retry until success or node stop.
+func (n *Node) grantLease(ctx context.Context, stopCh chan struct{}) <-chan *clientv3.LeaseKeepAliveResponse {
+	for {
+		reqCtx, cancel := context.WithTimeout(ctx, defaultRequestTime)
+		_, leaseID, err := zetcd.CreateLease(reqCtx, n.client, n.leaseTTL)
+		cancel()
+
+		if err == nil {
+			var keepCh <-chan *clientv3.LeaseKeepAliveResponse
+			keepCh, err = zetcd.KeepAliveAways(ctx, n.client, leaseID)
+			if err == nil {
+				n.mutex.Lock()
+				n.leaseID = leaseID
+				n.mutex.Unlock()
+
+				return keepCh
+			}
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		n.logf("distributed node = %s grant lease error = %s", n.nodeID, err)
+
+		select {
+		case <-stopCh:
+			return nil
+		case <-time.After(defaultRegrantTime):
+		}
+	}
+}
+
+// run claim tasks when task created or claim released, and scan tasks periodically.
+func (n *Node) run(taskCh chan zetcd.WatchData, claimCh chan zetcd.WatchData, stopCh chan struct{}) {
+	ticker := time.NewTicker(n.rescanTime)
+	defer ticker.Stop()
+
+	n.scan()
+
+	for {
+		select {
+		case wd := <-taskCh:
+			if wd.Operate == zetcd.MethodCreate {
+				n.tryClaim(strings.TrimPrefix(wd.Key, n.taskPrefix))
+			}
+		case wd := <-claimCh:
+			if wd.Operate == zetcd.MethodDelete {
+				n.tryClaim(strings.TrimPrefix(wd.Key, n.claimPrefix))
+			}
+		case <-n.scanCh:
+			n.scan()
+		case <-ticker.C:
+			n.scan()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// scan all tasks and try to claim them.
+func (n *Node) scan() {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultRequestTime)
+	defer cancel()
+
+	_, data, err := zetcd.GetWithPrefix(ctx, n.client, n.taskPrefix)
+	if err != nil {
+		n.logf("distributed node = %s scan tasks error = %s", n.nodeID, err)
+		return
+	}
+
+	_, claims, err := zetcd.GetWithPrefix(ctx, n.client, n.claimPrefix)
+	if err != nil {
+		n.logf("distributed node = %s scan claims error = %s", n.nodeID, err)
+		return
+	}
+
+	// forget refusals of tasks finished by other nodes
+	n.mutex.Lock()
+	for uid := range n.refused {
+		if _, ok := data[n.taskPrefix+uid]; !ok {
+			delete(n.refused, uid)
+		}
+	}
+	n.mutex.Unlock()
+
+	for key := range data {
+		uid := strings.TrimPrefix(key, n.taskPrefix)
+		if _, ok := claims[n.claimPrefix+uid]; !ok {
+			n.tryClaim(uid)
+		}
+	}
+}
+
+// tryClaim claim a task with node lease and add it to local dispatcher.
+func (n *Node) tryClaim(uid string) {
+	n.mutex.Lock()
+	if _, ok := n.claimed[uid]; ok || len(n.claimed) >= n.maxClaimNum || !n.isRunning || n.leaseID == 0 {
+		n.mutex.Unlock()
+		return
+	}
+
+	if r, ok := n.refused[uid]; ok && time.Now().Before(r.until) {
+		n.mutex.Unlock()
+		return
+	}
+
+	leaseID := n.leaseID
+	c := &claim{}
+	n.claimed[uid] = c
+	n.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultRequestTime)
+	defer cancel()
+
+	ok, err := zetcd.TxnPutIfNotExist(ctx, n.client, n.claimPrefix+uid, n.nodeID, leaseID)
+	if err != nil || !ok {
+		n.unclaimed(uid)
+		return
+	}
+
+	// task may be finished before claimed
+	_, data, err := zetcd.Get(ctx, n.client, n.taskPrefix+uid)
+	value, exist := data[n.taskPrefix+uid]
+	if err != nil || !exist {
+		n.release(uid, leaseID, false)
+		n.rescan()
+		return
+	}
+
+	var tv taskValue
+	err = json.Unmarshal([]byte(value), &tv)
+	if err != nil {
+		n.logf("distributed node = %s task = %s is invalid, error = %s", n.nodeID, uid, err)
+		n.release(uid, leaseID, true)
+		n.rescan()
+		return
+	}
+
+	h, err := n.d.Submit(dispatcher.Task{
+		InData:  dispatcher.InData{TaskUID: tv.TaskUID, Data: tv.Data},
+		Lane:    tv.Lane,
+		TimeOut: time.Duration(tv.TimeOut),
+	})
+	if err != nil {
+		// not rescan, or the task is claimed and refused again at once
+		n.refuse(uid)
+		n.release(uid, leaseID, false)
+		return
+	}
+
+	n.mutex.Lock()
+	delete(n.refused, uid)
+	c.handle = h
+	isLost := n.leaseID != leaseID
+	n.mutex.Unlock()
+
+	// lease lost when adding task
+	if isLost {
+		h.Cancel()
+	}
+
+	go func() {
+		<-h.Done()
+
+		// cancelled task is released to other nodes
+		n.release(uid, leaseID, h.Status() != dispatcher.TaskStatusCancelled)
+		n.rescan()
+	}()
+}
+
+// refuse back off claiming a task refused by local dispatcher, backoff double every time.
+func (n *Node) refuse(uid string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	r := n.refused[uid]
+
+	backoff := defaultRefuseBackoff << uint(r.times)
+	if backoff <= 0 || backoff > defaultMaxRefuseBackoff {
+		backoff = defaultMaxRefuseBackoff
+	} else {
+		r.times++
+	}
+
+	r.until = time.Now().Add(backoff)
+	n.refused[uid] = r
+}
+
+// release claim of task, task is deleted if it finished, nothing is deleted if the claim has been
+// lost with lease, since other node may claim the task again.
+func (n *Node) release(uid string, leaseID clientv3.LeaseID, isFinished bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultRequestTime)
+	defer cancel()
+
+	keys := map[string]string{}
+	if isFinished {
+		keys[n.taskPrefix+uid] = ""
+	}
+
+	_, err := zetcd.TxnDeleteIfLease(ctx, n.client, n.claimPrefix+uid, leaseID, keys)
+	if err != nil {
+		n.logf("distributed node = %s release task = %s error = %s", n.nodeID, uid, err)
+	}
+
+	n.unclaimed(uid)
+}
+
+// rescan tasks, since tasks may be skipped when claimed too many.
+func (n *Node) rescan() {
+	select {
+	case n.scanCh <- struct{}{}:
+	default:
+	}
+}
+
+func (n *Node) unclaimed(uid string) {
+	n.mutex.Lock()
+	delete(n.claimed, uid)
+	n.mutex.Unlock()
+}
+
+// GetClaimedNum get number of tasks claimed by this node and not finished.
+func (n *Node) GetClaimedNum() int {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return len(n.claimed)
+}
+
+// logf log a warning by Config.Logger.
+func (n *Node) logf(format string, v ...interface{}) {
+	if n.logger != nil {
+		n.logger(format, v...)
+	}
+}
+
+// Stop leave the distributed queue, the lease is revoked so unfinished tasks are claimed by other
+// nodes at once, local dispatcher should be shutdown before stop if tasks should be finished.
+func (n *Node) Stop() {
+	n.mutex.Lock()
+	if !n.isRunning {
+		n.mutex.Unlock()
+		return
+	}
+
+	close(n.stopCh)
+	n.isRunning = false
+	n.mutex.Unlock()
+
+	n.cancel()
+	n.wg.Wait()
+
+	// lease may be granted again before stop
+	n.mutex.Lock()
+	leaseID := n.leaseID
+	n.mutex.Unlock()
+
+	if leaseID == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultRequestTime)
+	defer cancel()
+
+	_, err := zetcd.RevokeLease(ctx, n.client, leaseID)
+	if err != nil {
+		n.logf("distributed node = %s revoke lease error = %s", n.nodeID, err)
+	}
+}
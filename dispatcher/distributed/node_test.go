@@ -0,0 +1,340 @@
+package distributed_test
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.uber.org/zap"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+	"github.com/ezgroot/ezUtils/dispatcher/distributed"
+)
+
+func startEtcd(t *testing.T) *clientv3.Client {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+
+	lcURL, _ := url.Parse("http://127.0.0.1:0")
+	lpURL, _ := url.Parse("http://127.0.0.1:0")
+	cfg.LCUrls = []url.URL{*lcURL}
+	cfg.LPUrls = []url.URL{*lpURL}
+	cfg.ACUrls = cfg.LCUrls
+	cfg.APUrls = cfg.LPUrls
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("start etcd error = %s", err)
+	}
+	t.Cleanup(e.Close)
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd not ready")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{e.Clients[0].Addr().String()},
+		DialTimeout: 3 * time.Second,
+		Logger:      zap.NewNop(),
+	})
+	if err != nil {
+		t.Fatalf("create client error = %s", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+type recorder struct {
+	mutex sync.Mutex
+	done  map[string][]string // task uid -> node ids
+}
+
+func (r *recorder) work(nodeID string, block chan struct{}) func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+	return func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+		if block != nil {
+			select {
+			case <-block:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		r.mutex.Lock()
+		r.done[task.InData.TaskUID] = append(r.done[task.InData.TaskUID], nodeID)
+		r.mutex.Unlock()
+
+		return nil
+	}
+}
+
+func (r *recorder) count() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return len(r.done)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(15 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("wait %s timeout", what)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func newNode(t *testing.T, client *clientv3.Client, id string, work func(context.Context, dispatcher.Resource, dispatcher.Task) error) (*distributed.Node, *dispatcher.Dispatcher) {
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: id, MaxWorkerNum: 4, MaxTaskNum: 100}, work, nil)
+
+	n, err := distributed.NewNode(client, d, distributed.Config{
+		Prefix:     "/test/" + t.Name(),
+		NodeID:     id,
+		LeaseTTL:   2,
+		RescanTime: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("new node error = %s", err)
+	}
+
+	return n, d
+}
+
+func TestNodeShare(t *testing.T) {
+	client := startEtcd(t)
+	r := &recorder{done: make(map[string][]string)}
+
+	n1, d1 := newNode(t, client, "node1", r.work("node1", nil))
+	n2, d2 := newNode(t, client, "node2", r.work("node2", nil))
+
+	ctx := context.Background()
+	for _, n := range []*distributed.Node{n1, n2} {
+		if err := n.Start(ctx); err != nil {
+			t.Fatalf("start node error = %s", err)
+		}
+	}
+
+	if err := n1.Start(ctx); err != distributed.ErrorOfNodeStarted {
+		t.Fatalf("start twice error = %v", err)
+	}
+
+	total := 40
+	for i := 0; i < total; i++ {
+		err := n1.Enqueue(ctx, dispatcher.Task{InData: dispatcher.InData{TaskUID: "task-" + strconv.Itoa(i)}})
+		if err != nil {
+			t.Fatalf("enqueue error = %s", err)
+		}
+	}
+
+	if err := n2.Enqueue(ctx, dispatcher.Task{}); err != distributed.ErrorOfEmptyTaskUID {
+		t.Fatalf("enqueue empty uid error = %v", err)
+	}
+
+	waitFor(t, "tasks done", func() bool { return r.count() == total })
+	waitFor(t, "claims released", func() bool { return n1.GetClaimedNum() == 0 && n2.GetClaimedNum() == 0 })
+
+	n1.Stop()
+	n2.Stop()
+	d1.Shutdown(ctx)
+	d2.Shutdown(ctx)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for uid, nodes := range r.done {
+		if len(nodes) != 1 {
+			t.Errorf("task = %s done by %v", uid, nodes)
+		}
+	}
+
+	resp, err := client.Get(ctx, "/test/"+t.Name(), clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		t.Fatalf("get keys error = %s", err)
+	}
+
+	if resp.Count != 0 {
+		t.Errorf("keys left = %d, want 0", resp.Count)
+	}
+}
+
+func TestNodeRequeue(t *testing.T) {
+	client := startEtcd(t)
+	r := &recorder{done: make(map[string][]string)}
+
+	// node1 never finish tasks before it stop
+	block := make(chan struct{})
+	n1, d1 := newNode(t, client, "node1", r.work("node1", block))
+
+	ctx := context.Background()
+	if err := n1.Start(ctx); err != nil {
+		t.Fatalf("start node error = %s", err)
+	}
+
+	total := 3
+	for i := 0; i < total; i++ {
+		err := n1.Enqueue(ctx, dispatcher.Task{InData: dispatcher.InData{TaskUID: fmt.Sprintf("task-%d", i)}})
+		if err != nil {
+			t.Fatalf("enqueue error = %s", err)
+		}
+	}
+
+	waitFor(t, "node1 claim", func() bool { return n1.GetClaimedNum() == total })
+
+	err := n1.Enqueue(ctx, dispatcher.Task{InData: dispatcher.InData{TaskUID: "task-0"}})
+	if err != distributed.ErrorOfTaskExist {
+		t.Fatalf("enqueue exist task error = %v", err)
+	}
+
+	n2, d2 := newNode(t, client, "node2", r.work("node2", nil))
+	if err := n2.Start(ctx); err != nil {
+		t.Fatalf("start node error = %s", err)
+	}
+
+	// claimed tasks are not operated by others
+	time.Sleep(500 * time.Millisecond)
+	if r.count() != 0 {
+		t.Fatalf("tasks claimed by node1 done by others")
+	}
+
+	// node1 lost, its claims are released with lease
+	n1.Stop()
+
+	waitFor(t, "tasks requeue", func() bool { return r.count() == total })
+
+	// tasks finished by lost node1 must not release claims of node2
+	close(block)
+	d1.Shutdown(ctx)
+	waitFor(t, "claims released", func() bool { return n1.GetClaimedNum() == 0 && n2.GetClaimedNum() == 0 })
+	n2.Stop()
+	d2.Shutdown(ctx)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for uid, nodes := range r.done {
+		if len(nodes) != 1 || nodes[0] != "node2" {
+			t.Errorf("task = %s done by %v, want node2", uid, nodes)
+		}
+	}
+}
+
+type refuseHooks struct {
+	dispatcher.NopHooks
+	num int32
+}
+
+func (h *refuseHooks) OnRefuse(t dispatcher.Task, err error) {
+	atomic.AddInt32(&h.num, 1)
+}
+
+func TestNodeRefuseBackoff(t *testing.T) {
+	client := startEtcd(t)
+
+	hooks := &refuseHooks{}
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "refuse", MaxWorkerNum: 1, Hooks: hooks},
+		func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error { return nil }, nil)
+
+	n, err := distributed.NewNode(client, d, distributed.Config{Prefix: "/test/" + t.Name(), NodeID: "node1",
+		LeaseTTL: 2, RescanTime: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("new node error = %s", err)
+	}
+
+	ctx := context.Background()
+	if err = n.Start(ctx); err != nil {
+		t.Fatalf("start node error = %s", err)
+	}
+	defer d.Shutdown(ctx)
+	defer n.Stop()
+
+	// local dispatcher has no such lane
+	err = n.Enqueue(ctx, dispatcher.Task{InData: dispatcher.InData{TaskUID: "task-0"}, Lane: "missing"})
+	if err != nil {
+		t.Fatalf("enqueue error = %s", err)
+	}
+
+	waitFor(t, "task refused", func() bool { return atomic.LoadInt32(&hooks.num) > 0 })
+	time.Sleep(time.Second)
+
+	// 100ms, 200ms, 400ms and 800ms backoff
+	if num := atomic.LoadInt32(&hooks.num); num > 5 {
+		t.Errorf("task refused %d times in a second", num)
+	}
+
+	if n.GetClaimedNum() != 0 {
+		t.Errorf("claimed = %d, want 0", n.GetClaimedNum())
+	}
+}
+
+func TestNodeLeaseLost(t *testing.T) {
+	client := startEtcd(t)
+
+	var startNum int32
+	release := make(chan struct{})
+	n, d := newNode(t, client, "node1", func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+		atomic.AddInt32(&startNum, 1)
+
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	ctx := context.Background()
+	if err := n.Start(ctx); err != nil {
+		t.Fatalf("start node error = %s", err)
+	}
+
+	err := n.Enqueue(ctx, dispatcher.Task{InData: dispatcher.InData{TaskUID: "task-0"}, TimeOut: 60 * 1000})
+	if err != nil {
+		t.Fatalf("enqueue error = %s", err)
+	}
+
+	claimKey := "/test/" + t.Name() + "/claims/task-0"
+	getLease := func() clientv3.LeaseID {
+		resp, err := client.Get(ctx, claimKey)
+		if err != nil || len(resp.Kvs) == 0 {
+			return 0
+		}
+
+		return clientv3.LeaseID(resp.Kvs[0].Lease)
+	}
+
+	waitFor(t, "task start", func() bool { return atomic.LoadInt32(&startNum) == 1 && getLease() != 0 })
+
+	// lease lost as if etcd unreachable longer than ttl
+	lost := getLease()
+	if _, err = client.Revoke(ctx, lost); err != nil {
+		t.Fatalf("revoke lease error = %s", err)
+	}
+
+	waitFor(t, "task claimed again", func() bool {
+		lease := getLease()
+		return atomic.LoadInt32(&startNum) == 2 && lease != 0 && lease != lost
+	})
+
+	close(release)
+	waitFor(t, "task done", func() bool {
+		resp, err := client.Get(ctx, "/test/"+t.Name(), clientv3.WithPrefix(), clientv3.WithCountOnly())
+		return err == nil && resp.Count == 0 && n.GetClaimedNum() == 0
+	})
+
+	n.Stop()
+	d.Shutdown(ctx)
+}
@@ -0,0 +1,334 @@
+package dispatcher
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrorOfTaskCancelled task has been cancelled by handle.
+var ErrorOfTaskCancelled = errors.New("task has been cancelled")
+
+// TaskStatus status of a task.
+type TaskStatus int
+
+// task status enum
+const (
+	TaskStatusQueued TaskStatus = iota
+	TaskStatusRunning
+	TaskStatusDone
+	TaskStatusFailed
+	TaskStatusCancelled
+)
+
+func (s TaskStatus) String() string {
+	switch s {
+	case TaskStatusQueued:
+		return "queued"
+	case TaskStatusRunning:
+		return "running"
+	case TaskStatusDone:
+		return "done"
+	case TaskStatusFailed:
+		return "failed"
+	case TaskStatusCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+// taskState shared by all copies of a task since it added to dispatcher.
+type taskState struct {
+	mutex       sync.Mutex
+	taskUID     string
+	status      TaskStatus
+	isCancelled bool
+	out         OutData
+	hasOut      bool
+	cancel      context.CancelFunc // cancel context of running task
+	element     *list.Element      // element in lane queue when queued
+	doneCh      chan struct{}
+	subscribers []chan OutData // out chan of coalesced duplicate tasks
+}
+
+func newTaskState(taskUID string) *taskState {
+	return &taskState{
+		taskUID: taskUID,
+		status:  TaskStatusQueued,
+		doneCh:  make(chan struct{}),
+	}
+}
+
+func (s *taskState) isFinished() bool {
+	return s.status == TaskStatusDone || s.status == TaskStatusFailed || s.status == TaskStatusCancelled
+}
+
+func (s *taskState) setOut(out OutData) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	if !s.isFinished() {
+		s.out = out
+		s.hasOut = true
+	}
+	s.mutex.Unlock()
+}
+
+func (s *taskState) replied() bool {
+	if s == nil {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.hasOut
+}
+
+// setRunning set task running with cancel of its context, return false if task has been cancelled.
+func (s *taskState) setRunning(cancel context.CancelFunc) bool {
+	if s == nil {
+		return true
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.isCancelled {
+		return false
+	}
+
+	s.status = TaskStatusRunning
+	s.cancel = cancel
+
+	return true
+}
+
+func (s *taskState) cancelled() bool {
+	if s == nil {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.isCancelled
+}
+
+// finish set final status of task, out is used if task never reply.
+func (s *taskState) finish(status TaskStatus, out OutData) bool {
+	if s == nil {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.isFinished() {
+		return false
+	}
+
+	s.status = status
+	s.cancel = nil
+	s.element = nil
+	if !s.hasOut {
+		s.out = out
+		s.hasOut = true
+	}
+
+	close(s.doneCh)
+
+	return true
+}
+
+// Handle of a task added to dispatcher.
+type Handle struct {
+	dispatcher *Dispatcher
+	state      *taskState
+}
+
+// TaskUID get uid of task.
+func (h *Handle) TaskUID() string {
+	return h.state.taskUID
+}
+
+// Status get current status of task.
+func (h *Handle) Status() TaskStatus {
+	h.state.mutex.Lock()
+	defer h.state.mutex.Unlock()
+
+	return h.state.status
+}
+
+// Done get a chan which closed when task finished.
+func (h *Handle) Done() <-chan struct{} {
+	return h.state.doneCh
+}
+
+// Wait task finish and get its result, result is the data task replied, or error of task
+// if it never reply.
+func (h *Handle) Wait(ctx context.Context) (OutData, error) {
+	select {
+	case <-h.state.doneCh:
+		h.state.mutex.Lock()
+		defer h.state.mutex.Unlock()
+
+		return h.state.out, nil
+	case <-ctx.Done():
+		return OutData{}, ctx.Err()
+	}
+}
+
+// Cancel task, a queued task will be skipped, context of a running task will be cancelled,
+// return false if task has finished.
+func (h *Handle) Cancel() bool {
+	return h.dispatcher.cancelTask(h.state)
+}
+
+func (d *Dispatcher) register(s *taskState) {
+	d.taskMutex.Lock()
+	d.taskMap[s.taskUID] = s
+	d.taskMutex.Unlock()
+}
+
+func (d *Dispatcher) unregister(s *taskState) {
+	d.taskMutex.Lock()
+	if d.taskMap[s.taskUID] == s {
+		delete(d.taskMap, s.taskUID)
+		d.remember(s)
+	}
+	d.taskMutex.Unlock()
+}
+
+// push task to tail of lane queue, must hold dispatcher lock.
+func (d *Dispatcher) push(l *lane, t Task) {
+	t.limitKey = d.limiter.key(t.InData)
+	e := l.queue.PushBack(t)
+
+	if t.state != nil {
+		t.state.mutex.Lock()
+		t.state.element = e
+		t.state.mutex.Unlock()
+	}
+}
+
+// finishTask set final status of task and remove it from registry.
+func (d *Dispatcher) finishTask(t Task, status TaskStatus, out OutData) {
+	if t.state.finish(status, out) {
+		d.unregister(t.state)
+
+		t.state.mutex.Lock()
+		out = t.state.out
+		t.state.mutex.Unlock()
+
+		t.state.notifySubscribers(out)
+	}
+}
+
+// taskCancelled a task cancelled before or when running, it is not acked if cancelled by
+// shutdown abandon, so Recover can run it again.
+func (d *Dispatcher) taskCancelled(t Task) {
+	d.mutex.Lock()
+	isAbandoned := d.abandoned
+	d.mutex.Unlock()
+
+	if !isAbandoned {
+		d.ack(t)
+	}
+
+	atomic.AddUint64(&(d.totalCancelTask), 1)
+	d.finishTask(t, TaskStatusCancelled, OutData{Err: ErrorOfTaskCancelled, Attempts: t.Attempt})
+}
+
+func (d *Dispatcher) cancelTask(s *taskState) bool {
+	d.mutex.Lock()
+	s.mutex.Lock()
+
+	if s.isFinished() || s.isCancelled {
+		s.mutex.Unlock()
+		d.mutex.Unlock()
+		return false
+	}
+
+	s.isCancelled = true
+	cancel := s.cancel
+
+	var t Task
+	var isQueued bool
+	var isRetrying bool
+	if s.element != nil {
+		t = s.element.Value.(Task)
+		t.lane.queue.Remove(s.element)
+		d.checkLane(t.lane)
+		d.updateState()
+		s.element = nil
+		isQueued = true
+	} else {
+		// waiting backoff, finish it now instead of when timer fired
+		for id, rt := range d.retrying {
+			if rt.task.state != s {
+				continue
+			}
+
+			if rt.timer != nil {
+				rt.timer.Stop()
+			}
+
+			delete(d.retrying, id)
+			t = rt.task
+			isRetrying = true
+			break
+		}
+	}
+
+	s.mutex.Unlock()
+	d.mutex.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+
+	if isQueued || isRetrying {
+		t.tryReply(OutData{Err: ErrorOfTaskCancelled})
+		d.taskCancelled(t)
+	}
+
+	if isRetrying {
+		atomic.AddInt64(&(d.retryingNum), -1)
+	}
+
+	return true
+}
+
+// GetHandle get handle of a queued or running task by uid.
+func (d *Dispatcher) GetHandle(taskUID string) (*Handle, bool) {
+	d.taskMutex.Lock()
+	defer d.taskMutex.Unlock()
+
+	s, ok := d.taskMap[taskUID]
+	if !ok {
+		return nil, false
+	}
+
+	return &Handle{dispatcher: d, state: s}, true
+}
+
+// CancelTask cancel a queued or running task by uid, return false if not found.
+func (d *Dispatcher) CancelTask(taskUID string) bool {
+	h, ok := d.GetHandle(taskUID)
+	if !ok {
+		return false
+	}
+
+	return h.Cancel()
+}
+
+// GetTotalCancelTask get total number of job cancelled since dispatcher start.
+func (d *Dispatcher) GetTotalCancelTask() uint64 {
+	return atomic.LoadUint64(&(d.totalCancelTask))
+}
@@ -0,0 +1,173 @@
+package dispatcher
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// WorkerExitReason why a worker quit.
+type WorkerExitReason int
+
+// worker exit reason enum
+const (
+	WorkerExitStop   WorkerExitReason = iota // dispatcher shutdown
+	WorkerExitIdle                           // retired because of idle
+	WorkerExitPanic                          // replaced after task panic
+	WorkerExitResize                         // retired because max workers decreased
+)
+
+func (r WorkerExitReason) String() string {
+	switch r {
+	case WorkerExitStop:
+		return "stop"
+	case WorkerExitIdle:
+		return "idle"
+	case WorkerExitPanic:
+		return "panic"
+	case WorkerExitResize:
+		return "resize"
+	default:
+		return "unknown"
+	}
+}
+
+// Hooks receive events of dispatcher, methods are called synchronously by dispatcher and workers,
+// so they should be quick. Embed NopHooks to implement only some of them.
+type Hooks interface {
+	// OnEnqueue a task added to queue.
+	OnEnqueue(t Task)
+	// OnStart a worker start an attempt of task, the returned context is passed to workDo,
+	// so it can carry a span for workDo to attach child spans. Tasks of a batch share the
+	// batch context, the returned one is only passed to OnFinish.
+	OnStart(ctx context.Context, t Task) context.Context
+	// OnFinish an attempt of task finished, ctx is the one returned by OnStart,
+	// cost is the time operated by worker.
+	OnFinish(ctx context.Context, t Task, err error, cost time.Duration)
+	// OnRefuse a task not added, err tells why.
+	OnRefuse(t Task, err error)
+	// OnStateChange dispatcher state changed, it is called in order in a separate goroutine.
+	OnStateChange(old State, new State)
+	// OnWorkerExit a worker quit.
+	OnWorkerExit(workerID int, reason WorkerExitReason)
+}
+
+// NopHooks ignore all events.
+type NopHooks struct{}
+
+// OnEnqueue implement Hooks.
+func (NopHooks) OnEnqueue(t Task) {}
+
+// OnStart implement Hooks.
+func (NopHooks) OnStart(ctx context.Context, t Task) context.Context { return ctx }
+
+// OnFinish implement Hooks.
+func (NopHooks) OnFinish(ctx context.Context, t Task, err error, cost time.Duration) {}
+
+// OnRefuse implement Hooks.
+func (NopHooks) OnRefuse(t Task, err error) {}
+
+// OnStateChange implement Hooks.
+func (NopHooks) OnStateChange(old State, new State) {}
+
+// OnWorkerExit implement Hooks.
+func (NopHooks) OnWorkerExit(workerID int, reason WorkerExitReason) {}
+
+// multiHooks call hooks in order, context returned by OnStart is passed to the next one.
+type multiHooks []Hooks
+
+// MultiHooks combine hooks, they are called in order, nil hooks are ignored.
+func MultiHooks(list ...Hooks) Hooks {
+	var m multiHooks
+	for _, h := range list {
+		if h == nil {
+			continue
+		}
+
+		if inner, ok := h.(multiHooks); ok {
+			m = append(m, inner...)
+		} else {
+			m = append(m, h)
+		}
+	}
+
+	switch len(m) {
+	case 0:
+		return NopHooks{}
+	case 1:
+		return m[0]
+	default:
+		return m
+	}
+}
+
+func (m multiHooks) OnEnqueue(t Task) {
+	for _, h := range m {
+		h.OnEnqueue(t)
+	}
+}
+
+func (m multiHooks) OnStart(ctx context.Context, t Task) context.Context {
+	for _, h := range m {
+		ctx = h.OnStart(ctx, t)
+	}
+
+	return ctx
+}
+
+func (m multiHooks) OnFinish(ctx context.Context, t Task, err error, cost time.Duration) {
+	for i := len(m) - 1; i >= 0; i-- {
+		m[i].OnFinish(ctx, t, err, cost)
+	}
+}
+
+func (m multiHooks) OnRefuse(t Task, err error) {
+	for _, h := range m {
+		h.OnRefuse(t, err)
+	}
+}
+
+func (m multiHooks) OnStateChange(old State, new State) {
+	for _, h := range m {
+		h.OnStateChange(old, new)
+	}
+}
+
+func (m multiHooks) OnWorkerExit(workerID int, reason WorkerExitReason) {
+	for _, h := range m {
+		h.OnWorkerExit(workerID, reason)
+	}
+}
+
+// stateFuncHooks adapt Config.OnStateChange to hooks.
+type stateFuncHooks struct {
+	NopHooks
+	f func(old State, new State)
+}
+
+func (s stateFuncHooks) OnStateChange(old State, new State) {
+	s.f(old, new)
+}
+
+// tranceHooks log task cost and print status when refused, used when Config.IsTrance.
+type tranceHooks struct {
+	NopHooks
+	d *Dispatcher
+}
+
+func (h tranceHooks) OnFinish(ctx context.Context, t Task, err error, cost time.Duration) {
+	h.d.logf("from dispatcher, module: %s, jobID : %s, attempt : %d, cost %s, error : %v",
+		h.d.name, t.InData.TaskUID, t.Attempt, diffTimeStrapToShow(t.StartTime, t.EndTime), err)
+}
+
+func (h tranceHooks) OnRefuse(t Task, err error) {
+	var status strings.Builder
+	h.d.WriteStatus(&status)
+
+	h.d.logf("from dispatcher, module: %s, jobID : %s, refused : %s%s",
+		h.d.name, t.InData.TaskUID, err, strings.TrimRight(status.String(), "\n"))
+}
+
+func (h tranceHooks) OnWorkerExit(workerID int, reason WorkerExitReason) {
+	h.d.logf("from dispatcher, module: %s, workerID : %d, exit : %s", h.d.name, workerID, reason)
+}
@@ -0,0 +1,156 @@
+package hooks_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+	"github.com/ezgroot/ezUtils/dispatcher/hooks"
+)
+
+type span struct {
+	name   string
+	parent *span
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+}
+
+func (s *span) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *span) RecordError(err error)                      { s.err = err }
+func (s *span) End()                                       { s.ended = true }
+
+type tracer struct {
+	mutex sync.Mutex
+	spans []*span
+}
+
+func (tr *tracer) start(ctx context.Context, name string) (context.Context, hooks.Span) {
+	s := &span{name: name, attrs: make(map[string]interface{})}
+	if parent, ok := hooks.SpanFromContext(ctx).(*span); ok {
+		s.parent = parent
+	}
+
+	tr.mutex.Lock()
+	tr.spans = append(tr.spans, s)
+	tr.mutex.Unlock()
+
+	return ctx, s
+}
+
+type recorder struct {
+	dispatcher.NopHooks
+	mutex  sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(format string, v ...interface{}) {
+	r.mutex.Lock()
+	r.events = append(r.events, fmt.Sprintf(format, v...))
+	r.mutex.Unlock()
+}
+
+func (r *recorder) OnEnqueue(t dispatcher.Task) { r.add("enqueue %s", t.InData.TaskUID) }
+
+func (r *recorder) OnStart(ctx context.Context, t dispatcher.Task) context.Context {
+	r.add("start %s %d", t.InData.TaskUID, t.Attempt)
+	return ctx
+}
+
+func (r *recorder) OnFinish(ctx context.Context, t dispatcher.Task, err error, cost time.Duration) {
+	r.add("finish %s %d %v", t.InData.TaskUID, t.Attempt, err)
+}
+
+func (r *recorder) OnRefuse(t dispatcher.Task, err error) { r.add("refuse %s", t.InData.TaskUID) }
+
+func (r *recorder) OnWorkerExit(workerID int, reason dispatcher.WorkerExitReason) {
+	r.add("exit %d %s", workerID, reason)
+}
+
+func TestHooks(t *testing.T) {
+	tr := &tracer{}
+	rec := &recorder{}
+
+	c := dispatcher.Config{
+		Name:         "hooks",
+		MaxWorkerNum: 1,
+		Retry:        &dispatcher.RetryPolicy{MaxAttempts: 2},
+		Hooks:        dispatcher.MultiHooks(rec, hooks.NewTrace("hooks", hooks.TracerFunc(tr.start))),
+	}
+
+	d := dispatcher.GetDispatch(c, func(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+		// workDo attach a child span
+		_, child := tr.start(ctx, "child")
+		child.End()
+
+		if task.Attempt == 1 {
+			return errors.New("first attempt")
+		}
+
+		return nil
+	}, nil)
+
+	h, err := d.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: "task"}})
+	if err != nil {
+		t.Fatalf("submit error = %s", err)
+	}
+
+	if _, err = d.Submit(dispatcher.Task{InData: dispatcher.InData{TaskUID: "task"}, Lane: "none"}); err == nil {
+		t.Fatalf("submit to not exist lane")
+	}
+
+	if _, err = h.Wait(context.Background()); err != nil {
+		t.Fatalf("wait error = %s", err)
+	}
+
+	if err = d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown error = %s", err)
+	}
+
+	want := []string{
+		"enqueue task",
+		"refuse task",
+		"start task 1",
+		"finish task 1 first attempt",
+		"start task 2",
+		"finish task 2 <nil>",
+		"exit 0 stop",
+	}
+
+	rec.mutex.Lock()
+	got := fmt.Sprint(rec.events)
+	rec.mutex.Unlock()
+
+	if got != fmt.Sprint(want) {
+		t.Fatalf("events = %s, want %s", got, want)
+	}
+
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+
+	if len(tr.spans) != 4 {
+		t.Fatalf("spans = %d, want 4", len(tr.spans))
+	}
+
+	for i, s := range tr.spans {
+		if !s.ended {
+			t.Errorf("span %d not ended", i)
+		}
+
+		if i%2 == 0 && (s.name != "dispatcher.hooks" || s.attrs["task.uid"] != "task" || s.attrs["task.attempt"] != i/2+1) {
+			t.Errorf("span %d = %s %v", i, s.name, s.attrs)
+		}
+
+		if i%2 == 1 && s.parent != tr.spans[i-1] {
+			t.Errorf("child span %d not linked to task span", i)
+		}
+	}
+
+	if tr.spans[0].err == nil || tr.spans[2].err != nil {
+		t.Errorf("span errors = %v, %v", tr.spans[0].err, tr.spans[2].err)
+	}
+}
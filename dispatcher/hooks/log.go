@@ -0,0 +1,69 @@
+package hooks
+
+import (
+	"context"
+	"time"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+	"github.com/ezgroot/ezUtils/zlog"
+)
+
+type logFunc func(msg string, v ...interface{})
+
+type logHooks struct {
+	name  string
+	debug logFunc
+	info  logFunc
+	warn  logFunc
+}
+
+// NewLog create hooks which log events by zlog in json format, to file if isFile otherwise
+// to screen. Enqueue and start of task are logged in debug level, refused tasks, failed tasks
+// and panic workers in warn level, others in info level.
+func NewLog(name string, isFile bool) dispatcher.Hooks {
+	if isFile {
+		return &logHooks{name: name, debug: zlog.DebugfJs, info: zlog.InfofJs, warn: zlog.WarnfJs}
+	}
+
+	return &logHooks{name: name, debug: zlog.DebugJs, info: zlog.InfoJs, warn: zlog.WarnJs}
+}
+
+func (h *logHooks) OnEnqueue(t dispatcher.Task) {
+	h.debug("dispatcher task enqueue", "dispatcher", h.name, "task", t.InData.TaskUID, "lane", t.Lane)
+}
+
+func (h *logHooks) OnStart(ctx context.Context, t dispatcher.Task) context.Context {
+	h.debug("dispatcher task start", "dispatcher", h.name, "task", t.InData.TaskUID, "lane", t.Lane,
+		"attempt", t.Attempt)
+
+	return ctx
+}
+
+func (h *logHooks) OnFinish(ctx context.Context, t dispatcher.Task, err error, cost time.Duration) {
+	if err != nil {
+		h.warn("dispatcher task failed", "dispatcher", h.name, "task", t.InData.TaskUID, "lane", t.Lane,
+			"attempt", t.Attempt, "cost", cost.String(), "error", err.Error())
+		return
+	}
+
+	h.info("dispatcher task finish", "dispatcher", h.name, "task", t.InData.TaskUID, "lane", t.Lane,
+		"attempt", t.Attempt, "cost", cost.String())
+}
+
+func (h *logHooks) OnRefuse(t dispatcher.Task, err error) {
+	h.warn("dispatcher task refused", "dispatcher", h.name, "task", t.InData.TaskUID, "lane", t.Lane,
+		"error", err.Error())
+}
+
+func (h *logHooks) OnStateChange(old dispatcher.State, new dispatcher.State) {
+	h.info("dispatcher state change", "dispatcher", h.name, "old", int(old), "new", int(new))
+}
+
+func (h *logHooks) OnWorkerExit(workerID int, reason dispatcher.WorkerExitReason) {
+	if reason == dispatcher.WorkerExitPanic {
+		h.warn("dispatcher worker exit", "dispatcher", h.name, "worker", workerID, "reason", reason.String())
+		return
+	}
+
+	h.info("dispatcher worker exit", "dispatcher", h.name, "worker", workerID, "reason", reason.String())
+}
@@ -0,0 +1,80 @@
+// Package hooks adapters of dispatcher.Hooks, log events by zlog and create spans like OpenTelemetry.
+package hooks
+
+import (
+	"context"
+	"time"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+)
+
+// Span a span of trace, like OpenTelemetry span.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// Tracer create spans, the returned context should carry the span, so child spans created
+// from it are linked, OpenTelemetry tracer can be wrapped by TracerFunc.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// TracerFunc adapt a function to Tracer.
+type TracerFunc func(ctx context.Context, name string) (context.Context, Span)
+
+// Start implement Tracer.
+func (f TracerFunc) Start(ctx context.Context, name string) (context.Context, Span) {
+	return f(ctx, name)
+}
+
+type spanKey struct{}
+
+// ContextWithSpan get a context carry span.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext get span of task in workDo, nil if not traced.
+func SpanFromContext(ctx context.Context) Span {
+	span, _ := ctx.Value(spanKey{}).(Span)
+
+	return span
+}
+
+type traceHooks struct {
+	dispatcher.NopHooks
+	name   string
+	tracer Tracer
+}
+
+// NewTrace create hooks which start a span for every attempt of task, span is named
+// "dispatcher.<name>" and ended when attempt finished, workDo get it by SpanFromContext.
+func NewTrace(name string, tracer Tracer) dispatcher.Hooks {
+	return &traceHooks{name: name, tracer: tracer}
+}
+
+func (h *traceHooks) OnStart(ctx context.Context, t dispatcher.Task) context.Context {
+	ctx, span := h.tracer.Start(ctx, "dispatcher."+h.name)
+	span.SetAttribute("task.uid", t.InData.TaskUID)
+	span.SetAttribute("task.lane", t.Lane)
+	span.SetAttribute("task.attempt", t.Attempt)
+	span.SetAttribute("task.wait", time.Duration(t.RunTime-t.StartTime))
+
+	return ContextWithSpan(ctx, span)
+}
+
+func (h *traceHooks) OnFinish(ctx context.Context, t dispatcher.Task, err error, cost time.Duration) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	span.SetAttribute("task.cost", cost)
+	span.End()
+}
@@ -0,0 +1,89 @@
+package dispatcher
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// runSynchronous create the only worker which operate tasks inline, see Config.Synchronous.
+func (d *Dispatcher) runSynchronous() {
+	res := d.resource
+	if d.newResource != nil {
+		var err error
+		res, err = d.newResource()
+		if err != nil {
+			d.logf("dispatcher = %s create worker resource error = %s", d.name, err)
+		}
+	}
+
+	d.inline = newWorker(d, 0, d.workDo, res)
+	d.inline.ownResource = d.newResource != nil
+	d.addWorker(d.inline)
+
+	atomic.StoreInt32(&(d.workerNum), 1)
+	atomic.AddUint64(&(d.totalScaleUp), 1)
+
+	// inline worker is released when dispatcher stop like others
+	d.workerWg.Add(1)
+	go func() {
+		<-d.quitCh
+		d.inline.release()
+	}()
+
+	go d.runSchedule()
+
+	if d.isHooked {
+		go d.notifyState()
+	}
+}
+
+// runInline operate queued tasks by the inline worker until queue empty. Only one goroutine
+// operate tasks at a time, others mark dirty and return, so the running one loop again.
+func (d *Dispatcher) runInline() {
+	atomic.StoreInt32(&(d.inlineDirty), 1)
+
+	for atomic.LoadInt32(&(d.inlineDirty)) == 1 {
+		if d.IsPaused() || d.inline.isPaused() || !atomic.CompareAndSwapInt32(&(d.inlineRunning), 0, 1) {
+			return
+		}
+
+		atomic.StoreInt32(&(d.inlineDirty), 0)
+
+		var wait time.Duration
+		for !d.IsPaused() && !d.inline.isPaused() {
+			task, w, ok := d.nextTask()
+			if !ok {
+				wait = w
+				break
+			}
+
+			if d.batchDo == nil {
+				d.inline.doTask(task)
+				d.taskFinish(task)
+				continue
+			}
+
+			// never linger, since no other goroutine add tasks when waiting
+			tasks := []Task{task}
+			for len(tasks) < d.batchSize {
+				if task, _, ok = d.nextTask(); !ok {
+					break
+				}
+
+				tasks = append(tasks, task)
+			}
+
+			d.inline.doBatch(tasks)
+			for _, task := range tasks {
+				d.taskFinish(task)
+			}
+		}
+
+		atomic.StoreInt32(&(d.inlineRunning), 0)
+
+		// tasks limited by rate wait token
+		if wait > 0 {
+			d.clock.AfterFunc(wait, d.runInline)
+		}
+	}
+}
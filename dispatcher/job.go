@@ -14,10 +14,11 @@ type InData struct {
 
 // OutData of Task.
 type OutData struct {
-	Code int
-	Err  error
-	Data []byte
-	If   interface{}
+	Code     int
+	Err      error
+	Data     []byte
+	If       interface{}
+	Attempts int // attempt times of task when the result send
 }
 
 // Task that worker to operate.
@@ -26,6 +27,45 @@ type Task struct {
 	InData      InData
 	OutCh       chan OutData
 	TimeOut     time.Duration // per - Millisecond
-	StartTime   int64
+	Lane        string        // lane name of task, empty means the first lane
+	Retry       *RetryPolicy  // retry policy of task, nil means use Config.Retry
+	Attempt     int           // current attempt times, start from 1
+	StartTime   int64         // time queued, per - Nanosecond of dispatcher clock, like RunTime and EndTime
+	RunTime     int64         // time current attempt start
 	EndTime     int64
+
+	lane     *lane
+	storeSeq uint64
+	runID    uint64 // key of Dispatcher.running since popped from queue
+	state    *taskState
+	limitKey string
+}
+
+// Reply send result data to task out chan if need, with attempt times of task.
+// Handle.Wait and out chan of coalesced duplicate tasks also get the replied data.
+func (t Task) Reply(out OutData) {
+	out.Attempts = t.Attempt
+	t.state.setOut(out)
+
+	if t.OutCh != nil {
+		t.OutCh <- out
+	}
+
+	t.state.notifySubscribers(out)
+}
+
+// tryReply like Reply, but not block when out chan is not being read, used when the task is
+// finished outside of worker, such as cancelled in queue, and the caller may never read out chan.
+func (t Task) tryReply(out OutData) {
+	out.Attempts = t.Attempt
+	t.state.setOut(out)
+
+	if t.OutCh != nil {
+		select {
+		case t.OutCh <- out:
+		default:
+		}
+	}
+
+	t.state.notifySubscribers(out)
 }
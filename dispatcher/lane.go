@@ -0,0 +1,104 @@
+package dispatcher
+
+import (
+	"container/list"
+	"errors"
+	"sync/atomic"
+)
+
+const (
+	defaultLaneName   = "default"
+	defaultLaneWeight = 1
+)
+
+// ErrorOfLaneNotExist task lane is not configured in dispatcher.
+var ErrorOfLaneNotExist = errors.New("dispatcher lane not exist")
+
+// LaneConfig config of a task lane, tasks in different lanes share workers by weight.
+type LaneConfig struct {
+	Name       string
+	Weight     int // share of workers compared with other lanes, default 1
+	MaxTaskNum int // max queued task of this lane, default Config.MaxTaskNum
+}
+
+// lane a queue of tasks with its own state and counters.
+type lane struct {
+	name       string
+	weight     int
+	current    int // smooth weighted round robin current weight
+	maxTaskNum int
+	isDefault  bool // max task number is Config.MaxTaskNum
+	queue      *list.List
+	state      State
+	blocked    limitScan // tasks of queue blocked by limiter
+
+	totalInTask      uint64
+	totalDoneTask    uint64
+	totalErrorTask   uint64
+	totalRefusedTask uint64
+}
+
+func newLane(c LaneConfig, defaultMaxTaskNum int) *lane {
+	if c.Name == "" {
+		c.Name = defaultLaneName
+	}
+
+	if c.Weight <= 0 {
+		c.Weight = defaultLaneWeight
+	}
+
+	isDefault := c.MaxTaskNum <= 0
+	if isDefault {
+		c.MaxTaskNum = defaultMaxTaskNum
+	}
+
+	return &lane{
+		name:       c.Name,
+		weight:     c.Weight,
+		maxTaskNum: c.MaxTaskNum,
+		isDefault:  isDefault,
+		queue:      list.New(),
+		state:      StateOfNormal,
+	}
+}
+
+// headWait get how long the first task has waited, must hold dispatcher lock.
+func (l *lane) headWait(now int64) int64 {
+	e := l.queue.Front()
+	if e == nil {
+		return -1
+	}
+
+	return now - e.Value.(Task).StartTime
+}
+
+func (l *lane) pop() Task {
+	return l.queue.Remove(l.queue.Front()).(Task)
+}
+
+// LaneStatus status of a task lane.
+type LaneStatus struct {
+	Name             string
+	Weight           int
+	State            State
+	MaxTaskNum       int
+	TaskTodoNum      int
+	TotalInTask      uint64
+	TotalDoneTask    uint64
+	TotalErrorTask   uint64
+	TotalRefusedTask uint64
+}
+
+func (l *lane) status() LaneStatus {
+	return LaneStatus{
+		Name:             l.name,
+		Weight:           l.weight,
+		State:            l.state,
+		MaxTaskNum:       l.maxTaskNum,
+		TaskTodoNum:      l.queue.Len(),
+		TotalInTask:      atomic.LoadUint64(&(l.totalInTask)),
+		TotalDoneTask:    atomic.LoadUint64(&(l.totalDoneTask)),
+		TotalErrorTask:   atomic.LoadUint64(&(l.totalErrorTask)),
+		TotalRefusedTask: atomic.LoadUint64(&(l.totalRefusedTask)),
+	}
+}
@@ -0,0 +1,326 @@
+package dispatcher
+
+import (
+	"container/list"
+	"time"
+)
+
+// defaultLimitPruneTime period to forget idle keys of limiter.
+const defaultLimitPruneTime = time.Minute
+
+// RateLimit token bucket limit of how fast tasks start.
+type RateLimit struct {
+	Rate  float64 // tasks per second
+	Burst int     // max tasks start at once, default 1
+}
+
+// tokenBucket a token bucket refilled by time.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   int64 // per - Nanosecond
+}
+
+func newTokenBucket(r *RateLimit, now int64) *tokenBucket {
+	if r == nil || r.Rate <= 0 {
+		return nil
+	}
+
+	burst := float64(r.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{rate: r.Rate, burst: burst, tokens: burst, last: now}
+}
+
+func (b *tokenBucket) refill(now int64) {
+	if now > b.last {
+		b.tokens += time.Duration(now-b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+
+	b.last = now
+}
+
+// wait get how long until a token is available, 0 means available now.
+func (b *tokenBucket) wait(now int64) time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take() {
+	if b != nil {
+		b.tokens--
+	}
+}
+
+func (b *tokenBucket) isFull(now int64) bool {
+	if b == nil {
+		return true
+	}
+
+	b.refill(now)
+
+	return b.tokens >= b.burst
+}
+
+// keyLimit limit state of a task key.
+type keyLimit struct {
+	bucket     *tokenBucket
+	runningNum int
+}
+
+// limiter hold tasks in queue when they exceed rate or concurrency limit,
+// all methods must hold dispatcher lock.
+type limiter struct {
+	bucket        *tokenBucket
+	keyFunc       func(in InData) string
+	keyRate       *RateLimit
+	maxKeyRunning int
+	keys          map[string]*keyLimit
+	lastPrune     int64
+	releaseNum    uint64 // running tasks of keys released, which may unblock queued tasks
+}
+
+// limitScan result of the last head scan of a lane which found no task allowed, tasks before
+// last are still blocked until a running task of key released or time until reached, so only tasks
+// pushed after last need scan again.
+type limitScan struct {
+	last       *list.Element // nil means not blocked
+	releaseNum uint64
+	until      int64 // per - Nanosecond, 0 means wait a running task released
+}
+
+// wait get how long blocked tasks wait from now.
+func (s limitScan) wait(now int64) time.Duration {
+	if s.until == 0 {
+		return -1
+	}
+
+	return time.Duration(s.until - now)
+}
+
+func newLimiter(c Config, now int64) *limiter {
+	l := &limiter{
+		bucket:        newTokenBucket(c.RateLimit, now),
+		keyFunc:       c.LimitKey,
+		keyRate:       c.KeyRateLimit,
+		maxKeyRunning: c.MaxKeyRunningNum,
+		keys:          make(map[string]*keyLimit),
+		lastPrune:     now,
+	}
+
+	if l.keyFunc == nil || (newTokenBucket(l.keyRate, now) == nil && l.maxKeyRunning <= 0) {
+		l.keyFunc = nil
+	}
+
+	if l.bucket == nil && l.keyFunc == nil {
+		return nil
+	}
+
+	return l
+}
+
+// key get limit key of task, empty means task only limited by dispatcher rate.
+func (l *limiter) key(in InData) string {
+	if l == nil || l.keyFunc == nil {
+		return ""
+	}
+
+	return l.keyFunc(in)
+}
+
+// wait get how long until dispatcher rate allow a task to start.
+func (l *limiter) wait(now int64) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	return l.bucket.wait(now)
+}
+
+// keyWait get how long until task key allow task to start, negative means wait a running task finish.
+func (l *limiter) keyWait(t Task, now int64) time.Duration {
+	if t.limitKey == "" {
+		return 0
+	}
+
+	k, ok := l.keys[t.limitKey]
+	if !ok {
+		return 0
+	}
+
+	if l.maxKeyRunning > 0 && k.runningNum >= l.maxKeyRunning {
+		return -1
+	}
+
+	return k.bucket.wait(now)
+}
+
+// head get the first task of lane allowed to start, or how long to wait if none.
+func (l *limiter) head(ln *lane, now int64) (*list.Element, time.Duration) {
+	if l == nil || l.keyFunc == nil {
+		return ln.queue.Front(), 0
+	}
+
+	var wait time.Duration
+	start := ln.queue.Front()
+
+	s := ln.blocked
+	if s.last != nil && s.releaseNum == l.releaseNum && (s.until == 0 || now < s.until) {
+		if s.last == ln.queue.Back() {
+			return nil, s.wait(now)
+		}
+
+		// next is nil if last has been removed from queue, then scan all again
+		if next := s.last.Next(); next != nil {
+			start = next
+			wait = s.wait(now)
+		}
+	}
+
+	for e := start; e != nil; e = e.Next() {
+		w := l.keyWait(e.Value.(Task), now)
+		if w == 0 {
+			l.block(ln, e.Prev(), wait, now)
+			return e, 0
+		}
+
+		wait = minLimitWait(wait, w)
+	}
+
+	l.block(ln, ln.queue.Back(), wait, now)
+
+	return nil, wait
+}
+
+// block remember tasks of lane until last are blocked for wait.
+func (l *limiter) block(ln *lane, last *list.Element, wait time.Duration, now int64) {
+	ln.blocked = limitScan{}
+	if last == nil || wait == 0 {
+		return
+	}
+
+	ln.blocked = limitScan{last: last, releaseNum: l.releaseNum}
+	if wait > 0 {
+		ln.blocked.until = now + int64(wait)
+	}
+}
+
+func (l *limiter) acquire(t Task, now int64) {
+	if l == nil {
+		return
+	}
+
+	l.bucket.take()
+
+	if t.limitKey == "" {
+		return
+	}
+
+	k, ok := l.keys[t.limitKey]
+	if !ok {
+		k = &keyLimit{bucket: newTokenBucket(l.keyRate, now)}
+		l.keys[t.limitKey] = k
+	}
+
+	k.bucket.take()
+	k.runningNum++
+}
+
+func (l *limiter) release(t Task, now int64) {
+	if l == nil || t.limitKey == "" {
+		return
+	}
+
+	if k, ok := l.keys[t.limitKey]; ok {
+		l.releaseNum++
+		k.runningNum--
+		if k.runningNum <= 0 && k.bucket == nil {
+			delete(l.keys, t.limitKey)
+		}
+	}
+
+	if now-l.lastPrune < int64(defaultLimitPruneTime) {
+		return
+	}
+
+	l.lastPrune = now
+	for key, k := range l.keys {
+		if k.runningNum <= 0 && k.bucket.isFull(now) {
+			delete(l.keys, key)
+		}
+	}
+}
+
+// minLimitWait merge wait time, positive wait is preferred since it will end by itself.
+func minLimitWait(a, b time.Duration) time.Duration {
+	switch {
+	case a == 0:
+		return b
+	case b == 0:
+		return a
+	case a > 0 && b > 0:
+		if a < b {
+			return a
+		}
+
+		return b
+	case a > 0:
+		return a
+	default:
+		return b
+	}
+}
+
+// waitLimit wait tasks limited in queue may start, return false if dispatcher quit.
+func (d *Dispatcher) waitLimit(wait time.Duration) bool {
+	if wait == 0 {
+		return true
+	}
+
+	var timerCh <-chan time.Time
+	if wait > 0 {
+		timer := d.clock.NewTimer(wait)
+		defer timer.Stop()
+		timerCh = timer.C()
+	}
+
+	select {
+	case <-timerCh:
+	case <-d.wakeCh:
+	case <-d.quitCh:
+		return false
+	}
+
+	return true
+}
+
+// GetKeyRunningNum get current number of running tasks of a limit key.
+func (d *Dispatcher) GetKeyRunningNum(key string) int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.limiter == nil {
+		return 0
+	}
+
+	k, ok := d.limiter.keys[key]
+	if !ok {
+		return 0
+	}
+
+	return k.runningNum
+}
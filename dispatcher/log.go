@@ -0,0 +1,18 @@
+package dispatcher
+
+import "fmt"
+
+// Logger receive warnings of dispatcher, like zlog.Warn.
+type Logger func(format string, v ...interface{})
+
+// StdoutLogger print warnings to stdout.
+func StdoutLogger(format string, v ...interface{}) {
+	fmt.Printf("[WARN] "+format+"\n", v...)
+}
+
+// logf log a warning by Config.Logger, nothing is logged when it is nil.
+func (d *Dispatcher) logf(format string, v ...interface{}) {
+	if d.logger != nil {
+		d.logger(format, v...)
+	}
+}
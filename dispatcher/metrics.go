@@ -0,0 +1,299 @@
+package dispatcher
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHistogramBuckets upper bounds of task time histogram, per - second.
+var DefaultHistogramBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// MetricType type of metric.
+type MetricType string
+
+// metric type enum
+const (
+	MetricTypeCounter   MetricType = "counter"
+	MetricTypeGauge     MetricType = "gauge"
+	MetricTypeHistogram MetricType = "histogram"
+)
+
+// Bucket of histogram, count is cumulative.
+type Bucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+// Metric a sample of dispatcher statistics.
+type Metric struct {
+	Name   string
+	Help   string
+	Type   MetricType
+	Labels map[string]string
+	Value  float64 // value of counter and gauge
+
+	Buckets []Bucket // buckets of histogram, without +Inf
+	Sum     float64  // sum of histogram
+	Count   uint64   // count of histogram
+}
+
+// Collector collect metrics, not depend on any metrics registry.
+type Collector interface {
+	Collect(emit func(m Metric))
+}
+
+// Histogram count observed values in buckets.
+type Histogram struct {
+	mutex  sync.Mutex
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram create a histogram with bucket upper bounds.
+func NewHistogram(bounds []float64) *Histogram {
+	b := append([]float64(nil), bounds...)
+	sort.Float64s(b)
+
+	return &Histogram{bounds: b, counts: make([]uint64, len(b))}
+}
+
+// Observe a value.
+func (h *Histogram) Observe(v float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	i := sort.SearchFloat64s(h.bounds, v)
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+
+	h.sum += v
+	h.count++
+}
+
+// snapshot get cumulative buckets, sum and count.
+func (h *Histogram) snapshot() ([]Bucket, float64, uint64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	buckets := make([]Bucket, len(h.bounds))
+
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		buckets[i] = Bucket{UpperBound: bound, Count: cumulative}
+	}
+
+	return buckets, h.sum, h.count
+}
+
+// observe wait time and run time of a task, admission controller also observe them.
+func (d *Dispatcher) observe(t Task, runStart int64, err error) {
+	wait := time.Duration(runStart - t.StartTime)
+	run := time.Duration(t.EndTime - runStart)
+
+	d.waitHistogram.Observe(wait.Seconds())
+	d.runHistogram.Observe(run.Seconds())
+	d.admission.Observe(time.Unix(0, t.EndTime), wait, run, err)
+}
+
+// Collect metrics of dispatcher, labelled by dispatcher name and lane name.
+func (d *Dispatcher) Collect(emit func(m Metric)) {
+	labels := map[string]string{"dispatcher": d.GetName()}
+
+	counter := func(name string, help string, v uint64) {
+		emit(Metric{Name: name, Help: help, Type: MetricTypeCounter, Labels: labels, Value: float64(v)})
+	}
+
+	gauge := func(name string, help string, v float64) {
+		emit(Metric{Name: name, Help: help, Type: MetricTypeGauge, Labels: labels, Value: v})
+	}
+
+	for _, ls := range d.GetLanesStatus() {
+		laneLabels := map[string]string{"dispatcher": d.GetName(), "lane": ls.Name}
+
+		for _, m := range []Metric{
+			{Name: "dispatcher_tasks_in_total", Help: "Total number of tasks put in queue.",
+				Type: MetricTypeCounter, Value: float64(ls.TotalInTask)},
+			{Name: "dispatcher_tasks_done_total", Help: "Total number of tasks done.",
+				Type: MetricTypeCounter, Value: float64(ls.TotalDoneTask)},
+			{Name: "dispatcher_tasks_error_total", Help: "Total number of tasks failed.",
+				Type: MetricTypeCounter, Value: float64(ls.TotalErrorTask)},
+			{Name: "dispatcher_tasks_refused_total", Help: "Total number of tasks refused because of queue full.",
+				Type: MetricTypeCounter, Value: float64(ls.TotalRefusedTask)},
+			{Name: "dispatcher_queue_depth", Help: "Current number of tasks wait in queue.",
+				Type: MetricTypeGauge, Value: float64(ls.TaskTodoNum)},
+			{Name: "dispatcher_queue_capacity", Help: "Max number of tasks in queue.",
+				Type: MetricTypeGauge, Value: float64(ls.MaxTaskNum)},
+			{Name: "dispatcher_lane_state", Help: "State of lane, 0 normal, 1 half, 2 busy, 3 deny.",
+				Type: MetricTypeGauge, Value: float64(ls.State)},
+		} {
+			m.Labels = laneLabels
+			emit(m)
+		}
+	}
+
+	counter("dispatcher_tasks_cancelled_total", "Total number of tasks cancelled.", d.GetTotalCancelTask())
+	counter("dispatcher_tasks_panic_total", "Total number of tasks panic when run.", d.GetTotalPanicTask())
+	counter("dispatcher_tasks_duplicate_total", "Total number of tasks refused because of duplicate uid.", d.GetTotalDuplicateTask())
+	counter("dispatcher_tasks_coalesced_total", "Total number of tasks attached to an existing one with same uid.", d.GetTotalCoalescedTask())
+	counter("dispatcher_tasks_retry_total", "Total number of task retry attempts.", d.GetTotalRetryTask())
+	counter("dispatcher_workers_scale_up_total", "Total number of workers created.", d.GetTotalScaleUp())
+	counter("dispatcher_workers_scale_down_total", "Total number of workers retired because of idle.", d.GetTotalScaleDown())
+
+	gauge("dispatcher_state", "State of dispatcher, 0 normal, 1 half, 2 busy, 3 deny.", float64(d.GetState()))
+	gauge("dispatcher_workers", "Current number of workers.", float64(d.GetTotalWorkNum()))
+	gauge("dispatcher_workers_free", "Current number of free workers.", float64(d.GetCurrentFreeWorkerNum()))
+	gauge("dispatcher_tasks_running", "Current number of tasks dispatched to workers.", float64(d.GetCurrentRunningNum()))
+	gauge("dispatcher_tasks_retrying", "Current number of tasks wait backoff to retry.", float64(d.GetCurrentRetryingNum()))
+	gauge("dispatcher_tasks_scheduled", "Current number of delayed and cron tasks.", float64(d.GetCurrentScheduledNum()))
+
+	buckets, sum, count := d.waitHistogram.snapshot()
+	emit(Metric{Name: "dispatcher_task_wait_seconds", Help: "Time tasks wait in queue before run.",
+		Type: MetricTypeHistogram, Labels: labels, Buckets: buckets, Sum: sum, Count: count})
+
+	buckets, sum, count = d.runHistogram.snapshot()
+	emit(Metric{Name: "dispatcher_task_run_seconds", Help: "Time tasks run by workers.",
+		Type: MetricTypeHistogram, Labels: labels, Buckets: buckets, Sum: sum, Count: count})
+}
+
+// Exporter expose metrics of collectors in prometheus text format.
+type Exporter struct {
+	Logger Logger // receive write error of ServeHTTP, nil means not log it
+
+	mutex      sync.Mutex
+	collectors []Collector
+}
+
+// NewExporter create an exporter of collectors.
+func NewExporter(collectors ...Collector) *Exporter {
+	return &Exporter{collectors: collectors}
+}
+
+// Register a collector to exporter.
+func (e *Exporter) Register(c Collector) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.collectors = append(e.collectors, c)
+}
+
+// WriteText write metrics of all collectors in prometheus text format.
+func (e *Exporter) WriteText(w io.Writer) error {
+	e.mutex.Lock()
+	collectors := append([]Collector(nil), e.collectors...)
+	e.mutex.Unlock()
+
+	// metrics of same name must be grouped
+	var names []string
+	group := make(map[string][]Metric)
+	for _, c := range collectors {
+		c.Collect(func(m Metric) {
+			if _, ok := group[m.Name]; !ok {
+				names = append(names, m.Name)
+			}
+
+			group[m.Name] = append(group[m.Name], m)
+		})
+	}
+
+	bw := bufio.NewWriter(w)
+
+	for _, name := range names {
+		list := group[name]
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, escapeHelp(list[0].Help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, list[0].Type)
+
+		for _, m := range list {
+			if m.Type != MetricTypeHistogram {
+				fmt.Fprintf(bw, "%s%s %s\n", name, formatLabels(m.Labels, "", 0), formatFloat(m.Value))
+				continue
+			}
+
+			for _, b := range m.Buckets {
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", name, formatLabels(m.Labels, "le", b.UpperBound), b.Count)
+			}
+
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", name, formatLabels(m.Labels, "le", math.Inf(1)), m.Count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", name, formatLabels(m.Labels, "", 0), formatFloat(m.Sum))
+			fmt.Fprintf(bw, "%s_count%s %d\n", name, formatLabels(m.Labels, "", 0), m.Count)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// ServeHTTP implement http.Handler.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	err := e.WriteText(w)
+	if err != nil && e.Logger != nil {
+		e.Logger("write metrics error = %s", err)
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+// formatLabels format labels sorted by name, extra label is added if name not empty.
+func formatLabels(labels map[string]string, extraName string, extraValue float64) string {
+	if len(labels) == 0 && extraName == "" {
+		return ""
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString("{")
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+
+		sb.WriteString(k + `="` + labelEscaper.Replace(labels[k]) + `"`)
+	}
+
+	if extraName != "" {
+		if len(keys) > 0 {
+			sb.WriteString(",")
+		}
+
+		sb.WriteString(extraName + `="` + formatFloat(extraValue) + `"`)
+	}
+
+	sb.WriteString("}")
+
+	return sb.String()
+}
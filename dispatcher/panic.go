@@ -0,0 +1,63 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// PanicError workDo panic when operate task.
+type PanicError struct {
+	Value interface{} // value passed to panic
+	Stack []byte      // stack of goroutine when panic
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panic : %v\n%s", e.Value, e.Stack)
+}
+
+// safeDo call workDo and recover panic of it.
+func (w *Worker) safeDo(ctx context.Context, res Resource, task Task) (isPanic bool, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = w.recovered(v, task.InData.TaskUID)
+			isPanic = true
+		}
+	}()
+
+	// workDo will make sure send result data to job out chan if need
+	return false, w.workDo(ctx, res, task)
+}
+
+// recovered count and log a recovered panic, must be called in the deferred function.
+func (w *Worker) recovered(v interface{}, taskUID string) error {
+	atomic.AddUint64(&(w.dispatcher.totalPanicTask), 1)
+	w.dispatcher.logf("dispatcher = %s worker = %d task = %s panic : %v",
+		w.dispatcher.name, w.workerID, taskUID, v)
+
+	return &PanicError{Value: v, Stack: debug.Stack()}
+}
+
+// replace worker by a new one after panic, the state of worker and its resource may be broken,
+// worker retire itself after replaced.
+func (w *Worker) replace() {
+	atomic.AddInt32(&(w.dispatcher.workerNum), -1)
+	w.isRetire = true
+	w.exitReason = WorkerExitPanic
+
+	select {
+	case <-w.dispatcher.quitCh:
+		return
+	default:
+	}
+
+	if worker := w.dispatcher.scaleUp(); worker != nil {
+		w.dispatcher.putWorker(worker)
+	}
+}
+
+// GetTotalPanicTask get total number of job panic since dispatcher start.
+func (d *Dispatcher) GetTotalPanicTask() uint64 {
+	return atomic.LoadUint64(&(d.totalPanicTask))
+}
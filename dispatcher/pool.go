@@ -0,0 +1,463 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultPoolCheckPeriod  = time.Duration(30000) * time.Millisecond
+	defaultPoolCheckTimeout = time.Duration(3000) * time.Millisecond
+)
+
+// pool errors.
+var (
+	ErrorOfPoolClosed         = errors.New("resource pool has been closed")
+	ErrorOfPoolAcquireTimeout = errors.New("acquire resource from pool timeout")
+)
+
+// PoolConfig config of resource pool.
+type PoolConfig struct {
+	Name    string
+	MinSize int             // resources keep in pool, default 0
+	MaxSize int             // max resources created by pool, default MinSize, at least 1
+	New     ResourceFactory // create a resource
+	// CheckPeriod period to check idle resources by Resource.Check in background,
+	// broken resources are released and replaced, default 30s.
+	CheckPeriod  time.Duration
+	CheckTimeout time.Duration // timeout of a check, default 3s
+	// AcquireTimeout max time to wait a resource, default 0 means wait until context done.
+	AcquireTimeout time.Duration
+	Logger         Logger // receive warnings like resource release error, nil means not log them
+}
+
+// PoolStats statistics of resource pool.
+type PoolStats struct {
+	Size          int // resources created and not evicted
+	Idle          int
+	InUse         int
+	Waiting       int // number of acquire waiting
+	TotalCreated  uint64
+	TotalEvicted  uint64
+	TotalAcquired uint64
+	TotalTimeout  uint64
+}
+
+// ResourcePool resources shared by workers, set it to Config.ResourcePool, worker acquire a
+// resource before operate a task and put it back after.
+type ResourcePool struct {
+	name           string
+	minSize        int
+	maxSize        int
+	newResource    ResourceFactory
+	checkPeriod    time.Duration
+	checkTimeout   time.Duration
+	acquireTimeout time.Duration
+	logger         Logger
+
+	mutex    sync.Mutex
+	idle     []Resource
+	size     int
+	inUse    int
+	waiters  []chan Resource
+	isClosed bool
+	quitCh   chan struct{}
+
+	totalCreated  uint64
+	totalEvicted  uint64
+	totalAcquired uint64
+	totalTimeout  uint64
+}
+
+// NewResourcePool create a resource pool with min size resources and start health check.
+func NewResourcePool(c PoolConfig) (*ResourcePool, error) {
+	if c.New == nil {
+		return nil, errors.New("resource pool factory is nil")
+	}
+
+	if c.MinSize < 0 {
+		c.MinSize = 0
+	}
+
+	if c.MaxSize < c.MinSize {
+		c.MaxSize = c.MinSize
+	}
+
+	if c.MaxSize <= 0 {
+		c.MaxSize = 1
+	}
+
+	if c.CheckPeriod <= 0 {
+		c.CheckPeriod = defaultPoolCheckPeriod
+	}
+
+	if c.CheckTimeout <= 0 {
+		c.CheckTimeout = defaultPoolCheckTimeout
+	}
+
+	p := &ResourcePool{
+		name:           c.Name,
+		minSize:        c.MinSize,
+		maxSize:        c.MaxSize,
+		newResource:    c.New,
+		logger:         c.Logger,
+		checkPeriod:    c.CheckPeriod,
+		checkTimeout:   c.CheckTimeout,
+		acquireTimeout: c.AcquireTimeout,
+		quitCh:         make(chan struct{}),
+	}
+
+	for i := 0; i < p.minSize; i++ {
+		res, err := p.create()
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+
+		p.Put(res)
+	}
+
+	go p.checking()
+
+	return p, nil
+}
+
+// create a resource, size of pool is increased.
+func (p *ResourcePool) create() (Resource, error) {
+	p.mutex.Lock()
+	if p.isClosed {
+		p.mutex.Unlock()
+		return nil, ErrorOfPoolClosed
+	}
+
+	p.size++
+	p.inUse++
+	p.mutex.Unlock()
+
+	res, err := p.newResource()
+	if err != nil {
+		p.mutex.Lock()
+		p.size--
+		p.inUse--
+		p.mutex.Unlock()
+
+		return nil, fmt.Errorf("resource pool = %s create resource error : %s", p.name, err)
+	}
+
+	atomic.AddUint64(&(p.totalCreated), 1)
+
+	return res, nil
+}
+
+// Acquire get an idle resource, create one if pool not full, or wait one put back.
+func (p *ResourcePool) Acquire(ctx context.Context) (Resource, error) {
+	p.mutex.Lock()
+
+	if p.isClosed {
+		p.mutex.Unlock()
+		return nil, ErrorOfPoolClosed
+	}
+
+	if n := len(p.idle); n > 0 {
+		res := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.inUse++
+		p.mutex.Unlock()
+
+		atomic.AddUint64(&(p.totalAcquired), 1)
+		return res, nil
+	}
+
+	if p.size < p.maxSize {
+		p.mutex.Unlock()
+
+		res, err := p.create()
+		if err == nil {
+			atomic.AddUint64(&(p.totalAcquired), 1)
+		}
+
+		return res, err
+	}
+
+	waiter := make(chan Resource, 1)
+	p.waiters = append(p.waiters, waiter)
+	p.mutex.Unlock()
+
+	var timeoutCh <-chan time.Time
+	if p.acquireTimeout > 0 {
+		timer := time.NewTimer(p.acquireTimeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	var err error
+	select {
+	case res, ok := <-waiter:
+		if !ok {
+			return nil, ErrorOfPoolClosed
+		}
+
+		atomic.AddUint64(&(p.totalAcquired), 1)
+		return res, nil
+	case <-timeoutCh:
+		err = ErrorOfPoolAcquireTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	atomic.AddUint64(&(p.totalTimeout), 1)
+
+	p.mutex.Lock()
+	for i, w := range p.waiters {
+		if w == waiter {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			break
+		}
+	}
+	p.mutex.Unlock()
+
+	// resource may be sent before waiter removed
+	select {
+	case res, ok := <-waiter:
+		if ok {
+			p.Put(res)
+		}
+	default:
+	}
+
+	return nil, err
+}
+
+// Put a resource back to pool, it is given to the first waiter if any.
+func (p *ResourcePool) Put(res Resource) {
+	p.mutex.Lock()
+
+	if p.isClosed {
+		p.size--
+		p.inUse--
+		p.mutex.Unlock()
+
+		p.release(res)
+		return
+	}
+
+	if len(p.waiters) > 0 {
+		waiter := p.waiters[0]
+		p.waiters = p.waiters[1:]
+
+		// waiter chan is buffered, send with lock so a timeout waiter always find it
+		waiter <- res
+		p.mutex.Unlock()
+		return
+	}
+
+	p.inUse--
+	p.idle = append(p.idle, res)
+	p.mutex.Unlock()
+}
+
+// Evict a broken resource acquired from pool, it is released and a new one is created if
+// pool has less than min size resources.
+func (p *ResourcePool) Evict(res Resource) {
+	p.mutex.Lock()
+	p.size--
+	p.inUse--
+	p.mutex.Unlock()
+
+	atomic.AddUint64(&(p.totalEvicted), 1)
+	p.release(res)
+
+	p.fill()
+}
+
+func (p *ResourcePool) release(res Resource) {
+	err := res.Release()
+	if err != nil {
+		p.logf("resource pool = %s release resource error = %s", p.name, err)
+	}
+}
+
+// logf log a warning by PoolConfig.Logger.
+func (p *ResourcePool) logf(format string, v ...interface{}) {
+	if p.logger != nil {
+		p.logger(format, v...)
+	}
+}
+
+// fill create resources until pool has min size resources, or waiters need them.
+func (p *ResourcePool) fill() {
+	for {
+		p.mutex.Lock()
+		need := !p.isClosed && (p.size < p.minSize || (len(p.waiters) > 0 && p.size < p.maxSize))
+		p.mutex.Unlock()
+
+		if !need {
+			return
+		}
+
+		res, err := p.create()
+		if err != nil {
+			p.logf("%s", err)
+			return
+		}
+
+		p.Put(res)
+	}
+}
+
+// check all idle resources, broken ones are evicted.
+func (p *ResourcePool) check() {
+	p.mutex.Lock()
+	list := p.idle
+	p.idle = nil
+	p.inUse += len(list)
+	p.mutex.Unlock()
+
+	for _, res := range list {
+		ctx, cancel := context.WithTimeout(context.Background(), p.checkTimeout)
+		newRes, err := res.Check(ctx)
+		cancel()
+
+		if err != nil || newRes == nil {
+			p.logf("resource pool = %s evict broken resource, error = %v", p.name, err)
+			p.Evict(res)
+			continue
+		}
+
+		if newRes != res {
+			p.release(res)
+		}
+
+		p.Put(newRes)
+	}
+
+	p.fill()
+}
+
+func (p *ResourcePool) checking() {
+	ticker := time.NewTicker(p.checkPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.check()
+		case <-p.quitCh:
+			return
+		}
+	}
+}
+
+// Close pool, idle resources are released, resources in use are released when put back.
+func (p *ResourcePool) Close() {
+	p.mutex.Lock()
+	if p.isClosed {
+		p.mutex.Unlock()
+		return
+	}
+
+	p.isClosed = true
+	close(p.quitCh)
+
+	list := p.idle
+	p.idle = nil
+	p.size -= len(list)
+
+	for _, w := range p.waiters {
+		close(w)
+	}
+	p.waiters = nil
+	p.mutex.Unlock()
+
+	for _, res := range list {
+		p.release(res)
+	}
+}
+
+// Stats get statistics of pool.
+func (p *ResourcePool) Stats() PoolStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return PoolStats{
+		Size:          p.size,
+		Idle:          len(p.idle),
+		InUse:         p.inUse,
+		Waiting:       len(p.waiters),
+		TotalCreated:  atomic.LoadUint64(&(p.totalCreated)),
+		TotalEvicted:  atomic.LoadUint64(&(p.totalEvicted)),
+		TotalAcquired: atomic.LoadUint64(&(p.totalAcquired)),
+		TotalTimeout:  atomic.LoadUint64(&(p.totalTimeout)),
+	}
+}
+
+// Collect metrics of pool, labelled by pool name.
+func (p *ResourcePool) Collect(emit func(m Metric)) {
+	labels := map[string]string{"pool": p.name}
+	s := p.Stats()
+
+	for _, m := range []Metric{
+		{Name: "dispatcher_pool_resources", Help: "Current number of resources in pool.",
+			Type: MetricTypeGauge, Value: float64(s.Size)},
+		{Name: "dispatcher_pool_resources_idle", Help: "Current number of idle resources in pool.",
+			Type: MetricTypeGauge, Value: float64(s.Idle)},
+		{Name: "dispatcher_pool_waiting", Help: "Current number of workers waiting resource.",
+			Type: MetricTypeGauge, Value: float64(s.Waiting)},
+		{Name: "dispatcher_pool_created_total", Help: "Total number of resources created.",
+			Type: MetricTypeCounter, Value: float64(s.TotalCreated)},
+		{Name: "dispatcher_pool_evicted_total", Help: "Total number of broken resources evicted.",
+			Type: MetricTypeCounter, Value: float64(s.TotalEvicted)},
+		{Name: "dispatcher_pool_acquired_total", Help: "Total number of resources acquired.",
+			Type: MetricTypeCounter, Value: float64(s.TotalAcquired)},
+		{Name: "dispatcher_pool_acquire_timeout_total", Help: "Total number of acquire timeout.",
+			Type: MetricTypeCounter, Value: float64(s.TotalTimeout)},
+	} {
+		m.Labels = labels
+		emit(m)
+	}
+}
+
+// getResource get resource for a task, from pool or the resource of worker.
+func (w *Worker) getResource(ctx context.Context) (Resource, error) {
+	var err error
+
+	pool := w.dispatcher.pool
+	if pool == nil {
+		if w.resource == nil {
+			return nil, nil
+		}
+
+		w.resource, err = w.resource.Check(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("worker resource check error : %s", err)
+		}
+
+		return w.resource, nil
+	}
+
+	res, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("worker acquire resource error : %s", err)
+	}
+
+	return res, nil
+}
+
+// putResource put resource back to pool, it is evicted if task panic.
+func (w *Worker) putResource(res Resource, isBroken bool) {
+	pool := w.dispatcher.pool
+	if pool == nil || res == nil {
+		return
+	}
+
+	if isBroken {
+		pool.Evict(res)
+		return
+	}
+
+	pool.Put(res)
+}
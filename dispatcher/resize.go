@@ -0,0 +1,289 @@
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// ErrorOfWorkerNotExist worker id not exist or worker has quit.
+var ErrorOfWorkerNotExist = errors.New("dispatcher worker not exist")
+
+// getWorkerCh get chan of free workers, it is replaced when max workers grow.
+func (d *Dispatcher) getWorkerCh() chan *Worker {
+	d.workerChMutex.RLock()
+	defer d.workerChMutex.RUnlock()
+
+	return d.workerCh
+}
+
+// putWorker put a free worker back, never block since chan is larger than max workers.
+func (d *Dispatcher) putWorker(w *Worker) {
+	d.workerChMutex.RLock()
+	d.workerCh <- w
+	d.workerChMutex.RUnlock()
+}
+
+// growWorkerCh replace chan of free workers by a larger one, free workers are moved to it.
+func (d *Dispatcher) growWorkerCh(size int) {
+	d.workerChMutex.Lock()
+	defer d.workerChMutex.Unlock()
+
+	if cap(d.workerCh) >= size {
+		return
+	}
+
+	ch := make(chan *Worker, size)
+	for {
+		select {
+		case w := <-d.workerCh:
+			ch <- w
+		default:
+			d.workerCh = ch
+			return
+		}
+	}
+}
+
+// fillWorkers create workers until min workers.
+func (d *Dispatcher) fillWorkers() {
+	for d.GetTotalWorkNum() < d.GetMinWorkerNum() {
+		worker := d.scaleUp()
+		if worker == nil {
+			return
+		}
+
+		d.putWorker(worker)
+	}
+}
+
+// retireExtra retire worker if workers more than max after resize, return true if retired.
+func (d *Dispatcher) retireExtra(w *Worker) bool {
+	for {
+		num := atomic.LoadInt32(&(d.workerNum))
+		if int(num) <= d.GetMaxWorkerNum() {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt32(&(d.workerNum), num, num-1) {
+			break
+		}
+	}
+
+	w.isRetire = true
+	w.exitReason = WorkerExitResize
+
+	atomic.AddUint64(&(d.totalScaleDown), 1)
+	atomic.StoreInt64(&(d.lastScaleTime), d.now())
+
+	return true
+}
+
+// retireFree retire free workers which are more than max, busy ones retire after task finished.
+func (d *Dispatcher) retireFree() {
+	for d.GetTotalWorkNum() > d.GetMaxWorkerNum() {
+		var worker *Worker
+		select {
+		case worker = <-d.getWorkerCh():
+		default:
+			return
+		}
+
+		if !d.retireExtra(worker) {
+			d.putWorker(worker)
+			return
+		}
+
+		worker.stop()
+	}
+}
+
+// Reconfigure resize dispatcher at runtime, only MaxWorkerNum, MinWorkerNum, MaxTaskNum and
+// Weight and MaxTaskNum of Lanes are applied, zero value keep the current one, lanes can't be
+// added or removed. Queued tasks are kept even if more than the new capacity, new tasks are refused
+// until queue shrink, workers more than max retire after their task finished.
+func (d *Dispatcher) Reconfigure(c Config) error {
+	if d.isClosed() {
+		return ErrorOfDispatcherHasStop
+	}
+
+	for _, lc := range c.Lanes {
+		if _, err := d.getLane(lc.Name); err != nil {
+			return fmt.Errorf("%w : %s", err, lc.Name)
+		}
+	}
+
+	max := c.MaxWorkerNum
+	if max <= 0 {
+		max = d.GetMaxWorkerNum()
+	}
+
+	min := c.MinWorkerNum
+	if min <= 0 {
+		min = d.GetMinWorkerNum()
+	}
+
+	if min > max {
+		min = max
+	}
+
+	d.growWorkerCh(max)
+	atomic.StoreInt32(&(d.maxWorkerNum), int32(max))
+	atomic.StoreInt32(&(d.minWorkerNum), int32(min))
+
+	d.mutex.Lock()
+
+	if c.MaxTaskNum > 0 {
+		for _, l := range d.lanes {
+			if l.isDefault {
+				l.maxTaskNum = c.MaxTaskNum
+			}
+		}
+	}
+
+	for _, lc := range c.Lanes {
+		l, _ := d.getLane(lc.Name)
+		if lc.Weight > 0 {
+			l.weight = lc.Weight
+		}
+
+		if lc.MaxTaskNum > 0 {
+			l.maxTaskNum = lc.MaxTaskNum
+			l.isDefault = false
+		}
+	}
+
+	for _, l := range d.lanes {
+		d.checkLane(l)
+	}
+
+	d.updateState()
+	d.mutex.Unlock()
+
+	d.retireFree()
+	d.fillWorkers()
+	d.wake()
+
+	return nil
+}
+
+// Pause dispatch tasks to workers, tasks are still accepted and queued, running tasks are not
+// affected, call Resume to continue.
+func (d *Dispatcher) Pause() {
+	atomic.StoreInt32(&(d.paused), 1)
+}
+
+// Resume dispatch tasks after Pause.
+func (d *Dispatcher) Resume() {
+	if atomic.CompareAndSwapInt32(&(d.paused), 1, 0) {
+		d.wake()
+	}
+}
+
+// IsPaused is dispatch paused.
+func (d *Dispatcher) IsPaused() bool {
+	return atomic.LoadInt32(&(d.paused)) == 1
+}
+
+func (d *Dispatcher) addWorker(w *Worker) {
+	d.workerMapMutex.Lock()
+	d.workerMap[w.workerID] = w
+	d.workerMapMutex.Unlock()
+}
+
+func (d *Dispatcher) removeWorker(w *Worker) {
+	d.workerMapMutex.Lock()
+	delete(d.workerMap, w.workerID)
+	delete(d.parkedMap, w.workerID)
+	d.workerMapMutex.Unlock()
+}
+
+func (w *Worker) isPaused() bool {
+	return atomic.LoadInt32(&(w.paused)) == 1
+}
+
+// parkPaused keep a free worker out of chan of free workers if it is paused, return true if parked.
+func (d *Dispatcher) parkPaused(w *Worker) bool {
+	d.workerMapMutex.Lock()
+	defer d.workerMapMutex.Unlock()
+
+	if !w.isPaused() {
+		return false
+	}
+
+	d.parkedMap[w.workerID] = w
+
+	return true
+}
+
+// PauseWorker stop dispatch tasks to a worker, its running task is not affected, a paused worker
+// is still counted in max workers and not retired because of idle, call ResumeWorker to continue. Return false if worker not exist,
+// worker ids are from 0 in order of created, see GetWorkerIDs.
+func (d *Dispatcher) PauseWorker(id int) bool {
+	d.workerMapMutex.Lock()
+	defer d.workerMapMutex.Unlock()
+
+	w, ok := d.workerMap[id]
+	if !ok {
+		return false
+	}
+
+	atomic.StoreInt32(&(w.paused), 1)
+
+	return true
+}
+
+// ResumeWorker dispatch tasks to a worker after PauseWorker, return false if worker not exist.
+func (d *Dispatcher) ResumeWorker(id int) bool {
+	d.workerMapMutex.Lock()
+	w, ok := d.workerMap[id]
+	if !ok || !atomic.CompareAndSwapInt32(&(w.paused), 1, 0) {
+		d.workerMapMutex.Unlock()
+		return ok
+	}
+
+	_, isParked := d.parkedMap[id]
+	delete(d.parkedMap, id)
+	d.workerMapMutex.Unlock()
+
+	if isParked {
+		d.putWorker(w)
+	}
+
+	d.wake()
+
+	return true
+}
+
+// GetWorkerIDs get id of all workers, sorted.
+func (d *Dispatcher) GetWorkerIDs() []int {
+	d.workerMapMutex.Lock()
+	defer d.workerMapMutex.Unlock()
+
+	list := make([]int, 0, len(d.workerMap))
+	for id := range d.workerMap {
+		list = append(list, id)
+	}
+
+	sort.Ints(list)
+
+	return list
+}
+
+// GetPausedWorkerIDs get id of paused workers, sorted.
+func (d *Dispatcher) GetPausedWorkerIDs() []int {
+	d.workerMapMutex.Lock()
+	defer d.workerMapMutex.Unlock()
+
+	var list []int
+	for id, w := range d.workerMap {
+		if w.isPaused() {
+			list = append(list, id)
+		}
+	}
+
+	sort.Ints(list)
+
+	return list
+}
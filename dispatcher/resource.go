@@ -4,6 +4,8 @@ import "context"
 
 // Resource of worker own.
 type Resource interface {
+	// Check resource before use, return itself or a new one to replace it,
+	// ResourcePool release the replaced one.
 	Check(ctx context.Context) (Resource, error)
 	Release() error
 }
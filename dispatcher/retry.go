@@ -0,0 +1,162 @@
+package dispatcher
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRetryInitialBackoff = time.Duration(100) * time.Millisecond
+	defaultRetryMaxBackoff     = time.Duration(30000) * time.Millisecond
+	defaultRetryMultiplier     = 2.0
+	defaultRetryJitter         = 0.2
+	defaultDeadLetterMaxNum    = 10000
+)
+
+// RetryPolicy decide whether and when to retry a task which operate error.
+type RetryPolicy struct {
+	MaxAttempts    int                  // max attempts include the first one, <= 1 means never retry
+	InitialBackoff time.Duration        // wait time before the second attempt, default 100ms
+	MaxBackoff     time.Duration        // max wait time between two attempts, default 30s
+	Multiplier     float64              // backoff grow factor of each attempt, default 2
+	Jitter         float64              // random factor of backoff in [0, 1], 0 means none, < 0 means default 0.2
+	Retryable      func(err error) bool // decide which error can be retried, nil means all
+}
+
+// canRetry is task can be retried after attempt times.
+func (p *RetryPolicy) canRetry(attempt int, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+
+	if p.Retryable != nil && !p.Retryable(err) {
+		return false
+	}
+
+	return true
+}
+
+// backoff get wait time before next attempt, attempt is the times already done.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = defaultRetryInitialBackoff
+	}
+
+	max := p.MaxBackoff
+	if max <= 0 {
+		max = defaultRetryMaxBackoff
+	}
+
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = defaultRetryMultiplier
+	}
+
+	jitter := p.Jitter
+	if jitter < 0 || jitter > 1 {
+		jitter = defaultRetryJitter
+	}
+
+	backoff := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if backoff > float64(max) {
+		backoff = float64(max)
+	}
+
+	backoff = backoff * (1 - jitter + 2*jitter*rand.Float64())
+
+	return time.Duration(backoff)
+}
+
+// DeadLetter a task which use up all attempts.
+type DeadLetter struct {
+	Task     Task
+	Err      error // error of the last attempt
+	Attempts int
+	Time     int64 // per - Nanosecond
+}
+
+// DeadLetterSink receive tasks which use up all attempts.
+type DeadLetterSink interface {
+	Put(dl DeadLetter)
+}
+
+// DeadLetterQueue a memory dead letter sink, caller can drain or replay it.
+type DeadLetterQueue struct {
+	mutex        sync.Mutex
+	maxNum       int
+	letters      []DeadLetter
+	totalDropped uint64
+}
+
+// NewDeadLetterQueue create a dead letter queue, the oldest letter will be dropped when full.
+func NewDeadLetterQueue(maxNum int) *DeadLetterQueue {
+	if maxNum <= 0 {
+		maxNum = defaultDeadLetterMaxNum
+	}
+
+	return &DeadLetterQueue{maxNum: maxNum}
+}
+
+// Put a dead letter to queue.
+func (q *DeadLetterQueue) Put(dl DeadLetter) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.letters) >= q.maxNum {
+		q.letters = q.letters[1:]
+		atomic.AddUint64(&(q.totalDropped), 1)
+	}
+
+	q.letters = append(q.letters, dl)
+}
+
+// Len get number of dead letters in queue.
+func (q *DeadLetterQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return len(q.letters)
+}
+
+// GetTotalDropped get total number of dead letters dropped because of queue full.
+func (q *DeadLetterQueue) GetTotalDropped() uint64 {
+	return atomic.LoadUint64(&(q.totalDropped))
+}
+
+// Drain take all dead letters out of queue.
+func (q *DeadLetterQueue) Drain() []DeadLetter {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	letters := q.letters
+	q.letters = nil
+
+	return letters
+}
+
+// Replay drain all dead letters and add their tasks to dispatcher again with attempts reset,
+// tasks refused by dispatcher are put back to queue.
+func (q *DeadLetterQueue) Replay(d *Dispatcher) (int, error) {
+	var num int
+	var lastErr error
+
+	for _, dl := range q.Drain() {
+		task := dl.Task
+		task.Attempt = 0
+
+		err := d.AddTask(task)
+		if err != nil {
+			lastErr = err
+			q.Put(dl)
+			continue
+		}
+
+		num++
+	}
+
+	return num, lastErr
+}
@@ -0,0 +1,98 @@
+package dispatcher
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultWorkerIdleTimeout = time.Duration(60000) * time.Millisecond
+	defaultScaleRetryPeriod  = time.Duration(1000) * time.Millisecond
+)
+
+// ResourceFactory create a resource for a new worker.
+type ResourceFactory func() (Resource, error)
+
+// scaleUp create a new worker if worker number less than max, return nil if can't.
+func (d *Dispatcher) scaleUp() *Worker {
+	if d.isSynchronous {
+		return nil
+	}
+
+	for {
+		num := atomic.LoadInt32(&(d.workerNum))
+		if int(num) >= d.GetMaxWorkerNum() {
+			return nil
+		}
+
+		if atomic.CompareAndSwapInt32(&(d.workerNum), num, num+1) {
+			break
+		}
+	}
+
+	res := d.resource
+	if d.newResource != nil {
+		var err error
+		res, err = d.newResource()
+		if err != nil {
+			atomic.AddInt32(&(d.workerNum), -1)
+			d.logf("dispatcher = %s create worker resource error = %s", d.name, err)
+			return nil
+		}
+	}
+
+	id := int(atomic.AddInt32(&(d.workerSeq), 1)) - 1
+	worker := newWorker(d, id, d.workDo, res)
+	worker.ownResource = d.newResource != nil
+	d.addWorker(worker)
+	worker.working()
+
+	atomic.AddUint64(&(d.totalScaleUp), 1)
+	atomic.StoreInt64(&(d.lastScaleTime), d.now())
+
+	return worker
+}
+
+// scaleDown retire free workers which idle longer than idle timeout, keep min workers.
+func (d *Dispatcher) scaleDown() {
+	now := d.now()
+
+	for d.GetTotalWorkNum() > d.GetMinWorkerNum() {
+		var worker *Worker
+		select {
+		case worker = <-d.getWorkerCh():
+		default:
+			return
+		}
+
+		// free worker chan is fifo, the first one is the longest idle one
+		if now-atomic.LoadInt64(&(worker.lastActiveTime)) < int64(d.idleTimeout) {
+			d.putWorker(worker)
+			return
+		}
+
+		atomic.AddInt32(&(d.workerNum), -1)
+		worker.isRetire = true
+		worker.exitReason = WorkerExitIdle
+		worker.stop()
+
+		atomic.AddUint64(&(d.totalScaleDown), 1)
+		atomic.StoreInt64(&(d.lastScaleTime), now)
+	}
+}
+
+func (d *Dispatcher) shrink() {
+	period := d.idleTimeout / 2
+	timer := d.clock.NewTimer(period)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C():
+			d.scaleDown()
+			timer.Reset(period)
+		case <-d.quitCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package dispatcher
+
+import (
+	"container/heap"
+	"errors"
+	"time"
+)
+
+// schedule errors.
+var (
+	ErrorOfScheduleExist = errors.New("task uid has been scheduled")
+	ErrorOfScheduleNever = errors.New("schedule never fire")
+)
+
+// scheduleEntry a task wait to be added to dispatcher at time.
+type scheduleEntry struct {
+	task  Task
+	at    int64         // per - Nanosecond
+	cron  *CronSchedule // nil means only once
+	index int
+}
+
+// scheduleHeap min heap of entries order by fire time.
+type scheduleHeap []*scheduleEntry
+
+func (h scheduleHeap) Len() int {
+	return len(h)
+}
+
+func (h scheduleHeap) Less(i, j int) bool {
+	return h[i].at < h[j].at
+}
+
+func (h scheduleHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *scheduleHeap) Push(x interface{}) {
+	e := x.(*scheduleEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *scheduleHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*h = old[:n-1]
+
+	return e
+}
+
+// schedule add an entry to heap, task uid should be unique in heap, entries of empty uid
+// are not kept in map since they can't be cancelled.
+func (d *Dispatcher) schedule(e *scheduleEntry) error {
+	if d.getStopFlag() {
+		return ErrorOfDispatcherHasStop
+	}
+
+	d.scheduleMutex.Lock()
+
+	uid := e.task.InData.TaskUID
+	if uid != "" {
+		if _, ok := d.scheduleMap[uid]; ok {
+			d.scheduleMutex.Unlock()
+			return ErrorOfScheduleExist
+		}
+
+		d.scheduleMap[uid] = e
+	}
+
+	heap.Push(&d.scheduleHeap, e)
+	isFirst := e.index == 0
+
+	d.scheduleMutex.Unlock()
+
+	if isFirst {
+		select {
+		case d.scheduleWakeCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// AddDelayedTask add a task to dispatcher at time, task uid is the key to cancel it,
+// tasks of empty uid can't be cancelled.
+func (d *Dispatcher) AddDelayedTask(t Task, at time.Time) error {
+	return d.schedule(&scheduleEntry{task: t, at: at.UnixNano()})
+}
+
+// AddCronTask add a task to dispatcher repeatedly by cron spec, see ParseCron,
+// task uid is the key to cancel it. Every fire is added with uid like "uid@2006-01-02T15:04:05Z"
+// of fire time in utc, so it is not coalesced into a former fire still running when Dedup enabled.
+func (d *Dispatcher) AddCronTask(t Task, spec string) error {
+	cron, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+
+	next := cron.Next(d.clock.Now())
+	if next.IsZero() {
+		return ErrorOfScheduleNever
+	}
+
+	return d.schedule(&scheduleEntry{task: t, at: next.UnixNano(), cron: cron})
+}
+
+// CancelScheduled cancel a delayed or cron task by task uid, return false if not found.
+func (d *Dispatcher) CancelScheduled(taskUID string) bool {
+	d.scheduleMutex.Lock()
+	defer d.scheduleMutex.Unlock()
+
+	e, ok := d.scheduleMap[taskUID]
+	if !ok {
+		return false
+	}
+
+	delete(d.scheduleMap, taskUID)
+	heap.Remove(&d.scheduleHeap, e.index)
+
+	return true
+}
+
+// GetCurrentScheduledNum get current number of delayed and cron tasks.
+func (d *Dispatcher) GetCurrentScheduledNum() int {
+	d.scheduleMutex.Lock()
+	defer d.scheduleMutex.Unlock()
+
+	return len(d.scheduleHeap)
+}
+
+// popDue pop all entries due before now, cron entries are pushed back with next fire time.
+func (d *Dispatcher) popDue(now time.Time) ([]Task, time.Duration) {
+	d.scheduleMutex.Lock()
+	defer d.scheduleMutex.Unlock()
+
+	var due []Task
+	for len(d.scheduleHeap) > 0 {
+		e := d.scheduleHeap[0]
+		if e.at > now.UnixNano() {
+			return due, time.Duration(e.at - now.UnixNano())
+		}
+
+		if e.cron == nil {
+			due = append(due, e.task)
+		} else {
+			t := e.task
+			t.InData.TaskUID = cronFireUID(t.InData.TaskUID, e.at)
+			due = append(due, t)
+
+			next := e.cron.Next(now)
+			if !next.IsZero() {
+				e.at = next.UnixNano()
+				heap.Fix(&d.scheduleHeap, 0)
+				continue
+			}
+		}
+
+		heap.Pop(&d.scheduleHeap)
+		if e.task.InData.TaskUID != "" {
+			delete(d.scheduleMap, e.task.InData.TaskUID)
+		}
+	}
+
+	return due, -1
+}
+
+// cronFireUID get uid of task fired at time, per - Nanosecond.
+func cronFireUID(uid string, at int64) string {
+	return uid + "@" + time.Unix(0, at).UTC().Format(time.RFC3339)
+}
+
+// runSchedule one goroutine with one timer for all scheduled tasks.
+func (d *Dispatcher) runSchedule() {
+	timer := d.clock.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		due, wait := d.popDue(d.clock.Now())
+		for _, t := range due {
+			err := d.AddTask(t)
+			if err != nil {
+				d.logf("dispatcher = %s add scheduled task = %s error = %s",
+					d.name, t.InData.TaskUID, err)
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C():
+			default:
+			}
+		}
+
+		var timerCh <-chan time.Time
+		if wait >= 0 {
+			timer.Reset(wait)
+			timerCh = timer.C()
+		}
+
+		select {
+		case <-timerCh:
+		case <-d.scheduleWakeCh:
+		case <-d.quitCh:
+			return
+		}
+	}
+}
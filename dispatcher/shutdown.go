@@ -0,0 +1,236 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ShutdownError shutdown deadline exceeded before all tasks finished.
+type ShutdownError struct {
+	Err       error    // error of shutdown context
+	Abandoned []string // uid of tasks cancelled when running or never run
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("dispatcher shutdown error : %s, %d tasks abandoned", e.Err, len(e.Abandoned))
+}
+
+// Unwrap get error of shutdown context.
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// runningTask a task is running by worker.
+type runningTask struct {
+	taskUID string
+	state   *taskState
+	cancel  context.CancelFunc
+}
+
+// startRunning set cancel of a task popped from queue, it must be called before taskState.setRunning,
+// so the task is either cancelled by abandon or not started.
+func (d *Dispatcher) startRunning(t Task, cancel context.CancelFunc) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if rt, ok := d.running[t.runID]; ok {
+		rt.cancel = cancel
+		d.running[t.runID] = rt
+	}
+}
+
+// retryingTask a task waiting backoff timer to retry.
+type retryingTask struct {
+	task  Task
+	timer Timer
+}
+
+// addRetrying requeue the task after wait, the task is finished at once if it has been cancelled
+// or dispatcher has abandoned tasks.
+func (d *Dispatcher) addRetrying(t Task, wait time.Duration) {
+	d.mutex.Lock()
+	if d.abandoned {
+		d.mutex.Unlock()
+
+		d.dropRetrying(t)
+		return
+	}
+
+	// cancelled before saved, cancelTask can't find it in retrying
+	if t.state.cancelled() {
+		d.mutex.Unlock()
+
+		t.tryReply(OutData{Err: ErrorOfTaskCancelled})
+		d.taskCancelled(t)
+		atomic.AddInt64(&(d.retryingNum), -1)
+		return
+	}
+
+	d.retrySeq++
+	id := d.retrySeq
+	d.retrying[id] = retryingTask{task: t}
+	d.mutex.Unlock()
+
+	// timer may fire before it saved, requeue find the task by id
+	timer := d.clock.AfterFunc(wait, func() {
+		d.requeue(id)
+	})
+
+	d.mutex.Lock()
+	if rt, ok := d.retrying[id]; ok {
+		rt.timer = timer
+		d.retrying[id] = rt
+	}
+	d.mutex.Unlock()
+}
+
+// dropRetrying finish a retrying task abandoned by shutdown, it is not acked like queued tasks.
+func (d *Dispatcher) dropRetrying(t Task) {
+	t.tryReply(OutData{Err: ErrorOfTaskCancelled})
+	d.finishTask(t, TaskStatusCancelled, OutData{Err: ErrorOfTaskCancelled, Attempts: t.Attempt})
+
+	atomic.AddInt64(&(d.retryingNum), -1)
+}
+
+func (d *Dispatcher) removeRunning(id uint64) {
+	d.mutex.Lock()
+	delete(d.running, id)
+	d.mutex.Unlock()
+}
+
+// taskFinish a task popped from queue has been finished, notify shutdown if waiting.
+func (d *Dispatcher) taskFinish(t Task) {
+	atomic.AddInt64(&(d.activeNum), -1)
+
+	if d.limiter != nil {
+		d.mutex.Lock()
+		d.limiter.release(t, d.now())
+		d.mutex.Unlock()
+
+		d.wake()
+	}
+
+	select {
+	case d.finishCh <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) isDrained() bool {
+	return d.GetCurrentTaskTodoNum() == 0 && d.GetCurrentRunningNum() == 0 && d.GetCurrentRetryingNum() == 0
+}
+
+func (d *Dispatcher) isClosed() bool {
+	return atomic.LoadInt32(&(d.closed)) == 1
+}
+
+// abandon cancel all running and retrying tasks and clear queue, return uid of them.
+func (d *Dispatcher) abandon() []string {
+	d.mutex.Lock()
+
+	d.abandoned = true
+
+	var list []string
+	for _, rt := range d.running {
+		if rt.state != nil {
+			rt.state.mutex.Lock()
+			rt.state.isCancelled = true
+			rt.state.mutex.Unlock()
+		}
+
+		rt.cancel()
+		list = append(list, rt.taskUID)
+	}
+
+	var retrying []Task
+	for id, rt := range d.retrying {
+		if rt.timer != nil {
+			rt.timer.Stop()
+		}
+
+		delete(d.retrying, id)
+		retrying = append(retrying, rt.task)
+		list = append(list, rt.task.InData.TaskUID)
+	}
+
+	var queued []Task
+	for _, l := range d.lanes {
+		for l.queue.Len() > 0 {
+			t := l.pop()
+			queued = append(queued, t)
+			list = append(list, t.InData.TaskUID)
+		}
+
+		d.checkLane(l)
+	}
+
+	d.updateState()
+	d.mutex.Unlock()
+
+	// queued tasks are not acked, so they can be recovered from store
+	for _, t := range queued {
+		t.tryReply(OutData{Err: ErrorOfTaskCancelled})
+		d.finishTask(t, TaskStatusCancelled, OutData{Err: ErrorOfTaskCancelled})
+	}
+
+	for _, t := range retrying {
+		d.dropRetrying(t)
+	}
+
+	return list
+}
+
+// Shutdown dispatcher, stop accepting tasks and drop scheduled tasks not due, wait for queued,
+// retrying and running tasks to finish, then release every worker resource.
+// If ctx done before that, running and retrying tasks are cancelled and queued tasks are dropped,
+// none of them is acked so Store (if have) still keep them for Recover, a *ShutdownError report uid of them.
+// Store and ResourcePool are not closed by dispatcher since they may be shared, close them after Shutdown.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&(d.closed), 0, 1) {
+		return ErrorOfDispatcherHasStop
+	}
+
+	d.setStop()
+	d.Resume()
+
+	d.scheduleMutex.Lock()
+	d.scheduleHeap = nil
+	d.scheduleMap = make(map[string]*scheduleEntry)
+	d.scheduleMutex.Unlock()
+
+	var shutdownErr error
+
+	for !d.isDrained() {
+		select {
+		case <-d.finishCh:
+		case <-ctx.Done():
+			shutdownErr = &ShutdownError{Err: ctx.Err(), Abandoned: d.abandon()}
+		}
+
+		if shutdownErr != nil {
+			break
+		}
+	}
+
+	// free workers quit now, busy workers quit after their task finished
+	close(d.quitCh)
+
+	if shutdownErr != nil {
+		return shutdownErr
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.workerWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return &ShutdownError{Err: ctx.Err()}
+	}
+}
@@ -0,0 +1,88 @@
+package dispatcher
+
+import (
+	"sync/atomic"
+)
+
+// StoredTask a task persisted by TaskStore, only InData.TaskUID and InData.Data can be stored.
+type StoredTask struct {
+	Seq     uint64
+	Lane    string
+	TaskUID string
+	Data    []byte
+}
+
+// TaskStore persist queued tasks, so unfinished tasks can be recovered after restart.
+type TaskStore interface {
+	// Append persist a task before it put in queue, return sequence of it.
+	Append(lane string, in InData) (uint64, error)
+	// Ack a task is done or use up all attempts, it will never be recovered.
+	Ack(seq uint64) error
+	// Recover get all tasks not acked when store opened.
+	Recover() ([]StoredTask, error)
+	// Close store.
+	Close() error
+}
+
+// ack task to store when it finished.
+func (d *Dispatcher) ack(t Task) {
+	if d.store == nil || t.storeSeq == 0 {
+		return
+	}
+
+	err := d.store.Ack(t.storeSeq)
+	if err != nil {
+		d.logf("dispatcher = %s ack task = %s error = %s", d.name, t.InData.TaskUID, err)
+	}
+}
+
+// Recover put all unfinished tasks of store into queue again, OutCh and OriginalCtx of task
+// can't be stored, use reattach to set them (and TimeOut, Retry if need) before task queued,
+// reattach can be nil. Recover should be called once after GetDispatch.
+func (d *Dispatcher) Recover(reattach func(t *Task)) (int, error) {
+	if d.store == nil {
+		return 0, nil
+	}
+
+	list, err := d.store.Recover()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, st := range list {
+		t := Task{
+			InData: InData{TaskUID: st.TaskUID, Data: st.Data},
+			Lane:   st.Lane,
+		}
+
+		if reattach != nil {
+			reattach(&t)
+		}
+
+		l, err := d.getLane(t.Lane)
+		if err != nil {
+			l = d.lanes[0]
+		}
+
+		t.Lane = l.name
+		t.lane = l
+		t.storeSeq = st.Seq
+
+		atomic.AddUint64(&(d.totalInTask), 1)
+		atomic.AddUint64(&(l.totalInTask), 1)
+
+		t.state = newTaskState(t.InData.TaskUID)
+		d.register(t.state)
+
+		d.mutex.Lock()
+		t.StartTime = d.now()
+		d.push(l, t)
+		d.checkLane(l)
+		d.updateState()
+		d.mutex.Unlock()
+	}
+
+	d.wake()
+
+	return len(list), nil
+}
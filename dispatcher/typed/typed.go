@@ -0,0 +1,149 @@
+// Package typed is a generic layer of dispatcher, tasks and results are passed with
+// compile-time types instead of []byte and interface{}.
+package typed
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+)
+
+// WorkFunc operate input of a task and return its result, retry policy of dispatcher
+// is applied if it return error.
+type WorkFunc[In, Out any] func(ctx context.Context, res dispatcher.Resource, in In) (Out, error)
+
+// Task with typed input and options of dispatcher task.
+type Task[In any] struct {
+	TaskUID string                  // empty means generated by dispatcher
+	Lane    string                  // lane name of task, empty means the first lane
+	TimeOut time.Duration           // timeout of every attempt, default 3s
+	Retry   *dispatcher.RetryPolicy // nil means use Config.Retry
+	In      In
+}
+
+// Dispatcher dispatch tasks of In type to workers and get results of Out type.
+type Dispatcher[In, Out any] struct {
+	d   *dispatcher.Dispatcher
+	seq uint64
+}
+
+// New create a typed dispatcher, resource r is shared by workers as dispatcher.GetDispatch.
+func New[In, Out any](c dispatcher.Config, work WorkFunc[In, Out], r dispatcher.Resource) *Dispatcher[In, Out] {
+	workDo := func(ctx context.Context, res dispatcher.Resource, t dispatcher.Task) error {
+		in, ok := t.InData.If.(In)
+		if !ok && t.InData.If != nil {
+			return fmt.Errorf("task = %s input type %T is invalid", t.InData.TaskUID, t.InData.If)
+		}
+
+		out, err := work(ctx, res, in)
+		if err != nil {
+			return err
+		}
+
+		t.Reply(dispatcher.OutData{If: out})
+		return nil
+	}
+
+	return &Dispatcher[In, Out]{d: dispatcher.GetDispatch(c, workDo, r)}
+}
+
+// Submit add a task with input, ctx is the parent context of task, task is cancelled if
+// ctx done before it finished.
+func (td *Dispatcher[In, Out]) Submit(ctx context.Context, in In) (*Future[Out], error) {
+	return td.SubmitTask(ctx, Task[In]{In: in})
+}
+
+// SubmitTask add a task with options, see Submit.
+func (td *Dispatcher[In, Out]) SubmitTask(ctx context.Context, t Task[In]) (*Future[Out], error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if t.TaskUID == "" {
+		t.TaskUID = fmt.Sprintf("%s-%d", td.d.GetName(), atomic.AddUint64(&(td.seq), 1))
+	}
+
+	h, err := td.d.Submit(dispatcher.Task{
+		OriginalCtx: ctx,
+		InData:      dispatcher.InData{TaskUID: t.TaskUID, If: t.In},
+		TimeOut:     t.TimeOut / time.Millisecond,
+		Lane:        t.Lane,
+		Retry:       t.Retry,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// queued task not watch ctx, cancel it when ctx done
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				h.Cancel()
+			case <-h.Done():
+			}
+		}()
+	}
+
+	return &Future[Out]{handle: h}, nil
+}
+
+// Untyped get the underlying dispatcher, for status, metrics and shutdown.
+func (td *Dispatcher[In, Out]) Untyped() *dispatcher.Dispatcher {
+	return td.d
+}
+
+// Shutdown stop the underlying dispatcher, see dispatcher.Dispatcher.Shutdown.
+func (td *Dispatcher[In, Out]) Shutdown(ctx context.Context) error {
+	return td.d.Shutdown(ctx)
+}
+
+// Future result of a task which will be available when task finished.
+type Future[Out any] struct {
+	handle *dispatcher.Handle
+}
+
+// TaskUID get uid of task.
+func (f *Future[Out]) TaskUID() string {
+	return f.handle.TaskUID()
+}
+
+// Status get current status of task.
+func (f *Future[Out]) Status() dispatcher.TaskStatus {
+	return f.handle.Status()
+}
+
+// Done get a chan which closed when task finished.
+func (f *Future[Out]) Done() <-chan struct{} {
+	return f.handle.Done()
+}
+
+// Cancel task, return false if task has finished.
+func (f *Future[Out]) Cancel() bool {
+	return f.handle.Cancel()
+}
+
+// Get wait task finish and get its result, error is the error of task, or error of ctx
+// if ctx done before task finished.
+func (f *Future[Out]) Get(ctx context.Context) (Out, error) {
+	var zero Out
+
+	out, err := f.handle.Wait(ctx)
+	if err != nil {
+		return zero, err
+	}
+
+	if out.Err != nil {
+		return zero, out.Err
+	}
+
+	v, ok := out.If.(Out)
+	if !ok && out.If != nil {
+		return zero, fmt.Errorf("task = %s output type %T is invalid", f.handle.TaskUID(), out.If)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,56 @@
+package typed_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+	"github.com/ezgroot/ezUtils/dispatcher/typed"
+)
+
+var errOdd = errors.New("odd number")
+
+func TestTypedDispatcher(t *testing.T) {
+	d := typed.New(dispatcher.Config{Name: "typed", MaxWorkerNum: 2},
+		func(ctx context.Context, res dispatcher.Resource, in int) (string, error) {
+			if in < 0 {
+				<-ctx.Done()
+				return "", ctx.Err()
+			}
+
+			if in%2 == 1 {
+				return "", errOdd
+			}
+
+			return time.Duration(in).String(), nil
+		}, nil)
+	defer d.Shutdown(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	f, err := d.Submit(ctx, 2)
+	if err != nil {
+		t.Fatalf("submit error = %s", err)
+	}
+
+	out, err := f.Get(ctx)
+	if err != nil || out != "2ns" || f.Status() != dispatcher.TaskStatusDone {
+		t.Fatalf("get out = %s, error = %v, status = %s", out, err, f.Status())
+	}
+
+	f, _ = d.Submit(ctx, 3)
+	if _, err = f.Get(ctx); !errors.Is(err, errOdd) {
+		t.Fatalf("get error = %v", err)
+	}
+
+	taskCtx, taskCancel := context.WithCancel(context.Background())
+	f, _ = d.SubmitTask(taskCtx, typed.Task[int]{TaskUID: "block", TimeOut: time.Minute, In: -1})
+	taskCancel()
+
+	if _, err = f.Get(ctx); err == nil || f.Status() == dispatcher.TaskStatusDone {
+		t.Fatalf("cancelled task error = %v, status = %s", err, f.Status())
+	}
+}
@@ -2,7 +2,6 @@ package dispatcher
 
 import (
 	"context"
-	"fmt"
 	"sync/atomic"
 	"time"
 )
@@ -18,9 +17,16 @@ type Worker struct {
 	dispatcher *Dispatcher
 	workerID   int
 	taskCh     chan Task
+	batchCh    chan []Task
 	workDo     workDoing
 	quitCh     chan struct{}
 	resource   Resource
+
+	ownResource    bool             // resource created for this worker only
+	isRetire       bool             // worker quit because of idle or panic
+	paused         int32            // not dispatched tasks, see Dispatcher.PauseWorker
+	exitReason     WorkerExitReason // why worker quit
+	lastActiveTime int64            // per - Nanosecond
 }
 
 func newWorker(dp *Dispatcher, id int, wd workDoing, res Resource) *Worker {
@@ -28,100 +34,192 @@ func newWorker(dp *Dispatcher, id int, wd workDoing, res Resource) *Worker {
 		dispatcher: dp,
 		workerID:   id,
 		taskCh:     make(chan Task, 1),
+		batchCh:    make(chan []Task, 1),
 		workDo:     wd,
 		quitCh:     make(chan struct{}, 1),
 		resource:   res,
+
+		lastActiveTime: dp.now(),
 	}
 
 	return w
 }
 
+func (w *Worker) release() {
+	defer w.dispatcher.workerWg.Done()
+
+	if !w.isRetire {
+		atomic.AddInt32(&(w.dispatcher.workerNum), -1)
+	}
+
+	w.dispatcher.removeWorker(w)
+
+	// shared resource is only released when dispatcher stop
+	if w.resource != nil && (w.ownResource || !w.isRetire) {
+		err := w.resource.Release()
+		if err != nil {
+			w.dispatcher.logf("dispatcher = %s worker = %d release resource error = %s",
+				w.dispatcher.name, w.workerID, err)
+		}
+	}
+
+	w.dispatcher.hooks.OnWorkerExit(w.workerID, w.exitReason)
+}
+
 func (w *Worker) working() {
+	w.dispatcher.workerWg.Add(1)
+
 	go func() {
 		for {
 			select {
 			case task := <-w.taskCh:
 				{
-					var err error
-					var out OutData
-
-					if task.TimeOut <= 0 {
-						task.TimeOut = defaultTaskTimeout
-					}
-
-					var newCtx context.Context
-					var cancel context.CancelFunc
-					if task.OriginalCtx == nil {
-						task.OriginalCtx = context.Background()
+					isPanic := w.doTask(task)
+					if isPanic {
+						w.replace()
 					}
 
-					newCtx, cancel = context.WithTimeout(task.OriginalCtx, task.TimeOut*time.Millisecond)
-
-					select {
-					default:
-					case <-newCtx.Done():
-						{
-							atomic.AddUint64(&(w.dispatcher.totalErrorTask), 1)
+					w.dispatcher.taskFinish(task)
 
-							out.Err = newCtx.Err()
-							if task.OutCh != nil {
-								task.OutCh <- out
-							}
-						}
-
-						goto TaskEnd
+					if isPanic {
+						w.release()
+						return
 					}
-
-					if w.resource != nil {
-						w.resource, err = w.resource.Check(newCtx)
-						if err != nil {
-							atomic.AddUint64(&(w.dispatcher.totalErrorTask), 1)
-
-							out.Err = fmt.Errorf("worker resource check error : %s", err)
-							if task.OutCh != nil {
-								task.OutCh <- out
-							}
-
-							goto TaskEnd
-						}
+				}
+			case tasks := <-w.batchCh:
+				{
+					isPanic := w.doBatch(tasks)
+					if isPanic {
+						w.replace()
 					}
 
-					// workDo will make sure send result data to job out chan if need
-					err = w.workDo(newCtx, w.resource, task)
-					if err != nil {
-						atomic.AddUint64(&(w.dispatcher.totalErrorTask), 1)
-					} else {
-						atomic.AddUint64(&(w.dispatcher.totalDoneTask), 1)
+					for _, task := range tasks {
+						w.dispatcher.taskFinish(task)
 					}
 
-				TaskEnd:
-					task.EndTime = time.Now().UTC().UnixNano()
-					if w.dispatcher.isTrance {
-						fmt.Printf("from dispatcher, module: %s, workerID : %d, jobID : %s, cost %s\n",
-							w.dispatcher.name, w.workerID, task.InData.TaskUID,
-							diffTimeStrapToShow(task.StartTime, task.EndTime))
+					if isPanic {
+						w.release()
+						return
 					}
-
-					cancel()
 				}
 			case <-w.quitCh:
 				{
-					if w.resource != nil {
-						err := w.resource.Release()
-						if err != nil {
-							fmt.Printf("release worker resource error = %s\n", err)
-						}
-					}
-
+					w.release()
+					return
+				}
+			case <-w.dispatcher.quitCh:
+				{
+					w.drain()
+					w.release()
 					return
 				}
 			}
 
-			w.dispatcher.workerCh <- w
+			if w.dispatcher.retireExtra(w) {
+				w.release()
+				return
+			}
+
+			atomic.StoreInt64(&(w.lastActiveTime), w.dispatcher.now())
+			if !w.dispatcher.parkPaused(w) {
+				w.dispatcher.putWorker(w)
+			}
 		}
 	}()
 }
 
+// doTask operate a task, return true if workDo panic.
+func (w *Worker) doTask(task Task) bool {
+	var err error
+	var isPanic bool
+	var res Resource
+
+	runStart := w.dispatcher.now()
+
+	task.Attempt++
+	task.RunTime = runStart
+
+	if task.TimeOut <= 0 {
+		task.TimeOut = defaultTaskTimeout
+	}
+
+	if task.OriginalCtx == nil {
+		task.OriginalCtx = context.Background()
+	}
+
+	newCtx, cancel := w.dispatcher.clock.WithTimeout(task.OriginalCtx, task.TimeOut*time.Millisecond)
+	defer cancel()
+
+	defer w.dispatcher.removeRunning(task.runID)
+	w.dispatcher.startRunning(task, cancel)
+
+	if !task.state.setRunning(cancel) {
+		task.Reply(OutData{Err: ErrorOfTaskCancelled})
+		w.dispatcher.taskCancelled(task)
+		return false
+	}
+
+	newCtx = w.dispatcher.hooks.OnStart(newCtx, task)
+
+	select {
+	default:
+	case <-newCtx.Done():
+		{
+			err = newCtx.Err()
+			w.dispatcher.taskFailed(task, err, true)
+		}
+
+		goto TaskEnd
+	}
+
+	res, err = w.getResource(newCtx)
+	if err != nil {
+		w.dispatcher.taskFailed(task, err, true)
+
+		goto TaskEnd
+	}
+
+	isPanic, err = w.safeDo(newCtx, res, task)
+	w.putResource(res, isPanic)
+
+	if isPanic {
+		w.dispatcher.taskFailed(task, err, true)
+	} else if err != nil {
+		w.dispatcher.taskFailed(task, err, false)
+	} else {
+		w.dispatcher.countDone(task)
+	}
+
+TaskEnd:
+	task.EndTime = w.dispatcher.now()
+	w.dispatcher.observe(task, runStart, err)
+	w.dispatcher.hooks.OnFinish(newCtx, task, err, time.Duration(task.EndTime-runStart))
+
+	return isPanic
+}
+
+// drain operate the task assigned before dispatcher quit, it has been cancelled by abandon.
+func (w *Worker) drain() {
+	if w.dispatcher.isSynchronous {
+		return
+	}
+
+	// no task is assigned after assignTask quit
+	<-w.dispatcher.assignDoneCh
+
+	select {
+	case task := <-w.taskCh:
+		w.doTask(task)
+		w.dispatcher.taskFinish(task)
+	case tasks := <-w.batchCh:
+		w.doBatch(tasks)
+		for _, task := range tasks {
+			w.dispatcher.taskFinish(task)
+		}
+	default:
+	}
+}
+
 func (w *Worker) stop() {
 	w.quitCh <- struct{}{}
 }
@@ -0,0 +1,412 @@
+// Package workflow run a DAG of tasks by dispatcher, a node run after all its upstream
+// nodes succeed and get their results.
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+)
+
+// workflow errors.
+var (
+	ErrorOfNodeExist      = errors.New("workflow node id exist")
+	ErrorOfNodeNotExist   = errors.New("workflow node not exist")
+	ErrorOfEmptyNodeID    = errors.New("workflow node id is empty")
+	ErrorOfUpstreamFailed = errors.New("workflow upstream node failed")
+)
+
+// CycleError nodes depend on each other.
+type CycleError struct {
+	Path []string // node ids of cycle, the first one is repeated at last
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("workflow has cycle : %s", strings.Join(e.Path, " -> "))
+}
+
+// NodeError a node failed when workflow run.
+type NodeError struct {
+	ID  string
+	Err error
+}
+
+func (e *NodeError) Error() string {
+	return fmt.Sprintf("workflow node = %s error : %s", e.ID, e.Err)
+}
+
+// Unwrap get error of node.
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// Upstream results of upstream nodes by node id.
+type Upstream map[string]dispatcher.OutData
+
+// Node of workflow.
+type Node struct {
+	ID   string
+	Deps []string // id of upstream nodes
+	// Task to add to dispatcher, workDo should reply result by Task.Reply to pass it downstream,
+	// uid is generated if empty.
+	Task dispatcher.Task
+	// Prepare set task by upstream results before it added to dispatcher,
+	// nil means set upstream results to InData.If if it is nil.
+	Prepare func(t *dispatcher.Task, up Upstream) error
+}
+
+// ErrorMode how to operate the rest nodes when a node failed.
+type ErrorMode int
+
+// error mode enum
+const (
+	FailFast        ErrorMode = iota // cancel running nodes and skip the rest
+	ContinueOnError                  // only skip nodes depend on failed nodes
+)
+
+// NodeStatus status of a node.
+type NodeStatus int
+
+// node status enum
+const (
+	NodeStatusPending NodeStatus = iota
+	NodeStatusRunning
+	NodeStatusDone
+	NodeStatusFailed
+	NodeStatusSkipped
+)
+
+func (s NodeStatus) String() string {
+	switch s {
+	case NodeStatusPending:
+		return "pending"
+	case NodeStatusRunning:
+		return "running"
+	case NodeStatusDone:
+		return "done"
+	case NodeStatusFailed:
+		return "failed"
+	case NodeStatusSkipped:
+		return "skipped"
+	default:
+		return "unknown"
+	}
+}
+
+// NodeResult result of a node.
+type NodeResult struct {
+	Status NodeStatus
+	Out    dispatcher.OutData
+	Err    error
+}
+
+// Builder build a workflow.
+type Builder struct {
+	name  string
+	nodes map[string]*Node
+	order []string
+	err   error
+}
+
+// NewBuilder create a workflow builder, name is used as prefix of generated task uid.
+func NewBuilder(name string) *Builder {
+	return &Builder{name: name, nodes: make(map[string]*Node)}
+}
+
+// Add a node, error is reported by Build.
+func (b *Builder) Add(n Node) *Builder {
+	if b.err != nil {
+		return b
+	}
+
+	if n.ID == "" {
+		b.err = ErrorOfEmptyNodeID
+		return b
+	}
+
+	if _, ok := b.nodes[n.ID]; ok {
+		b.err = fmt.Errorf("%w : %s", ErrorOfNodeExist, n.ID)
+		return b
+	}
+
+	n.Deps = append([]string(nil), n.Deps...)
+	b.nodes[n.ID] = &n
+	b.order = append(b.order, n.ID)
+
+	return b
+}
+
+// Build check nodes and create workflow, dependency not exist and cycle are reported.
+func (b *Builder) Build() (*Workflow, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	w := &Workflow{
+		name:       b.name,
+		nodes:      b.nodes,
+		order:      b.order,
+		downstream: make(map[string][]string),
+	}
+
+	for _, id := range b.order {
+		for _, dep := range b.nodes[id].Deps {
+			if _, ok := b.nodes[dep]; !ok {
+				return nil, fmt.Errorf("%w : %s depend on %s", ErrorOfNodeNotExist, id, dep)
+			}
+
+			w.downstream[dep] = append(w.downstream[dep], id)
+		}
+	}
+
+	if path := w.findCycle(); path != nil {
+		return nil, &CycleError{Path: path}
+	}
+
+	return w, nil
+}
+
+// Workflow a DAG of nodes, it can run many times.
+type Workflow struct {
+	name       string
+	nodes      map[string]*Node
+	order      []string
+	downstream map[string][]string
+	runSeq     uint64
+}
+
+// findCycle depth first search a cycle, return nil if not found.
+func (w *Workflow) findCycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	color := make(map[string]int)
+	var stack []string
+
+	var visit func(id string) []string
+	visit = func(id string) []string {
+		color[id] = visiting
+		stack = append(stack, id)
+
+		for _, dep := range w.nodes[id].Deps {
+			switch color[dep] {
+			case visiting:
+				for i, s := range stack {
+					if s == dep {
+						return append(append([]string(nil), stack[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if path := visit(dep); path != nil {
+					return path
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		color[id] = visited
+
+		return nil
+	}
+
+	for _, id := range w.order {
+		if color[id] == unvisited {
+			if path := visit(id); path != nil {
+				return path
+			}
+		}
+	}
+
+	return nil
+}
+
+// Nodes get id of nodes in the order added.
+func (w *Workflow) Nodes() []string {
+	return append([]string(nil), w.order...)
+}
+
+// nodeDone a node finished.
+type nodeDone struct {
+	id  string
+	out dispatcher.OutData
+	err error
+}
+
+// run state of workflow.
+type run struct {
+	w       *Workflow
+	d       *dispatcher.Dispatcher
+	ctx     context.Context
+	mode    ErrorMode
+	seq     uint64
+	results map[string]*NodeResult
+	waiting map[string]int // number of unfinished upstream nodes
+	handles map[string]*dispatcher.Handle
+	doneCh  chan nodeDone
+	err     error
+}
+
+// Run workflow by dispatcher, ready nodes are added to dispatcher at once, results of all
+// nodes are returned, error is the first failed node as *NodeError, or error of ctx.
+func (w *Workflow) Run(ctx context.Context, d *dispatcher.Dispatcher, mode ErrorMode) (map[string]NodeResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r := &run{
+		w:       w,
+		d:       d,
+		ctx:     ctx,
+		mode:    mode,
+		seq:     atomic.AddUint64(&(w.runSeq), 1),
+		results: make(map[string]*NodeResult),
+		waiting: make(map[string]int),
+		handles: make(map[string]*dispatcher.Handle),
+		doneCh:  make(chan nodeDone, len(w.order)),
+	}
+
+	for _, id := range w.order {
+		r.results[id] = &NodeResult{Status: NodeStatusPending}
+		r.waiting[id] = len(w.nodes[id].Deps)
+	}
+
+	for _, id := range w.order {
+		if r.waiting[id] == 0 && r.results[id].Status == NodeStatusPending {
+			r.start(id)
+		}
+	}
+
+	ctxDoneCh := ctx.Done()
+	for len(r.handles) > 0 {
+		select {
+		case nd := <-r.doneCh:
+			delete(r.handles, nd.id)
+			r.finish(nd)
+		case <-ctxDoneCh:
+			ctxDoneCh = nil
+			r.fail("", ctx.Err())
+		}
+	}
+
+	results := make(map[string]NodeResult, len(r.results))
+	for id, res := range r.results {
+		results[id] = *res
+	}
+
+	return results, r.err
+}
+
+// start add a ready node to dispatcher.
+func (r *run) start(id string) {
+	n := r.w.nodes[id]
+	t := n.Task
+
+	up := make(Upstream, len(n.Deps))
+	for _, dep := range n.Deps {
+		up[dep] = r.results[dep].Out
+	}
+
+	if t.InData.TaskUID == "" {
+		t.InData.TaskUID = fmt.Sprintf("%s-%d-%s", r.w.name, r.seq, id)
+	}
+
+	if t.OriginalCtx == nil {
+		t.OriginalCtx = r.ctx
+	}
+
+	var err error
+	if n.Prepare != nil {
+		err = n.Prepare(&t, up)
+	} else if t.InData.If == nil {
+		t.InData.If = up
+	}
+
+	var h *dispatcher.Handle
+	if err == nil {
+		h, err = r.d.Submit(t)
+	}
+
+	if err != nil {
+		r.finish(nodeDone{id: id, err: err})
+		return
+	}
+
+	r.results[id].Status = NodeStatusRunning
+	r.handles[id] = h
+
+	go func() {
+		out, _ := h.Wait(context.Background())
+		r.doneCh <- nodeDone{id: id, out: out, err: out.Err}
+	}()
+}
+
+// finish a node and start downstream nodes which become ready.
+func (r *run) finish(nd nodeDone) {
+	res := r.results[nd.id]
+	res.Out = nd.out
+	res.Err = nd.err
+
+	if nd.err != nil {
+		res.Status = NodeStatusFailed
+		r.fail(nd.id, nd.err)
+		return
+	}
+
+	res.Status = NodeStatusDone
+
+	// downstream nodes are in the order added
+	for _, id := range r.w.downstream[nd.id] {
+		r.waiting[id]--
+		if r.waiting[id] == 0 && r.results[id].Status == NodeStatusPending {
+			r.start(id)
+		}
+	}
+}
+
+// fail record error, skip nodes depend on failed node, or all not finished nodes if fail fast.
+func (r *run) fail(id string, err error) {
+	if r.err == nil {
+		if id != "" {
+			r.err = &NodeError{ID: id, Err: err}
+		} else {
+			r.err = err
+		}
+	}
+
+	if id == "" || r.mode == FailFast {
+		for _, h := range r.handles {
+			h.Cancel()
+		}
+
+		for _, res := range r.results {
+			if res.Status == NodeStatusPending {
+				res.Status = NodeStatusSkipped
+				res.Err = ErrorOfUpstreamFailed
+			}
+		}
+
+		return
+	}
+
+	r.skip(id)
+}
+
+// skip pending nodes depend on a failed node.
+func (r *run) skip(id string) {
+	for _, down := range r.w.downstream[id] {
+		res := r.results[down]
+		if res.Status != NodeStatusPending {
+			continue
+		}
+
+		res.Status = NodeStatusSkipped
+		res.Err = ErrorOfUpstreamFailed
+		r.skip(down)
+	}
+}
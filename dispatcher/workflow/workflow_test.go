@@ -0,0 +1,98 @@
+package workflow_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ezgroot/ezUtils/dispatcher"
+	"github.com/ezgroot/ezUtils/dispatcher/workflow"
+)
+
+var errNode = errors.New("node error")
+
+// sum add data of task and upstream results, fail if data is "fail".
+func sum(ctx context.Context, res dispatcher.Resource, task dispatcher.Task) error {
+	if string(task.InData.Data) == "fail" {
+		return errNode
+	}
+
+	n, _ := strconv.Atoi(string(task.InData.Data))
+	for _, out := range task.InData.If.(workflow.Upstream) {
+		v, _ := strconv.Atoi(string(out.Data))
+		n += v
+	}
+
+	task.Reply(dispatcher.OutData{Data: []byte(strconv.Itoa(n))})
+	return nil
+}
+
+func node(id string, data string, deps ...string) workflow.Node {
+	return workflow.Node{ID: id, Deps: deps, Task: dispatcher.Task{InData: dispatcher.InData{Data: []byte(data)}}}
+}
+
+func TestCycle(t *testing.T) {
+	_, err := workflow.NewBuilder("cycle").
+		Add(node("a", "1", "c")).
+		Add(node("b", "1", "a")).
+		Add(node("c", "1", "b")).
+		Build()
+
+	var cycleErr *workflow.CycleError
+	if !errors.As(err, &cycleErr) || len(cycleErr.Path) != 4 {
+		t.Fatalf("cycle error = %v", err)
+	}
+
+	_, err = workflow.NewBuilder("missing").Add(node("a", "1", "x")).Build()
+	if !errors.Is(err, workflow.ErrorOfNodeNotExist) {
+		t.Fatalf("missing node error = %v", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	d := dispatcher.GetDispatch(dispatcher.Config{Name: "workflow", MaxWorkerNum: 2}, sum, nil)
+	defer d.Shutdown(context.Background())
+
+	// a1, a2 -> b -> c, x -> y
+	w, err := workflow.NewBuilder("flow").
+		Add(node("a1", "1")).
+		Add(node("a2", "2")).
+		Add(node("b", "10", "a1", "a2")).
+		Add(node("c", "100", "b")).
+		Add(node("x", "5")).
+		Add(node("y", "5", "x")).
+		Build()
+	if err != nil {
+		t.Fatalf("build error = %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	results, err := w.Run(ctx, d, workflow.FailFast)
+	if err != nil || string(results["c"].Out.Data) != "113" || string(results["y"].Out.Data) != "10" {
+		t.Fatalf("run results = %+v, error = %v", results, err)
+	}
+
+	// b fail, c is skipped, x and y still run
+	failed, _ := workflow.NewBuilder("failed").
+		Add(node("a", "1")).
+		Add(node("b", "fail", "a")).
+		Add(node("c", "1", "b")).
+		Add(node("x", "5")).
+		Add(node("y", "5", "x")).
+		Build()
+
+	results, err = failed.Run(ctx, d, workflow.ContinueOnError)
+
+	var nodeErr *workflow.NodeError
+	if !errors.As(err, &nodeErr) || nodeErr.ID != "b" || !errors.Is(err, errNode) {
+		t.Fatalf("run error = %v", err)
+	}
+
+	if results["c"].Status != workflow.NodeStatusSkipped || results["y"].Status != workflow.NodeStatusDone {
+		t.Fatalf("c status = %s, y status = %s", results["c"].Status, results["y"].Status)
+	}
+}
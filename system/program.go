@@ -2,20 +2,73 @@ package system
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
+
+	"github.com/ezgroot/ezUtils/zlog"
+)
+
+const (
+	exitWaitTime    = time.Duration(1500) * time.Millisecond
+	exitHookTimeout = time.Duration(3000) * time.Millisecond
 )
 
 type exitFunc func()
 
+// ExitHook run when process exit gracefully, like closing connections.
+type ExitHook func(ctx context.Context) error
+
+var (
+	exitHookMutex sync.Mutex
+	exitHooks     []ExitHook
+)
+
+// RegisterExitHook register a hook run after exitFunc when process exit gracefully, hooks run
+// in order registered and share a timeout of 3s, logs of zlog are flushed after all hooks.
+func RegisterExitHook(hook ExitHook) {
+	exitHookMutex.Lock()
+	defer exitHookMutex.Unlock()
+
+	exitHooks = append(exitHooks, hook)
+}
+
+// exit execute exitFunc, wait program resources released, then run exit hooks, flush logs and exit.
+func exit(exitFunc exitFunc) {
+	exitFunc()
+	time.Sleep(exitWaitTime)
+
+	exitHookMutex.Lock()
+	hooks := exitHooks
+	exitHookMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), exitHookTimeout)
+	defer cancel()
+
+	for _, hook := range hooks {
+		err := hook(ctx)
+		if err != nil {
+			fmt.Printf("exit hook error = %s\n", err)
+		}
+	}
+
+	err := zlog.Close(ctx)
+	if err != nil {
+		fmt.Printf("close log error = %s\n", err)
+	}
+
+	os.Exit(0)
+}
+
 // SecurityExitProcess Listen for system signals, execute exitFunc
-// to release program resources, and exit gracefully.
+// to release program resources, run exit hooks, flush logs of zlog, and exit gracefully.
 func SecurityExitProcess(exitFunc exitFunc) {
 	c := make(chan os.Signal, 1)
 
@@ -25,23 +78,19 @@ func SecurityExitProcess(exitFunc exitFunc) {
 		case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT:
 			{
 				fmt.Printf("security exit by %s signal.\n", s)
-				exitFunc()
-				time.Sleep(time.Millisecond * time.Duration(1500))
-				os.Exit(0)
+				exit(exitFunc)
 			}
 		default:
 			{
 				fmt.Printf("unknown exit by %s signal.\n", s)
-				exitFunc()
-				time.Sleep(time.Millisecond * time.Duration(1500))
-				os.Exit(0)
+				exit(exitFunc)
 			}
 		}
 	}
 }
 
 // SecurityExitProcessWithNotify Listen for system signals and notify, execute exitFunc
-// to release program resources, and exit gracefully.
+// to release program resources, run exit hooks, flush logs of zlog, and exit gracefully.
 func SecurityExitProcessWithNotify(exitFunc exitFunc, cc chan string) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
@@ -53,25 +102,19 @@ func SecurityExitProcessWithNotify(exitFunc exitFunc, cc chan string) {
 				case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT:
 					{
 						fmt.Printf("security exit by %s signal.\n", s)
-						exitFunc()
-						time.Sleep(time.Millisecond * time.Duration(1500))
-						os.Exit(0)
+						exit(exitFunc)
 					}
 				default:
 					{
 						fmt.Printf("unknown exit by %s signal.\n", s)
-						exitFunc()
-						time.Sleep(time.Millisecond * time.Duration(1500))
-						os.Exit(0)
+						exit(exitFunc)
 					}
 				}
 			}
 		case v := <-cc:
 			{
 				fmt.Printf("security exit by notify of %s.\n", v)
-				exitFunc()
-				time.Sleep(time.Millisecond * time.Duration(1500))
-				os.Exit(0)
+				exit(exitFunc)
 			}
 		}
 	}
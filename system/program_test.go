@@ -0,0 +1,58 @@
+package system_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/ezgroot/ezUtils/system"
+	"github.com/ezgroot/ezUtils/zlog"
+	"github.com/ezgroot/ezUtils/zlog/common"
+)
+
+const exitLogDirEnv = "SYSTEM_TEST_EXIT_LOG_DIR"
+
+func TestSecurityExitFlushLog(t *testing.T) {
+	// the process exit by SecurityExitProcessWithNotify
+	if dir := os.Getenv(exitLogDirEnv); dir != "" {
+		zlog.Init(common.Config{LogFilePath: dir, LogFilePrefix: "exit"})
+		for i := 0; i < 1000; i++ {
+			zlog.Infof("line %d", i)
+		}
+
+		system.RegisterExitHook(func(ctx context.Context) error {
+			zlog.Infof("hook")
+			return nil
+		})
+
+		notify := make(chan string, 1)
+		notify <- "test"
+		system.SecurityExitProcessWithNotify(func() {}, notify)
+		return
+	}
+
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSecurityExitFlushLog$")
+	cmd.Env = append(os.Environ(), exitLogDirEnv+"="+dir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("exit process error = %s, output = %s", err, out)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "exit=*.log"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("log files = %v error = %v", paths, err)
+	}
+
+	data, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatalf("read log file error = %s", err)
+	}
+
+	// logs queued and logged by hook are flushed before exit
+	if lines := bytes.Count(data, []byte("\n")); lines != 1001 {
+		t.Errorf("lines = %d, want 1001", lines)
+	}
+}
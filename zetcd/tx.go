@@ -63,3 +63,51 @@ func TxnDelete(ctx context.Context, client *clientv3.Client, KVList map[string]s
 
 	return response, nil
 }
+
+// TxnPutIfNotExist put a key-value pair with lease only if key not exist, leaseID 0 means no lease,
+// return false if key exist.
+func TxnPutIfNotExist(ctx context.Context, client *clientv3.Client, key string, value string, leaseID clientv3.LeaseID) (bool, error) {
+	if client == nil {
+		return false, fmt.Errorf("client is nil")
+	}
+
+	var opts []clientv3.OpOption
+	if leaseID != 0 {
+		opts = append(opts, clientv3.WithLease(leaseID))
+	}
+
+	response, err := client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, value, opts...)).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+
+	return response.Succeeded, nil
+}
+
+// TxnDeleteIfLease delete keys only if key is still put with lease, return false if key not exist
+// or put by other lease.
+func TxnDeleteIfLease(ctx context.Context, client *clientv3.Client, key string, leaseID clientv3.LeaseID, KVList map[string]string) (bool, error) {
+	if client == nil {
+		return false, fmt.Errorf("client is nil")
+	}
+
+	opList := []clientv3.Op{clientv3.OpDelete(key)}
+	for k := range KVList {
+		if k != key {
+			opList = append(opList, clientv3.OpDelete(k))
+		}
+	}
+
+	response, err := client.Txn(ctx).
+		If(clientv3.Compare(clientv3.LeaseValue(key), "=", leaseID)).
+		Then(opList...).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+
+	return response.Succeeded, nil
+}
@@ -1,14 +1,45 @@
 package zlog
 
 import (
+	"context"
+
 	"github.com/ezgroot/ezUtils/zlog/common"
 	"github.com/ezgroot/ezUtils/zlog/loger"
 	"github.com/ezgroot/ezUtils/zlog/server"
+	"github.com/ezgroot/ezUtils/zlog/sink"
 )
 
-// Init init file and screen log impl, otherwise will use default config.
+// Init init file and screen log impl, otherwise will use default config. zlog closed by Close
+// is opened again with the default sinks.
 func Init(config common.Config) {
 	loger.GetManager().SetConfig(config)
+	loger.GetManager().Open()
+}
+
+// AddSink register a sink by name, logs pass filter are written to it. Screen and file are the
+// default sinks named sink.NameOfScreen and sink.NameOfFile.
+func AddSink(name string, s sink.Sink, filter sink.Filter) error {
+	return loger.GetManager().AddSink(name, s, filter)
+}
+
+// RemoveSink unregister a sink by name and close it.
+func RemoveSink(name string) error {
+	return loger.GetManager().RemoveSink(name)
+}
+
+// GetSinkNames get names of sinks registered.
+func GetSinkNames() []string {
+	return loger.GetManager().GetSinkNames()
+}
+
+// Sync wait logs before written by screen, file and other sinks, and fsync the log file.
+func Sync(ctx context.Context) error {
+	return loger.GetManager().Sync(ctx)
+}
+
+// Close sync logs and close all sinks before process exit, logs after are dropped until Init.
+func Close(ctx context.Context) error {
+	return loger.GetManager().Close(ctx)
 }
 
 func StartPipeServer() {
@@ -23,7 +54,7 @@ func Debug(format string, v ...interface{}) {
 		}
 	}
 
-	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Debug, format, v...)
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Debug, nil, format, v...)
 }
 
 func Info(format string, v ...interface{}) {
@@ -34,7 +65,7 @@ func Info(format string, v ...interface{}) {
 		}
 	}
 
-	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Info, format, v...)
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Info, nil, format, v...)
 }
 
 func Notice(format string, v ...interface{}) {
@@ -45,7 +76,7 @@ func Notice(format string, v ...interface{}) {
 		}
 	}
 
-	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Notice, format, v...)
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Notice, nil, format, v...)
 }
 
 func Warn(format string, v ...interface{}) {
@@ -56,7 +87,7 @@ func Warn(format string, v ...interface{}) {
 		}
 	}
 
-	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Warn, format, v...)
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Warn, nil, format, v...)
 }
 
 func Error(format string, v ...interface{}) {
@@ -67,7 +98,7 @@ func Error(format string, v ...interface{}) {
 		}
 	}
 
-	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Error, format, v...)
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Error, nil, format, v...)
 }
 
 func Critical(format string, v ...interface{}) {
@@ -78,7 +109,7 @@ func Critical(format string, v ...interface{}) {
 		}
 	}
 
-	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Critical, format, v...)
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Critical, nil, format, v...)
 }
 
 func Debugf(format string, v ...interface{}) {
@@ -89,7 +120,7 @@ func Debugf(format string, v ...interface{}) {
 		}
 	}
 
-	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Debug, format, v...)
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Debug, nil, format, v...)
 }
 
 func Infof(format string, v ...interface{}) {
@@ -100,7 +131,7 @@ func Infof(format string, v ...interface{}) {
 		}
 	}
 
-	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Info, format, v...)
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Info, nil, format, v...)
 }
 
 func Noticef(format string, v ...interface{}) {
@@ -111,7 +142,7 @@ func Noticef(format string, v ...interface{}) {
 		}
 	}
 
-	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Notice, format, v...)
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Notice, nil, format, v...)
 }
 
 func Warnf(format string, v ...interface{}) {
@@ -122,7 +153,7 @@ func Warnf(format string, v ...interface{}) {
 		}
 	}
 
-	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Warn, format, v...)
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Warn, nil, format, v...)
 }
 
 func Errorf(format string, v ...interface{}) {
@@ -133,7 +164,7 @@ func Errorf(format string, v ...interface{}) {
 		}
 	}
 
-	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Error, format, v...)
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Error, nil, format, v...)
 }
 
 func Criticalf(format string, v ...interface{}) {
@@ -144,53 +175,113 @@ func Criticalf(format string, v ...interface{}) {
 		}
 	}
 
-	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Critical, format, v...)
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Critical, nil, format, v...)
 }
 
 func DebugJs(msg string, v ...interface{}) {
-	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Debug, msg, v...)
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Debug, nil, msg, v...)
 }
 
 func InfoJs(msg string, v ...interface{}) {
-	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Info, msg, v...)
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Info, nil, msg, v...)
 }
 
 func NoticeJs(msg string, v ...interface{}) {
-	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Notice, msg, v...)
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Notice, nil, msg, v...)
 }
 
 func WarnJs(msg string, v ...interface{}) {
-	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Warn, msg, v...)
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Warn, nil, msg, v...)
 }
 
 func ErrorJs(msg string, v ...interface{}) {
-	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Error, msg, v...)
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Error, nil, msg, v...)
 }
 
 func CriticalJs(msg string, v ...interface{}) {
-	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Critical, msg, v...)
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Critical, nil, msg, v...)
 }
 
 func DebugfJs(msg string, v ...interface{}) {
-	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Debug, msg, v...)
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Debug, nil, msg, v...)
 }
 
 func InfofJs(msg string, v ...interface{}) {
-	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Info, msg, v...)
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Info, nil, msg, v...)
 }
 
 func NoticefJs(msg string, v ...interface{}) {
-	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Notice, msg, v...)
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Notice, nil, msg, v...)
 }
 
 func WarnfJs(msg string, v ...interface{}) {
-	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Warn, msg, v...)
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Warn, nil, msg, v...)
 }
 
 func ErrorfJs(msg string, v ...interface{}) {
-	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Error, msg, v...)
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Error, nil, msg, v...)
 }
 
 func CriticalfJs(msg string, v ...interface{}) {
-	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Critical, msg, v...)
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Critical, nil, msg, v...)
+}
+
+// DebugKv output a key value log to screen, like DebugKv("msg", zlog.String("k", "v")).
+func DebugKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfScreen, common.Debug, msg, fields)
+}
+
+// InfoKv output a key value log to screen, like InfoKv("msg", zlog.String("k", "v")).
+func InfoKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfScreen, common.Info, msg, fields)
+}
+
+// NoticeKv output a key value log to screen, like NoticeKv("msg", zlog.String("k", "v")).
+func NoticeKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfScreen, common.Notice, msg, fields)
+}
+
+// WarnKv output a key value log to screen, like WarnKv("msg", zlog.String("k", "v")).
+func WarnKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfScreen, common.Warn, msg, fields)
+}
+
+// ErrorKv output a key value log to screen, like ErrorKv("msg", zlog.String("k", "v")).
+func ErrorKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfScreen, common.Error, msg, fields)
+}
+
+// CriticalKv output a key value log to screen, like CriticalKv("msg", zlog.String("k", "v")).
+func CriticalKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfScreen, common.Critical, msg, fields)
+}
+
+// DebugfKv output a key value log to file.
+func DebugfKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfFile, common.Debug, msg, fields)
+}
+
+// InfofKv output a key value log to file.
+func InfofKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfFile, common.Info, msg, fields)
+}
+
+// NoticefKv output a key value log to file.
+func NoticefKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfFile, common.Notice, msg, fields)
+}
+
+// WarnfKv output a key value log to file.
+func WarnfKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfFile, common.Warn, msg, fields)
+}
+
+// ErrorfKv output a key value log to file.
+func ErrorfKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfFile, common.Error, msg, fields)
+}
+
+// CriticalfKv output a key value log to file.
+func CriticalfKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfFile, common.Critical, msg, fields)
 }
@@ -12,5 +12,9 @@ type Config struct {
 	SplitSize     int64    `json:"splitSize"`     // the size of split log file on size，per - byte, default 1024*1024*5 byte
 	IsClear       bool     `json:"isClear"`       // is clear expired file
 	SavePeriod    int64    `json:"savePeriod"`    // log file save period, per - day, default 7
+	Compress      string   `json:"compress"`      // compress rotated log file by "gzip" or compressor registered like "zstd", default not compress
+	MaxTotalSize  int64    `json:"maxTotalSize"`  // max total size of log files, per - MB, default 0 means no limit
+	MaxFileNum    int      `json:"maxFileNum"`    // max number of log files, default 0 means no limit
 	UnifyTo       int      `json:"unifyTo"`       // unify all log to screen or file, default 0, means not unify.
+	Encoding      string   `json:"encoding"`      // encoding of key value log, "json" or "logfmt", default "json"
 }
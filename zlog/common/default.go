@@ -25,5 +25,9 @@ const (
 	UnifyTypeOfFile   = 2
 
 	FormatToString = 0
-	FormatToJSON   = 1
+	FormatToJSON   = 1 // one line json, NDJSON
+	FormatToLogfmt = 2
+
+	EncodingJSON   = "json"
+	EncodingLogfmt = "logfmt"
 )
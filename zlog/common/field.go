@@ -0,0 +1,51 @@
+package common
+
+import (
+	"fmt"
+)
+
+// FieldType type of field value.
+type FieldType int
+
+// field type enum
+const (
+	FieldTypeAny FieldType = iota
+	FieldTypeString
+	FieldTypeInt
+	FieldTypeFloat
+	FieldTypeBool
+	FieldTypeError
+	FieldTypeDuration
+	FieldTypeTime
+)
+
+// Field a typed key value of structured log, value of basic type is saved without boxing.
+type Field struct {
+	Key     string
+	Type    FieldType
+	Integer int64       // int, bool, duration and bits of float
+	Str     string      // string
+	Value   interface{} // error, time and any
+}
+
+// PairsToFields convert loosely paired key values to fields, key which is not string is
+// formatted by %v, value of the last key missing is nil.
+func PairsToFields(v []interface{}) []Field {
+	fields := make([]Field, 0, (len(v)+1)/2)
+
+	for i := 0; i < len(v); i += 2 {
+		key, ok := v[i].(string)
+		if !ok {
+			key = fmt.Sprintf("%v", v[i])
+		}
+
+		var value interface{}
+		if i+1 < len(v) {
+			value = v[i+1]
+		}
+
+		fields = append(fields, Field{Key: key, Type: FieldTypeAny, Value: value})
+	}
+
+	return fields
+}
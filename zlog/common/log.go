@@ -12,4 +12,5 @@ type OneLog struct {
 	Timestamp  int64
 	Format     string
 	Args       []interface{}
+	Fields     []Field
 }
@@ -15,6 +15,9 @@ const (
 // LevelMap log level map
 var LevelMap = make(map[int]string)
 
+// LevelNameMap log level name map, used by key value log
+var LevelNameMap = make(map[int]string)
+
 func init() {
 	LevelMap[Debug] = "[ DEBUG  ]"
 	LevelMap[Info] = "[  INFO  ]"
@@ -22,4 +25,11 @@ func init() {
 	LevelMap[Warn] = "[  WARN  ]"
 	LevelMap[Error] = "[ ERROR  ]"
 	LevelMap[Critical] = "[CRITICAL]"
+
+	LevelNameMap[Debug] = "debug"
+	LevelNameMap[Info] = "info"
+	LevelNameMap[Notice] = "notice"
+	LevelNameMap[Warn] = "warn"
+	LevelNameMap[Error] = "error"
+	LevelNameMap[Critical] = "critical"
 }
@@ -0,0 +1,303 @@
+// Package encoder encode key value log to one line json (NDJSON) or logfmt.
+package encoder
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ezgroot/ezUtils/zlog/common"
+	"github.com/ezgroot/ezUtils/zlog/utils"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	hex = "0123456789abcdef"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// Encode encode log by format type of it, without line feed.
+func Encode(log *common.OneLog) []byte {
+	return EncodeAs(log, log.FormatType)
+}
+
+// EncodeAs encode log by format, without line feed. String log encoded as json or logfmt use the
+// formatted message as msg, key value log encoded as string is like screen log without colour.
+func EncodeAs(log *common.OneLog, format int) []byte {
+	buf := make([]byte, 0, 256)
+
+	switch format {
+	case common.FormatToString:
+		return AppendString(buf, log)
+	case common.FormatToLogfmt:
+		return AppendLogfmt(buf, log)
+	default:
+		return AppendJSON(buf, log)
+	}
+}
+
+// AppendString append log like screen log without colour.
+func AppendString(buf []byte, log *common.OneLog) []byte {
+	buf = append(buf, common.LevelMap[log.Level]...)
+	buf = append(buf, " "+utils.GetLogTimeStr(log)+" ⇔ "...)
+	buf = append(buf, log.CallerFile...)
+	buf = append(buf, ':')
+	buf = strconv.AppendInt(buf, int64(log.CallerLine), 10)
+	buf = append(buf, " ◆ "+log.CallerPkg+" ★ "+log.CallerName+" ▶ "...)
+
+	if log.FormatType == common.FormatToString {
+		return append(buf, fmt.Sprintf(FormatWithFields(log.Format, log.Fields), log.Args...)...)
+	}
+
+	buf = append(buf, log.Format...)
+	if len(log.Fields) > 0 {
+		buf = append(buf, ' ')
+		buf = AppendLogfmtFields(buf, log.Fields)
+	}
+
+	return buf
+}
+
+// message get msg of log, string log is formatted.
+func message(log *common.OneLog) string {
+	if log.FormatType == common.FormatToString {
+		return fmt.Sprintf(log.Format, log.Args...)
+	}
+
+	return log.Format
+}
+
+// header get fixed fields of log.
+func header(log *common.OneLog) []common.Field {
+	return []common.Field{
+		{Key: "level", Type: common.FieldTypeString, Str: common.LevelNameMap[log.Level]},
+		{Key: "time", Type: common.FieldTypeString, Str: utils.GetLogTimeStr(log)},
+		{Key: "file", Type: common.FieldTypeString, Str: log.CallerFile},
+		{Key: "line", Type: common.FieldTypeInt, Integer: int64(log.CallerLine)},
+		{Key: "pkg", Type: common.FieldTypeString, Str: log.CallerPkg},
+		{Key: "func", Type: common.FieldTypeString, Str: log.CallerName},
+		{Key: "msg", Type: common.FieldTypeString, Str: message(log)},
+	}
+}
+
+// AppendJSON append log as one line json object, like {"level":"info","msg":"hi","k":1}.
+func AppendJSON(buf []byte, log *common.OneLog) []byte {
+	buf = append(buf, '{')
+
+	for i, f := range append(header(log), log.Fields...) {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+
+		buf = appendJSONString(buf, f.Key)
+		buf = append(buf, ':')
+		buf = appendJSONValue(buf, f)
+	}
+
+	return append(buf, '}')
+}
+
+// AppendLogfmt append log as logfmt, like level=info msg=hi k=1.
+func AppendLogfmt(buf []byte, log *common.OneLog) []byte {
+	return AppendLogfmtFields(buf, append(header(log), log.Fields...))
+}
+
+// AppendLogfmtFields append fields as logfmt separated by space, used by string format log.
+func AppendLogfmtFields(buf []byte, fields []common.Field) []byte {
+	for i, f := range fields {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+
+		buf = appendLogfmtKey(buf, f.Key)
+		buf = append(buf, '=')
+		buf = appendLogfmtValue(buf, f)
+	}
+
+	return buf
+}
+
+// FormatWithFields append fields as logfmt to printf format of string log, % in fields is escaped.
+func FormatWithFields(format string, fields []common.Field) string {
+	if len(fields) == 0 {
+		return format
+	}
+
+	buf := AppendLogfmtFields(make([]byte, 0, 128), fields)
+	if format == "" {
+		return strings.ReplaceAll(string(buf), "%", "%%")
+	}
+
+	return format + " " + strings.ReplaceAll(string(buf), "%", "%%")
+}
+
+func appendJSONValue(buf []byte, f common.Field) []byte {
+	switch f.Type {
+	case common.FieldTypeString:
+		return appendJSONString(buf, f.Str)
+	case common.FieldTypeInt:
+		return strconv.AppendInt(buf, f.Integer, 10)
+	case common.FieldTypeFloat:
+		v := math.Float64frombits(uint64(f.Integer))
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			// not allowed by json
+			return appendJSONString(buf, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+
+		return strconv.AppendFloat(buf, v, 'g', -1, 64)
+	case common.FieldTypeBool:
+		return strconv.AppendBool(buf, f.Integer != 0)
+	case common.FieldTypeDuration:
+		return appendJSONString(buf, time.Duration(f.Integer).String())
+	case common.FieldTypeError, common.FieldTypeTime:
+		return appendJSONString(buf, valueString(f.Value))
+	default:
+		return appendJSONAny(buf, f.Value)
+	}
+}
+
+func appendJSONAny(buf []byte, v interface{}) []byte {
+	switch value := v.(type) {
+	case nil:
+		return append(buf, "null"...)
+	case string:
+		return appendJSONString(buf, value)
+	case error, fmt.Stringer, time.Time:
+		return appendJSONString(buf, valueString(value))
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return appendJSONString(buf, fmt.Sprintf("%+v", v))
+	}
+
+	return append(buf, b...)
+}
+
+// appendJSONString append s quoted and escaped, invalid utf8 is replaced by U+FFFD.
+func appendJSONString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buf = append(buf, '\\', c)
+			case c == '\n':
+				buf = append(buf, '\\', 'n')
+			case c == '\r':
+				buf = append(buf, '\\', 'r')
+			case c == '\t':
+				buf = append(buf, '\\', 't')
+			case c < 0x20 || c == 0x7f:
+				buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			default:
+				buf = append(buf, c)
+			}
+
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			buf = append(buf, "\ufffd"...)
+		case r == '\u2028' || r == '\u2029':
+			// line separators break some ndjson readers
+			buf = append(buf, '\\', 'u', '2', '0', '2', hex[r&0xf])
+		default:
+			buf = append(buf, s[i:i+size]...)
+		}
+
+		i += size
+	}
+
+	return append(buf, '"')
+}
+
+// appendLogfmtKey append key, space, '=' , '"' and control chars are replaced by '_'.
+func appendLogfmtKey(buf []byte, key string) []byte {
+	if key == "" {
+		return append(buf, '_')
+	}
+
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f || r == utf8.RuneError {
+			buf = append(buf, '_')
+		} else {
+			buf = utf8.AppendRune(buf, r)
+		}
+	}
+
+	return buf
+}
+
+func appendLogfmtValue(buf []byte, f common.Field) []byte {
+	switch f.Type {
+	case common.FieldTypeString:
+		return appendLogfmtString(buf, f.Str)
+	case common.FieldTypeInt:
+		return strconv.AppendInt(buf, f.Integer, 10)
+	case common.FieldTypeFloat:
+		return strconv.AppendFloat(buf, math.Float64frombits(uint64(f.Integer)), 'g', -1, 64)
+	case common.FieldTypeBool:
+		return strconv.AppendBool(buf, f.Integer != 0)
+	case common.FieldTypeDuration:
+		return append(buf, time.Duration(f.Integer).String()...)
+	case common.FieldTypeError, common.FieldTypeTime:
+		return appendLogfmtString(buf, valueString(f.Value))
+	default:
+		if f.Value == nil {
+			return append(buf, "null"...)
+		}
+
+		return appendLogfmtString(buf, valueString(f.Value))
+	}
+}
+
+// appendLogfmtString append s, quoted if empty or has space, '=', '"', '\' or control chars.
+func appendLogfmtString(buf []byte, s string) []byte {
+	if needQuote(s) {
+		return appendJSONString(buf, s)
+	}
+
+	return append(buf, s...)
+}
+
+func needQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f || r == utf8.RuneError ||
+			r == '\u2028' || r == '\u2029' {
+			return true
+		}
+	}
+
+	return false
+}
+
+func valueString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case error:
+		return value.Error()
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return value.String()
+	default:
+		return fmt.Sprintf("%+v", v)
+	}
+}
@@ -0,0 +1,126 @@
+package encoder_test
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ezgroot/ezUtils/zlog"
+	"github.com/ezgroot/ezUtils/zlog/common"
+	"github.com/ezgroot/ezUtils/zlog/encoder"
+)
+
+func newLog(format int, fields ...common.Field) *common.OneLog {
+	return &common.OneLog{
+		FormatType: format,
+		Level:      common.Info,
+		CallerFile: "main.go",
+		CallerLine: 12,
+		CallerPkg:  "main",
+		CallerName: "main()",
+		Timestamp:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano(),
+		Format:     "say \"hi\"\nbye",
+		Fields:     fields,
+	}
+}
+
+func TestJSON(t *testing.T) {
+	log := newLog(common.FormatToJSON,
+		zlog.String("str", "a\"b\\c\td\x01 \xff"),
+		zlog.Int("int", -3),
+		zlog.Float64("float", 1.5),
+		zlog.Float64("nan", math.NaN()),
+		zlog.Bool("bool", true),
+		zlog.Err(errors.New("bad\nthing")),
+		zlog.Err(nil),
+		zlog.Duration("cost", 1500*time.Millisecond),
+		zlog.Any("map", map[string]int{"a": 1}),
+		zlog.Any("nil", nil),
+	)
+
+	line := encoder.Encode(log)
+	if strings.ContainsAny(string(line), "\n\r") {
+		t.Fatalf("json not one line : %s", line)
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(line, &m); err != nil {
+		t.Fatalf("invalid json = %s error = %s", line, err)
+	}
+
+	want := map[string]interface{}{
+		"level": "info",
+		"msg":   "say \"hi\"\nbye",
+		"line":  float64(12),
+		"str":   "a\"b\\c\td\x01 \ufffd",
+		"int":   float64(-3),
+		"float": 1.5,
+		"nan":   "NaN",
+		"bool":  true,
+		"error": "",
+		"cost":  "1.5s",
+		"nil":   nil,
+	}
+
+	for k, v := range want {
+		if m[k] != v {
+			t.Errorf("key = %s value = %#v, want %#v", k, m[k], v)
+		}
+	}
+
+	if inner, ok := m["map"].(map[string]interface{}); !ok || inner["a"] != float64(1) {
+		t.Errorf("map = %#v", m["map"])
+	}
+}
+
+func TestLogfmt(t *testing.T) {
+	log := newLog(common.FormatToLogfmt,
+		zlog.String("plain", "abc"),
+		zlog.String("space", "a b"),
+		zlog.String("empty", ""),
+		zlog.String("bad key=\"", "x=y"),
+		zlog.Int("int", 7),
+		zlog.Duration("cost", time.Second),
+	)
+
+	line := string(encoder.Encode(log))
+	if strings.ContainsAny(line, "\n\r") {
+		t.Fatalf("logfmt not one line : %s", line)
+	}
+
+	for _, part := range []string{
+		`level=info `,
+		`time="2020-01-01 `,
+		`msg="say \"hi\"\nbye"`,
+		` plain=abc `,
+		` space="a b" `,
+		` empty="" `,
+		` bad_key__="x=y" `,
+		` int=7 `,
+		` cost=1s`,
+	} {
+		if !strings.Contains(line, part) {
+			t.Errorf("logfmt = %s, want contain %s", line, part)
+		}
+	}
+}
+
+func TestPairsToFields(t *testing.T) {
+	log := newLog(common.FormatToJSON, common.PairsToFields([]interface{}{"a", 1, 2, "b", "c"})...)
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(encoder.Encode(log), &m); err != nil {
+		t.Fatalf("invalid json error = %s", err)
+	}
+
+	if m["a"] != float64(1) || m["2"] != "b" || m["c"] != nil {
+		t.Errorf("json = %v", m)
+	}
+
+	if _, ok := m["c"]; !ok {
+		t.Errorf("key without value is dropped")
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/ezgroot/ezUtils/zlog"
 	"github.com/ezgroot/ezUtils/zlog/common"
@@ -26,6 +29,9 @@ func main() {
 	config.SplitSize = 1000 * 1000 * 1000
 	config.IsClear = true
 	config.SavePeriod = 1
+	config.Compress = "gzip"
+	config.MaxTotalSize = 100
+	config.MaxFileNum = 24
 	config.UnifyTo = common.UnifyTypeOfOff
 
 	zlog.Init(config)
@@ -60,6 +66,17 @@ func main() {
 	zlog.ErrorfJs("ErrorJs example", "key1", "value1", "key2", 999)
 	zlog.CriticalfJs("CriticalJs example", "key1", "value1", "key2", 999)
 
+	zlog.InfoKv("InfoKv example", zlog.String("key1", "value1"), zlog.Int("key2", 999),
+		zlog.Duration("cost", 1500*time.Millisecond), zlog.Err(errors.New("quote \" and\nnewline")))
+	zlog.InfofKv("InfofKv example", zlog.String("key1", "value1"), zlog.Int("key2", 999))
+
+	ctx := zlog.NewContext(context.Background(), zlog.With(zlog.String("requestID", "r-100%")))
+	logger := zlog.FromContext(ctx).With(zlog.Int("userID", 7))
+	logger.Info("With example %s %d", "string", 222)
+	logger.InfoJs("WithJs example", "key1", "value1")
+	logger.InfoKv("WithKv example", zlog.String("key1", "value1"))
+	logger.Infof("With example %s %d", "string", 444)
+
 	securityExitProcess(quit)
 }
 
@@ -81,5 +98,13 @@ func securityExitProcess(exitFunc exitFunc) {
 }
 
 func quit() {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	err := zlog.Close(ctx)
+	cancel()
+
+	if err != nil {
+		fmt.Printf("close log error = %s\n", err)
+	}
+
 	os.Exit(0)
 }
@@ -0,0 +1,89 @@
+package zlog
+
+import (
+	"math"
+	"time"
+
+	"github.com/ezgroot/ezUtils/zlog/common"
+)
+
+// Field a typed key value of structured log.
+type Field = common.Field
+
+// String field of string.
+func String(key string, value string) Field {
+	return Field{Key: key, Type: common.FieldTypeString, Str: value}
+}
+
+// Int field of int.
+func Int(key string, value int) Field {
+	return Field{Key: key, Type: common.FieldTypeInt, Integer: int64(value)}
+}
+
+// Int64 field of int64.
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Type: common.FieldTypeInt, Integer: value}
+}
+
+// Float64 field of float64.
+func Float64(key string, value float64) Field {
+	return Field{Key: key, Type: common.FieldTypeFloat, Integer: int64(math.Float64bits(value))}
+}
+
+// Bool field of bool.
+func Bool(key string, value bool) Field {
+	var i int64
+	if value {
+		i = 1
+	}
+
+	return Field{Key: key, Type: common.FieldTypeBool, Integer: i}
+}
+
+// Err field of error with key "error", nil error is encoded as empty string.
+func Err(err error) Field {
+	return NamedErr("error", err)
+}
+
+// NamedErr field of error.
+func NamedErr(key string, err error) Field {
+	return Field{Key: key, Type: common.FieldTypeError, Value: err}
+}
+
+// Duration field of duration, encoded like 1.5s.
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Type: common.FieldTypeDuration, Integer: int64(value)}
+}
+
+// Time field of time, encoded by RFC3339Nano.
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, Type: common.FieldTypeTime, Value: value}
+}
+
+// Any field of any value, basic types use the typed field, others are encoded by json.
+func Any(key string, value interface{}) Field {
+	switch v := value.(type) {
+	case string:
+		return String(key, v)
+	case int:
+		return Int(key, v)
+	case int64:
+		return Int64(key, v)
+	case int32:
+		return Int64(key, int64(v))
+	case float64:
+		return Float64(key, v)
+	case float32:
+		return Float64(key, float64(v))
+	case bool:
+		return Bool(key, v)
+	case error:
+		return NamedErr(key, v)
+	case time.Duration:
+		return Duration(key, v)
+	case time.Time:
+		return Time(key, v)
+	default:
+		return Field{Key: key, Type: common.FieldTypeAny, Value: value}
+	}
+}
@@ -0,0 +1,342 @@
+package filelog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fileTimeLayout = "2006-01-02T15-04-05.000000000Z" // utc, sortable and allowed on windows
+	fileExt        = ".log"
+	tempExt        = ".tmp"
+
+	// CompressOfGzip gzip compressor, registered by default.
+	CompressOfGzip = "gzip"
+)
+
+// Compressor compress rotated log file.
+type Compressor interface {
+	// Ext get file extension without dot, like "gz".
+	Ext() string
+	// NewWriter get a writer compress data to w, closed when all data written.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Ext() string {
+	return "gz"
+}
+
+func (gzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+}
+
+var compressorMutex sync.RWMutex
+var compressors = map[string]Compressor{CompressOfGzip: gzipCompressor{}}
+
+// RegisterCompressor register a compressor by name used by Config.Compress, such as zstd:
+//
+//	filelog.RegisterCompressor("zstd", zstdCompressor{})
+func RegisterCompressor(name string, c Compressor) {
+	compressorMutex.Lock()
+	compressors[name] = c
+	compressorMutex.Unlock()
+}
+
+// GetCompressor get compressor by name.
+func GetCompressor(name string) (Compressor, bool) {
+	compressorMutex.RLock()
+	defer compressorMutex.RUnlock()
+
+	c, ok := compressors[name]
+
+	return c, ok
+}
+
+// FileName get name of log file created at t, like server=2021-01-02T15-04-05.000000000Z.log,
+// names of one prefix sort by time.
+func FileName(prefix string, t time.Time) string {
+	return prefix + "=" + t.UTC().Format(fileTimeLayout) + fileExt
+}
+
+// LogFile a log file of prefix in dir.
+type LogFile struct {
+	Path     string
+	Name     string
+	Prefix   string
+	Time     time.Time // time created, parsed from name or modify time of file with old name
+	Ext      string    // extension of compressor, empty if not compressed
+	ModTime  time.Time
+	Size     int64 // per - byte
+	IsParsed bool  // is time parsed from name
+}
+
+// ParseFileName parse name created by FileName, with extension of compressor or not.
+func ParseFileName(name string) (LogFile, error) {
+	index := strings.LastIndex(name, "=")
+	if index <= 0 {
+		return LogFile{}, fmt.Errorf("log file name = %s without prefix", name)
+	}
+
+	rest := name[index+1:]
+	if len(rest) < len(fileTimeLayout)+len(fileExt) || rest[len(fileTimeLayout):len(fileTimeLayout)+len(fileExt)] != fileExt {
+		return LogFile{}, fmt.Errorf("log file name = %s is not like %s", name, FileName("prefix", time.Time{}))
+	}
+
+	t, err := time.ParseInLocation(fileTimeLayout, rest[:len(fileTimeLayout)], time.UTC)
+	if err != nil {
+		return LogFile{}, fmt.Errorf("log file name = %s parse time error : %s", name, err)
+	}
+
+	ext := rest[len(fileTimeLayout)+len(fileExt):]
+	if ext != "" {
+		if ext[0] != '.' {
+			return LogFile{}, fmt.Errorf("log file name = %s with bad extension", name)
+		}
+
+		ext = ext[1:]
+	}
+
+	return LogFile{Name: name, Prefix: name[:index], Time: t, Ext: ext, IsParsed: true}, nil
+}
+
+// ListFiles get log files of prefix in dir, oldest first. Files of old name format are listed
+// by modify time.
+func ListFiles(dir string, prefix string) ([]LogFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []LogFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix+"=") || !strings.Contains(name, fileExt) ||
+			strings.HasSuffix(name, tempExt) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		file, err := ParseFileName(name)
+		if err == nil && file.Prefix != prefix {
+			// file of another prefix contain "="
+			continue
+		}
+
+		if err != nil {
+			file = LogFile{Name: name, Prefix: prefix, Time: info.ModTime()}
+			if index := strings.LastIndex(name, fileExt+"."); index > 0 {
+				file.Ext = name[index+len(fileExt)+1:]
+			}
+		}
+
+		file.Path = filepath.Join(dir, name)
+		file.ModTime = info.ModTime()
+		file.Size = info.Size()
+		files = append(files, file)
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if !files[i].Time.Equal(files[j].Time) {
+			return files[i].Time.Before(files[j].Time)
+		}
+
+		return files[i].Name < files[j].Name
+	})
+
+	return files, nil
+}
+
+// ArchiveConfig config of compression and retention of rotated log files.
+type ArchiveConfig struct {
+	Dir          string
+	Prefix       string
+	Current      string // path of file being written, it and newer files are never compressed or removed, the newest file if empty
+	Compress     string // name of compressor, empty means not compress
+	MaxTotalSize int64  // max total size of files, per - MB, 0 means no limit
+	MaxFileNum   int    // max number of files, 0 means no limit
+	SavePeriod   int64  // files not modified in period are removed, per - day, 0 means no limit
+}
+
+// Archive compress rotated files and remove files beyond retention, oldest first.
+func Archive(c ArchiveConfig) error {
+	files, err := ListFiles(c.Dir, c.Prefix)
+	if err != nil {
+		return err
+	}
+
+	// unknown compressor only skips compressing, retention still runs
+	var firstErr error
+	var compressor Compressor
+	if c.Compress != "" {
+		var ok bool
+		compressor, ok = GetCompressor(c.Compress)
+		if !ok {
+			firstErr = fmt.Errorf("compressor = %s not registered", c.Compress)
+		}
+	}
+
+	// files created after Current is got are being written too
+	current, _ := ParseFileName(filepath.Base(c.Current))
+	isWriting := func(i int) bool {
+		if c.Current == "" {
+			return i == len(files)-1
+		}
+
+		return samePath(files[i].Path, c.Current) ||
+			(current.IsParsed && files[i].IsParsed && !files[i].Time.Before(current.Time))
+	}
+
+	for i := range files {
+		if compressor == nil || files[i].Ext != "" || isWriting(i) {
+			continue
+		}
+
+		path, size, err := compressFile(files[i].Path, compressor)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			continue
+		}
+
+		files[i].Path = path
+		files[i].Name = filepath.Base(path)
+		files[i].Ext = compressor.Ext()
+		files[i].Size = size
+	}
+
+	err = retain(files, c, isWriting)
+	if firstErr == nil {
+		firstErr = err
+	}
+
+	return firstErr
+}
+
+// retain remove files beyond retention, files are sorted oldest first.
+func retain(files []LogFile, c ArchiveConfig, isWriting func(i int) bool) error {
+	var expire time.Time
+	if c.SavePeriod > 0 {
+		expire = time.Now().Add(-time.Duration(c.SavePeriod*60*60*24) * time.Second)
+	}
+
+	var firstErr error
+	var totalSize int64
+	var num int
+	for i := len(files) - 1; i >= 0; i-- {
+		file := files[i]
+		if isWriting(i) {
+			totalSize += file.Size
+			num++
+			continue
+		}
+
+		isRemove := (c.MaxFileNum > 0 && num+1 > c.MaxFileNum) ||
+			(c.MaxTotalSize > 0 && totalSize+file.Size > c.MaxTotalSize*1024*1024) ||
+			(!expire.IsZero() && file.ModTime.Before(expire))
+		if !isRemove {
+			totalSize += file.Size
+			num++
+			continue
+		}
+
+		err := os.Remove(file.Path)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			continue
+		}
+
+		fmt.Printf("[INFO] delete log file = %s\n", file.Path)
+	}
+
+	return firstErr
+}
+
+// compressFile compress file to path.ext and remove it, modify time is kept.
+func compressFile(path string, c Compressor) (string, int64, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+
+	dstPath := path + "." + c.Ext()
+	tempPath := dstPath + tempExt
+
+	dst, err := os.OpenFile(tempPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", 0, err
+	}
+
+	err = func() error {
+		w, err := c.NewWriter(dst)
+		if err != nil {
+			return err
+		}
+
+		if _, err = io.Copy(w, src); err != nil {
+			w.Close()
+			return err
+		}
+
+		if err = w.Close(); err != nil {
+			return err
+		}
+
+		return dst.Sync()
+	}()
+
+	closeErr := dst.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tempPath, dstPath)
+	}
+
+	if err != nil {
+		os.Remove(tempPath)
+		return "", 0, fmt.Errorf("compress log file = %s error : %s", path, err)
+	}
+
+	src.Close()
+	_ = os.Chtimes(dstPath, info.ModTime(), info.ModTime())
+
+	dstInfo, err := os.Stat(dstPath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err = os.Remove(path); err != nil {
+		return "", 0, err
+	}
+
+	return dstPath, dstInfo.Size(), nil
+}
+
+func samePath(a string, b string) bool {
+	return b != "" && filepath.Clean(a) == filepath.Clean(b)
+}
@@ -0,0 +1,166 @@
+package filelog_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ezgroot/ezUtils/zlog/filelog"
+)
+
+func TestFileName(t *testing.T) {
+	base := time.Date(2021, 12, 31, 23, 59, 59, 999999999, time.FixedZone("CST", 8*60*60))
+
+	var names []string
+	for _, d := range []time.Duration{time.Hour, time.Nanosecond, 0, 10 * time.Second} {
+		names = append(names, filelog.FileName("server", base.Add(d)))
+	}
+
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	if sorted[0] != names[2] || sorted[1] != names[1] || sorted[2] != names[3] || sorted[3] != names[0] {
+		t.Errorf("names not sorted by time = %v", sorted)
+	}
+
+	file, err := filelog.ParseFileName(names[2] + ".gz")
+	if err != nil {
+		t.Fatalf("parse name error = %s", err)
+	}
+
+	if file.Prefix != "server" || !file.Time.Equal(base) || file.Ext != "gz" {
+		t.Errorf("parse name = %s file = %+v", names[2], file)
+	}
+
+	for _, name := range []string{"server.log", "server=2021-01-01@00-00-00@1.log", "server=" + names[0][7:] + "gz"} {
+		if _, err = filelog.ParseFileName(name); err == nil {
+			t.Errorf("parse bad name = %s without error", name)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("write file error = %s", err)
+	}
+
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("change file time error = %s", err)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	// random data is not compressed smaller
+	data := make([]byte, 400*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	var paths []string
+	for i := 0; i < 4; i++ {
+		created := now.Add(time.Duration(i-4) * time.Hour)
+		path := filepath.Join(dir, filelog.FileName("server", created))
+		writeFile(t, path, data, created.Add(time.Minute))
+		paths = append(paths, path)
+	}
+
+	legacy := filepath.Join(dir, "server=2020-01-01@00-00-00@123456789.log")
+	writeFile(t, legacy, []byte("old"), now.Add(-10*24*time.Hour))
+	other := filepath.Join(dir, "other="+filepath.Base(paths[0])[len("server="):])
+	writeFile(t, other, []byte("other"), now)
+
+	c := filelog.ArchiveConfig{
+		Dir:          dir,
+		Prefix:       "server",
+		Current:      paths[3],
+		Compress:     filelog.CompressOfGzip,
+		MaxTotalSize: 1,
+		SavePeriod:   7,
+	}
+
+	if err := filelog.Archive(c); err != nil {
+		t.Fatalf("archive error = %s", err)
+	}
+
+	// budget keep the current and the newest rotated file
+	files, err := filelog.ListFiles(dir, "server")
+	if err != nil {
+		t.Fatalf("list files error = %s", err)
+	}
+
+	if len(files) != 2 || files[0].Path != paths[2]+".gz" || files[1].Path != paths[3] {
+		t.Fatalf("files = %+v", files)
+	}
+
+	f, err := os.Open(files[0].Path)
+	if err != nil {
+		t.Fatalf("open compressed file error = %s", err)
+	}
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip reader error = %s", err)
+	}
+
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("decompressed data not equal, error = %v", err)
+	}
+
+	if _, err = os.Stat(other); err != nil {
+		t.Errorf("file of other prefix removed")
+	}
+
+	c.MaxTotalSize = 0
+	c.MaxFileNum = 1
+	if err = filelog.Archive(c); err != nil {
+		t.Fatalf("archive error = %s", err)
+	}
+
+	files, _ = filelog.ListFiles(dir, "server")
+	if len(files) != 1 || files[0].Path != paths[3] {
+		t.Errorf("files = %+v", files)
+	}
+}
+
+func TestArchiveUnknownCompressor(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	var paths []string
+	for i := 0; i < 3; i++ {
+		created := now.Add(time.Duration(i-3) * time.Hour)
+		path := filepath.Join(dir, filelog.FileName("server", created))
+		writeFile(t, path, []byte("data"), created.Add(time.Minute))
+		paths = append(paths, path)
+	}
+
+	c := filelog.ArchiveConfig{
+		Dir:        dir,
+		Prefix:     "server",
+		Current:    paths[2],
+		Compress:   "unknown",
+		MaxFileNum: 1,
+	}
+
+	if err := filelog.Archive(c); err == nil {
+		t.Errorf("archive with unknown compressor no error")
+	}
+
+	// retention still run without compressing
+	files, err := filelog.ListFiles(dir, "server")
+	if err != nil {
+		t.Fatalf("list files error = %s", err)
+	}
+
+	if len(files) != 1 || files[0].Path != paths[2] {
+		t.Errorf("files = %+v", files)
+	}
+}
@@ -1,20 +1,26 @@
 package filelog
 
 import (
+	"context"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/ezgroot/ezUtils/zlog/common"
+	"github.com/ezgroot/ezUtils/zlog/encoder"
 	"github.com/ezgroot/ezUtils/zlog/utils"
 )
 
+// queuedLog a log or a flush marker in queue.
+type queuedLog struct {
+	log     common.OneLog
+	flushed chan struct{} // not nil means flush marker, closed when logs queued before written
+}
+
 // LoggerImpl file log impl
 type LoggerImpl struct {
 	log             *log.Logger
@@ -22,7 +28,7 @@ type LoggerImpl struct {
 	curFileTime     int64
 	logFileFullPath string
 
-	logQueue chan common.OneLog
+	logQueue chan queuedLog
 
 	logFilePath   string
 	logFilePrefix string
@@ -32,6 +38,12 @@ type LoggerImpl struct {
 	splitSize     int64
 	isClear       bool
 	savePeriod    int64
+	compress      string
+	maxTotalSize  int64
+	maxFileNum    int
+
+	file      *os.File
+	archiveCh chan struct{}
 }
 
 func newLoggerImpl() *LoggerImpl {
@@ -45,9 +57,10 @@ func newLoggerImpl() *LoggerImpl {
 		splitPeriod: common.DefaultSplitPeriod,
 		isSizeSplit: true,
 		splitSize:   common.DefaultSplitSize,
-		logQueue:    make(chan common.OneLog, common.FileLogQueueMaxNumber),
+		logQueue:    make(chan queuedLog, common.FileLogQueueMaxNumber),
 		isClear:     true,
-		savePeriod:  common.DefaultLogFileSavePeriod}
+		savePeriod:  common.DefaultLogFileSavePeriod,
+		archiveCh:   make(chan struct{}, 1)}
 
 	go impl.listenLogQueue()
 
@@ -76,68 +89,54 @@ func (f *LoggerImpl) writeStr(log common.OneLog) {
 		log.CallerName+" ▶ ")
 
 	f.log.SetPrefix(prefixStr)
-	f.log.Printf(log.Format, log.Args...)
+	f.log.Printf(encoder.FormatWithFields(log.Format, log.Fields), log.Args...)
 }
 
-func (f *LoggerImpl) writeJSON(log common.OneLog) {
-	timeStr := utils.GetLogTimeStr(&log)
-
-	str1 := "\n" + "    " + utils.GetJSONStr("level", common.LevelMap[log.Level]) + ",\n" +
-		"    " + utils.GetJSONStr("time", timeStr) + ",\n" +
-		"    " + utils.GetJSONStr("file", log.CallerFile) + ",\n" +
-		"    " + utils.GetJSONStr("line", log.CallerLine) + ",\n" +
-		"    " + utils.GetJSONStr("pkg", log.CallerPkg) + ",\n" +
-		"    " + utils.GetJSONStr("func", log.CallerName) + ",\n" +
-		"    " + utils.GetJSONStr("msg", log.Format) + ",\n"
-
-	var key string
-	var ok bool
-	for i, value := range log.Args {
-		if i%2 == 0 {
-			key, ok = value.(string)
-			if !ok {
-
-			}
-		} else {
-			if i == len(log.Args)-1 {
-				str1 += ("    " + utils.GetJSONStr(key, value) + "\n")
-			} else {
-				str1 += ("    " + utils.GetJSONStr(key, value) + ",\n")
-			}
-		}
-	}
-
-	str1 = "{" + str1 + "}"
+func (f *LoggerImpl) writeEncoded(log common.OneLog) {
 	f.log.SetPrefix("")
-	f.log.Printf("%s", str1)
+	f.log.Printf("%s", encoder.Encode(&log))
 }
 
 func (f *LoggerImpl) write(log common.OneLog) {
 	if log.FormatType == common.FormatToString {
 		f.writeStr(log)
-	} else if log.FormatType == common.FormatToJSON {
-		f.writeJSON(log)
+	} else if log.FormatType == common.FormatToJSON || log.FormatType == common.FormatToLogfmt {
+		f.writeEncoded(log)
 	} else {
 		f.writeStr(log)
 	}
 }
 
 func (f *LoggerImpl) listenLogQueue() {
-	for l := range f.logQueue {
+	for q := range f.logQueue {
+		if q.flushed != nil {
+			close(q.flushed)
+			continue
+		}
+
+		f.mutex.Lock()
 		if f.isSplitLogFile() {
 			err := f.initFileLogImpl()
 			if err != nil {
+				f.mutex.Unlock()
 				fmt.Printf("[WARN] init fileLog impl error = %s\n", err)
-				f.logQueue <- l
+				f.logQueue <- q
 				continue
 			}
 		}
 
-		f.write(l)
+		f.write(q.log)
+		f.mutex.Unlock()
 	}
 }
 
+// isSplitLogFile must hold lock.
 func (f *LoggerImpl) isSplitLogFile() bool {
+	// config changed
+	if f.log == nil {
+		return true
+	}
+
 	t := time.Now()
 	timeNow := t.UTC().Unix()
 
@@ -158,33 +157,14 @@ func (f *LoggerImpl) isSplitLogFile() bool {
 	return false
 }
 
+// initFileLogImpl must hold lock.
 func (f *LoggerImpl) initFileLogImpl() error {
 	t := time.Now()
 	f.curFileTime = t.UTC().Unix()
-	timestamp := strconv.FormatInt(t.UTC().UnixNano(), 10)
-	var timeTmp = string(timestamp[10:19])
-	timeNow := t.Format("2006-01-02 15:04:05")
-	timeNow = strings.Replace(timeNow, " ", "@", -1)
-	filenameTmp := strings.Replace(timeNow, ":", "-", -1)
-
-	var fileName string
-	if utils.GetOS() == utils.Windows {
-		fileName = f.logFilePath + "\\" + f.logFilePrefix + "=" + filenameTmp + "@" + timeTmp + ".log"
-	} else if utils.GetOS() == utils.Linux {
-		if strings.HasSuffix(f.logFilePath, "/") {
-			fileName = f.logFilePath + f.logFilePrefix + "=" + filenameTmp + "@" + timeTmp + ".log"
-		} else {
-			fileName = f.logFilePath + "/" + f.logFilePrefix + "=" + filenameTmp + "@" + timeTmp + ".log"
-		}
-	} else if utils.GetOS() == utils.Darwin {
-		fileName = f.logFilePath + "/" + f.logFilePrefix + "=" + filenameTmp + "@" + timestamp + ".log"
-	} else {
-		return fmt.Errorf("[WARN] error system type = %s", utils.GetOS())
-	}
 
-	f.logFileFullPath = fileName
+	fileName := filepath.Join(f.logFilePath, FileName(f.logFilePrefix, t))
 
-	var logFile io.Writer
+	var logFile *os.File
 	_, err := os.Stat(f.logFilePath)
 	if err == nil {
 		logFile, err = os.Create(fileName)
@@ -215,78 +195,125 @@ func (f *LoggerImpl) initFileLogImpl() error {
 		}
 	}
 
+	if err != nil {
+		return err
+	}
+
+	// rotated file is compressed in background
+	if f.file != nil {
+		f.file.Sync()
+		f.file.Close()
+		f.notifyArchive()
+	}
+
+	f.file = logFile
+	f.logFileFullPath = fileName
 	f.log = log.New(logFile, "[INIT]-", 0)
 
-	return err
+	return nil
 }
 
+func (f *LoggerImpl) notifyArchive() {
+	select {
+	case f.archiveCh <- struct{}{}:
+	default:
+	}
+}
+
+// clearAndRecycle compress rotated files and remove files beyond retention, when file rotated
+// or every 12 hours.
 func (f *LoggerImpl) clearAndRecycle() {
 	for {
+		f.mutex.Lock()
+		c := ArchiveConfig{
+			Dir:          f.logFilePath,
+			Prefix:       f.logFilePrefix,
+			Current:      f.logFileFullPath,
+			Compress:     f.compress,
+			MaxTotalSize: f.maxTotalSize,
+			MaxFileNum:   f.maxFileNum,
+		}
 		if f.isClear {
-			_, err := os.Stat(f.logFilePath)
-			if err != nil {
-				time.Sleep(time.Duration(30) * time.Second)
-				continue
-			}
+			c.SavePeriod = f.savePeriod
+		}
+		f.mutex.Unlock()
 
-			rd, err := ioutil.ReadDir(f.logFilePath)
-			if err == nil {
-				for _, fi := range rd {
-					if fi.IsDir() {
-						continue
-					}
-
-					var fileFullPath string
-					if utils.GetOS() == utils.Windows {
-						fileFullPath = f.logFilePath + "\\" + fi.Name()
-					} else if utils.GetOS() == utils.Linux {
-						if strings.HasSuffix(f.logFilePath, "/") {
-							fileFullPath = f.logFilePath + fi.Name()
-						} else {
-							fileFullPath = f.logFilePath + "/" + fi.Name()
-						}
-					} else if utils.GetOS() == utils.Darwin {
-						fileFullPath = f.logFilePath + "/" + fi.Name()
-					} else {
-						fmt.Printf("[WARN] error system type = %s\n", utils.GetOS())
-						continue
-					}
-
-					fileInfo, err := utils.IsExist(fileFullPath)
-					if err != nil {
-						fmt.Printf("[WARN] check file exist error = %s\n", err)
-						continue
-					}
-
-					if strings.HasPrefix(fileInfo.Name(), f.logFilePrefix) && strings.HasSuffix(fileInfo.Name(), ".log") {
-						timeFile := fileInfo.ModTime()
-						fileExpireTime := timeFile.Add(time.Duration(f.savePeriod*60*60*24) * time.Second)
-						if fileExpireTime.Before(time.Now()) {
-							err = os.Remove(fileFullPath)
-							if err != nil {
-								fmt.Printf("[WARN] delete file error = %s\n", err)
-							} else {
-								fmt.Printf("[INFO] delete expired log file = %s", fileFullPath)
-							}
-						}
-					}
-				}
-			} else {
-				fmt.Printf("[WARN] read dir = %s error = %s\n", f.logFileFullPath, err)
-			}
+		err := Archive(c)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Printf("[WARN] archive log dir = %s error = %s\n", c.Dir, err)
 		}
 
-		time.Sleep(time.Duration(60*60*12) * time.Second)
+		select {
+		case <-f.archiveCh:
+		case <-time.After(time.Duration(60*60*12) * time.Second):
+		}
 	}
 }
 
 // Add push a file log to queue.
 func (f *LoggerImpl) Add(log *common.OneLog) {
-	f.logQueue <- *log
+	f.logQueue <- queuedLog{log: *log}
+}
+
+// Sync implement sink.Syncer, wait logs added before written and fsync the file.
+func (f *LoggerImpl) Sync(ctx context.Context) error {
+	flushed := make(chan struct{})
+
+	select {
+	case f.logQueue <- queuedLog{flushed: flushed}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	return f.file.Sync()
+}
+
+// Write implement sink.Sink, used as the default file sink.
+func (f *LoggerImpl) Write(log *common.OneLog) error {
+	f.Add(log)
+
+	return nil
+}
+
+// Close implement sink.Sink, fsync and close the file, a new file is created if log written after.
+func (f *LoggerImpl) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Sync()
+	closeErr := f.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	f.file = nil
+	f.log = nil
+
+	return err
 }
 
 // SetLoggerConfig set screen logger config
 func (f *LoggerImpl) SetLoggerConfig(c common.Config) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
 	if c.LogFilePath == "" {
 		f.logFilePath = common.DefaultLogFilePath
 	} else {
@@ -323,5 +350,16 @@ func (f *LoggerImpl) SetLoggerConfig(c common.Config) {
 		f.logFilePrefix = c.LogFilePrefix
 	}
 
+	if c.Compress != "" {
+		if _, ok := GetCompressor(c.Compress); !ok {
+			fmt.Printf("[WARN] log compressor = %s not registered\n", c.Compress)
+		}
+	}
+
+	f.compress = c.Compress
+	f.maxTotalSize = c.MaxTotalSize
+	f.maxFileNum = c.MaxFileNum
+
 	f.log = nil
+	f.notifyArchive()
 }
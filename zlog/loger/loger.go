@@ -1,21 +1,43 @@
 package loger
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ezgroot/ezUtils/zlog/common"
 	"github.com/ezgroot/ezUtils/zlog/filelog"
 	"github.com/ezgroot/ezUtils/zlog/screenlog"
+	"github.com/ezgroot/ezUtils/zlog/sink"
 	"github.com/ezgroot/ezUtils/zlog/utils"
 )
 
+// sinkEntry a registered sink.
+type sinkEntry struct {
+	name   string
+	sink   sink.Sink
+	filter sink.Filter
+}
+
+// queuedLog a log or a flush marker in queue.
+type queuedLog struct {
+	log     *common.OneLog
+	flushed chan struct{} // not nil means flush marker, closed when logs queued before written
+}
+
 // Manager manage all log
 type Manager struct {
 	Conf  common.Config
-	queue chan *common.OneLog
+	queue chan queuedLog
+
+	sinkMutex sync.RWMutex
+	sinks     []*sinkEntry // copy on write
+
+	closeMutex sync.RWMutex // push hold read lock, so no log put to queue after closed
+	closed     int32
 }
 
 // filterLog filter logs
@@ -49,17 +71,172 @@ func (m *Manager) filterLog(level int, module string) bool {
 }
 
 func (m *Manager) run() {
-	for {
-		log := <-m.queue
+	for q := range m.queue {
+		if q.flushed != nil {
+			close(q.flushed)
+			continue
+		}
+
+		log := q.log
+
+		// logs not unified to screen or file go to screen
+		if log.OutTo != common.UnifyTypeOfFile {
+			log.OutTo = common.UnifyTypeOfScreen
+		}
+
+		m.sinkMutex.RLock()
+		sinks := m.sinks
+		m.sinkMutex.RUnlock()
+
+		for _, e := range sinks {
+			if !e.filter.Match(log) {
+				continue
+			}
+
+			// disconnected error is not warned for every log, the dial error has been warned
+			err := e.sink.Write(log)
+			if err != nil && err != sink.ErrorOfSinkDisconnected {
+				fmt.Printf("[WARN] zlog sink = %s write error = %s\n", e.name, err)
+			}
+		}
+	}
+}
+
+// Sync wait logs added before written to sinks, and sync sinks implement sink.Syncer.
+func (m *Manager) Sync(ctx context.Context) error {
+	flushed := make(chan struct{})
+
+	select {
+	case m.queue <- queuedLog{flushed: flushed}:
+	case <-ctx.Done():
+		return fmt.Errorf("sync log error : %w", ctx.Err())
+	}
+
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		return fmt.Errorf("sync log error : %w", ctx.Err())
+	}
+
+	m.sinkMutex.RLock()
+	sinks := m.sinks
+	m.sinkMutex.RUnlock()
 
-		if log.OutTo == common.UnifyTypeOfScreen {
-			screenlog.GetScreenLogImpl().Show(log)
-		} else if log.OutTo == common.UnifyTypeOfFile {
-			filelog.GetFileLogImpl().Add(log)
+	var firstErr error
+	for _, e := range sinks {
+		syncer, ok := e.sink.(sink.Syncer)
+		if !ok {
+			continue
+		}
+
+		err := syncer.Sync(ctx)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("sync sink = %s error : %w", e.name, err)
+		}
+	}
+
+	return firstErr
+}
+
+// Open reopen manager closed with default sinks.
+func (m *Manager) Open() {
+	m.closeMutex.Lock()
+	defer m.closeMutex.Unlock()
+
+	if atomic.LoadInt32(&(m.closed)) == 0 {
+		return
+	}
+
+	m.addDefaultSinks()
+	atomic.StoreInt32(&(m.closed), 0)
+}
+
+func (m *Manager) addDefaultSinks() {
+	_ = m.AddSink(sink.NameOfScreen, screenlog.GetScreenLogImpl(), sink.Filter{OutTo: common.UnifyTypeOfScreen})
+	_ = m.AddSink(sink.NameOfFile, filelog.GetFileLogImpl(), sink.Filter{OutTo: common.UnifyTypeOfFile})
+}
+
+// Close sync and close all sinks, logs added after are dropped until Open.
+func (m *Manager) Close(ctx context.Context) error {
+	// wait logs being pushed put to queue, so they are synced
+	m.closeMutex.Lock()
+	isClosed := !atomic.CompareAndSwapInt32(&(m.closed), 0, 1)
+	m.closeMutex.Unlock()
+
+	if isClosed {
+		return nil
+	}
+
+	firstErr := m.Sync(ctx)
+
+	m.sinkMutex.Lock()
+	sinks := m.sinks
+	m.sinks = nil
+	m.sinkMutex.Unlock()
+
+	for _, e := range sinks {
+		err := e.sink.Close()
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("close sink = %s error : %w", e.name, err)
+		}
+	}
+
+	return firstErr
+}
+
+// AddSink register a sink by name, logs pass filter are written to it.
+func (m *Manager) AddSink(name string, s sink.Sink, filter sink.Filter) error {
+	m.sinkMutex.Lock()
+	defer m.sinkMutex.Unlock()
+
+	for _, e := range m.sinks {
+		if e.name == name {
+			return fmt.Errorf("add sink = %s error : %w", name, sink.ErrorOfSinkExist)
+		}
+	}
+
+	sinks := make([]*sinkEntry, 0, len(m.sinks)+1)
+	sinks = append(sinks, m.sinks...)
+	m.sinks = append(sinks, &sinkEntry{name: name, sink: s, filter: filter})
+
+	return nil
+}
+
+// RemoveSink unregister a sink by name and close it.
+func (m *Manager) RemoveSink(name string) error {
+	m.sinkMutex.Lock()
+
+	var removed *sinkEntry
+	sinks := make([]*sinkEntry, 0, len(m.sinks))
+	for _, e := range m.sinks {
+		if e.name == name {
+			removed = e
 		} else {
-			screenlog.GetScreenLogImpl().Show(log)
+			sinks = append(sinks, e)
 		}
 	}
+
+	m.sinks = sinks
+	m.sinkMutex.Unlock()
+
+	if removed == nil {
+		return fmt.Errorf("remove sink = %s error : %w", name, sink.ErrorOfSinkNotExist)
+	}
+
+	return removed.sink.Close()
+}
+
+// GetSinkNames get names of sinks in order registered.
+func (m *Manager) GetSinkNames() []string {
+	m.sinkMutex.RLock()
+	defer m.sinkMutex.RUnlock()
+
+	names := make([]string, 0, len(m.sinks))
+	for _, e := range m.sinks {
+		names = append(names, e.name)
+	}
+
+	return names
 }
 
 // SetConfig set manager config
@@ -77,8 +254,28 @@ func (m *Manager) SetConfig(c common.Config) {
 	filelog.GetFileLogImpl().SetLoggerConfig(m.Conf)
 }
 
-// Add add log
-func (m *Manager) Add(outTo int, format int, level int, msg string, v ...interface{}) {
+// Add add log with fields of logger, key values of json log are paired in v.
+func (m *Manager) Add(outTo int, format int, level int, fields []common.Field, msg string, v ...interface{}) {
+	log := &common.OneLog{}
+
+	if !m.filterLog(level, log.CallerPkg) {
+		return
+	}
+
+	utils.ThirdCallerInfo(log)
+
+	if format == common.FormatToJSON {
+		log.Fields = append(append(make([]common.Field, 0, len(fields)+len(v)/2+1), fields...), common.PairsToFields(v)...)
+	} else {
+		log.Fields = fields
+		log.Args = v
+	}
+
+	m.push(log, outTo, format, level, msg)
+}
+
+// AddFields add key value log, encoded by Conf.Encoding.
+func (m *Manager) AddFields(outTo int, level int, msg string, fields []common.Field) {
 	log := &common.OneLog{}
 
 	if !m.filterLog(level, log.CallerPkg) {
@@ -87,6 +284,24 @@ func (m *Manager) Add(outTo int, format int, level int, msg string, v ...interfa
 
 	utils.ThirdCallerInfo(log)
 
+	format := common.FormatToJSON
+	if m.Conf.Encoding == common.EncodingLogfmt {
+		format = common.FormatToLogfmt
+	}
+
+	log.Fields = fields
+
+	m.push(log, outTo, format, level, msg)
+}
+
+func (m *Manager) push(log *common.OneLog, outTo int, format int, level int, msg string) {
+	m.closeMutex.RLock()
+	defer m.closeMutex.RUnlock()
+
+	if atomic.LoadInt32(&(m.closed)) == 1 {
+		return
+	}
+
 	if m.Conf.UnifyTo != 0 {
 		log.OutTo = m.Conf.UnifyTo
 	} else {
@@ -96,7 +311,6 @@ func (m *Manager) Add(outTo int, format int, level int, msg string, v ...interfa
 	log.FormatType = format
 	log.Level = level
 	log.Format = msg
-	log.Args = v
 
 	t := time.Now()
 	log.Timestamp = t.UnixNano()
@@ -110,7 +324,7 @@ func (m *Manager) Add(outTo int, format int, level int, msg string, v ...interfa
 		fmt.Printf("manager log queue is nearly full!!!\n")
 	}
 
-	m.queue <- log
+	m.queue <- queuedLog{log: log}
 }
 
 func newManager() *Manager {
@@ -130,9 +344,11 @@ func newManager() *Manager {
 
 	c.Modules = append(c.Modules, common.ModulesAll)
 
-	m := &Manager{queue: make(chan *common.OneLog, common.ManagerQueueMaxNumber), Conf: c}
+	m := &Manager{queue: make(chan queuedLog, common.ManagerQueueMaxNumber), Conf: c}
 	m.SetConfig(c)
 
+	m.addDefaultSinks()
+
 	go m.run()
 
 	return m
@@ -0,0 +1,212 @@
+package zlog
+
+import (
+	"context"
+
+	"github.com/ezgroot/ezUtils/zlog/common"
+	"github.com/ezgroot/ezUtils/zlog/loger"
+)
+
+// Logger carry fields like request id, which are appended to every log of it, in string log
+// as logfmt after message. Logger is immutable and safe for concurrent use.
+type Logger struct {
+	fields []Field
+}
+
+type contextKey struct{}
+
+var root = &Logger{}
+
+// With create a logger with fields.
+func With(fields ...Field) *Logger {
+	return root.With(fields...)
+}
+
+// NewContext get a context carry the logger.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext get logger of context, a logger without fields if none.
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(contextKey{}).(*Logger); ok && l != nil {
+			return l
+		}
+	}
+
+	return root
+}
+
+// With create a child logger with fields of l and fields.
+func (l *Logger) With(fields ...Field) *Logger {
+	if len(fields) == 0 {
+		return l
+	}
+
+	return &Logger{fields: l.merge(fields)}
+}
+
+// Fields get fields of logger.
+func (l *Logger) Fields() []Field {
+	return append([]Field(nil), l.fields...)
+}
+
+// merge get a new slice of fields of l and fields.
+func (l *Logger) merge(fields []Field) []Field {
+	return append(append(make([]Field, 0, len(l.fields)+len(fields)), l.fields...), fields...)
+}
+
+func defaultFormat(format string, v []interface{}) string {
+	if format == "" {
+		for i := 0; i < len(v); i++ {
+			format += "%v "
+		}
+	}
+
+	return format
+}
+
+func (l *Logger) Debug(format string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Debug, l.fields, defaultFormat(format, v), v...)
+}
+
+func (l *Logger) Info(format string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Info, l.fields, defaultFormat(format, v), v...)
+}
+
+func (l *Logger) Notice(format string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Notice, l.fields, defaultFormat(format, v), v...)
+}
+
+func (l *Logger) Warn(format string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Warn, l.fields, defaultFormat(format, v), v...)
+}
+
+func (l *Logger) Error(format string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Error, l.fields, defaultFormat(format, v), v...)
+}
+
+func (l *Logger) Critical(format string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToString, common.Critical, l.fields, defaultFormat(format, v), v...)
+}
+
+func (l *Logger) Debugf(format string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Debug, l.fields, defaultFormat(format, v), v...)
+}
+
+func (l *Logger) Infof(format string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Info, l.fields, defaultFormat(format, v), v...)
+}
+
+func (l *Logger) Noticef(format string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Notice, l.fields, defaultFormat(format, v), v...)
+}
+
+func (l *Logger) Warnf(format string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Warn, l.fields, defaultFormat(format, v), v...)
+}
+
+func (l *Logger) Errorf(format string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Error, l.fields, defaultFormat(format, v), v...)
+}
+
+func (l *Logger) Criticalf(format string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToString, common.Critical, l.fields, defaultFormat(format, v), v...)
+}
+
+func (l *Logger) DebugJs(msg string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Debug, l.fields, msg, v...)
+}
+
+func (l *Logger) InfoJs(msg string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Info, l.fields, msg, v...)
+}
+
+func (l *Logger) NoticeJs(msg string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Notice, l.fields, msg, v...)
+}
+
+func (l *Logger) WarnJs(msg string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Warn, l.fields, msg, v...)
+}
+
+func (l *Logger) ErrorJs(msg string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Error, l.fields, msg, v...)
+}
+
+func (l *Logger) CriticalJs(msg string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfScreen, common.FormatToJSON, common.Critical, l.fields, msg, v...)
+}
+
+func (l *Logger) DebugfJs(msg string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Debug, l.fields, msg, v...)
+}
+
+func (l *Logger) InfofJs(msg string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Info, l.fields, msg, v...)
+}
+
+func (l *Logger) NoticefJs(msg string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Notice, l.fields, msg, v...)
+}
+
+func (l *Logger) WarnfJs(msg string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Warn, l.fields, msg, v...)
+}
+
+func (l *Logger) ErrorfJs(msg string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Error, l.fields, msg, v...)
+}
+
+func (l *Logger) CriticalfJs(msg string, v ...interface{}) {
+	loger.GetManager().Add(common.UnifyTypeOfFile, common.FormatToJSON, common.Critical, l.fields, msg, v...)
+}
+
+func (l *Logger) DebugKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfScreen, common.Debug, msg, l.merge(fields))
+}
+
+func (l *Logger) InfoKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfScreen, common.Info, msg, l.merge(fields))
+}
+
+func (l *Logger) NoticeKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfScreen, common.Notice, msg, l.merge(fields))
+}
+
+func (l *Logger) WarnKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfScreen, common.Warn, msg, l.merge(fields))
+}
+
+func (l *Logger) ErrorKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfScreen, common.Error, msg, l.merge(fields))
+}
+
+func (l *Logger) CriticalKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfScreen, common.Critical, msg, l.merge(fields))
+}
+
+func (l *Logger) DebugfKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfFile, common.Debug, msg, l.merge(fields))
+}
+
+func (l *Logger) InfofKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfFile, common.Info, msg, l.merge(fields))
+}
+
+func (l *Logger) NoticefKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfFile, common.Notice, msg, l.merge(fields))
+}
+
+func (l *Logger) WarnfKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfFile, common.Warn, msg, l.merge(fields))
+}
+
+func (l *Logger) ErrorfKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfFile, common.Error, msg, l.merge(fields))
+}
+
+func (l *Logger) CriticalfKv(msg string, fields ...Field) {
+	loger.GetManager().AddFields(common.UnifyTypeOfFile, common.Critical, msg, l.merge(fields))
+}
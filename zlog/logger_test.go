@@ -0,0 +1,81 @@
+package zlog_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ezgroot/ezUtils/zlog"
+	"github.com/ezgroot/ezUtils/zlog/common"
+	"github.com/ezgroot/ezUtils/zlog/encoder"
+	"github.com/ezgroot/ezUtils/zlog/sink"
+)
+
+func TestLoggerContext(t *testing.T) {
+	if l := zlog.FromContext(context.Background()); l == nil || len(l.Fields()) != 0 {
+		t.Fatalf("logger of empty context = %v", l)
+	}
+
+	parent := zlog.With(zlog.String("requestID", "r1"))
+	child := parent.With(zlog.Int("userID", 7))
+	sibling := parent.With(zlog.Int("userID", 8))
+
+	if len(parent.Fields()) != 1 {
+		t.Errorf("parent fields changed by child = %v", parent.Fields())
+	}
+
+	ctx := zlog.NewContext(context.Background(), child)
+	if got := zlog.FromContext(ctx); got != child {
+		t.Errorf("logger from context = %v, want %v", got, child)
+	}
+
+	if s := encoder.FormatWithFields("id %d", child.Fields()); s != "id %d requestID=r1 userID=7" {
+		t.Errorf("child format = %s", s)
+	}
+
+	if s := encoder.FormatWithFields("", sibling.Fields()); s != "requestID=r1 userID=8" {
+		t.Errorf("sibling format = %s", s)
+	}
+
+	if s := encoder.FormatWithFields("", []zlog.Field{zlog.String("p", "100%")}); s != "p=100%%" {
+		t.Errorf("format not escaped = %s", s)
+	}
+}
+
+func TestSink(t *testing.T) {
+	ring := sink.NewRing(16)
+	if err := zlog.AddSink("ring", ring, sink.Filter{Levels: common.Warn, Modules: []string{"zlog"}}); err != nil {
+		t.Fatalf("add sink error = %s", err)
+	}
+
+	if err := zlog.AddSink("ring", ring, sink.Filter{}); !errors.Is(err, sink.ErrorOfSinkExist) {
+		t.Errorf("add sink again error = %v", err)
+	}
+
+	logger := zlog.With(zlog.String("requestID", "r1"))
+	logger.InfoKv("skip")
+	logger.WarnKv("keep", zlog.Int("k", 1))
+	logger.Warn("keep %d", 2)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for len(ring.Logs()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	lines := ring.Lines(common.FormatToLogfmt)
+	if len(lines) != 2 || !strings.Contains(lines[0], "file=logger_test.go") ||
+		!strings.Contains(lines[0], "msg=keep requestID=r1 k=1") || !strings.Contains(lines[1], `msg="keep 2" requestID=r1`) {
+		t.Errorf("ring lines = %q", lines)
+	}
+
+	if err := zlog.RemoveSink("ring"); err != nil {
+		t.Errorf("remove sink error = %s", err)
+	}
+
+	if names := zlog.GetSinkNames(); fmt.Sprint(names) != "[screen file]" {
+		t.Errorf("sink names = %v", names)
+	}
+}
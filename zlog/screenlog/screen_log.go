@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/ezgroot/ezUtils/zlog/common"
+	"github.com/ezgroot/ezUtils/zlog/encoder"
 	"github.com/ezgroot/ezUtils/zlog/utils"
 )
 
@@ -97,53 +98,36 @@ func (s *LoggerImpl) showLogStr(log *common.OneLog) {
 		log.CallerLine,
 		log.CallerPkg,
 		log.CallerName+" ▶ ",
-		log.Format,
+		encoder.FormatWithFields(log.Format, log.Fields),
 		colourEnd)
 
 	fmt.Printf(formatLog, log.Args...)
 }
 
-func (s *LoggerImpl) showLogJSON(log *common.OneLog) {
-	colourBegin, colourEnd := getColour(log)
-	timeStr := utils.GetLogTimeStr(log)
-
-	str1 := "\n" + "    " + utils.GetJSONStr("level", common.LevelMap[log.Level]) + ",\n" +
-		"    " + utils.GetJSONStr("time", timeStr) + ",\n" +
-		"    " + utils.GetJSONStr("file", log.CallerFile) + ",\n" +
-		"    " + utils.GetJSONStr("line", log.CallerLine) + ",\n" +
-		"    " + utils.GetJSONStr("pkg", log.CallerPkg) + ",\n" +
-		"    " + utils.GetJSONStr("func", log.CallerName) + ",\n" +
-		"    " + utils.GetJSONStr("msg", log.Format) + ",\n"
-
-	var key string
-	var ok bool
-	for i, value := range log.Args {
-		if i%2 == 0 {
-			key, ok = value.(string)
-			if !ok {
-
-			}
-		} else {
-			if i == len(log.Args)-1 {
-				str1 += ("    " + utils.GetJSONStr(key, value) + "\n")
-			} else {
-				str1 += ("    " + utils.GetJSONStr(key, value) + ",\n")
-			}
-		}
-	}
-
-	str1 = "{" + str1 + "}"
-
-	fmt.Printf("%s%s%s", colourBegin, str1, colourEnd)
+// showLogEncoded output json or logfmt line without colour, so it can be parsed from stdout.
+func (s *LoggerImpl) showLogEncoded(log *common.OneLog) {
+	fmt.Printf("%s\n", encoder.Encode(log))
 }
 
 // Show output a screen log
 func (s *LoggerImpl) Show(log *common.OneLog) {
 	if log.FormatType == common.FormatToString {
 		s.showLogStr(log)
-	} else if log.FormatType == common.FormatToJSON {
-		s.showLogJSON(log)
+	} else if log.FormatType == common.FormatToJSON || log.FormatType == common.FormatToLogfmt {
+		s.showLogEncoded(log)
 	} else {
 		s.showLogStr(log)
 	}
 }
+
+// Write implement sink.Sink, used as the default screen sink.
+func (s *LoggerImpl) Write(log *common.OneLog) error {
+	s.Show(log)
+
+	return nil
+}
+
+// Close implement sink.Sink.
+func (s *LoggerImpl) Close() error {
+	return nil
+}
@@ -0,0 +1,66 @@
+package screenlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ezgroot/ezUtils/zlog/common"
+	"github.com/ezgroot/ezUtils/zlog/screenlog"
+)
+
+func captureStdout(t *testing.T, f func()) []byte {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe error = %s", err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	f()
+	w.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read stdout error = %s", err)
+	}
+
+	return out
+}
+
+func TestShowJSON(t *testing.T) {
+	log := &common.OneLog{
+		FormatType: common.FormatToJSON,
+		Level:      common.Warn,
+		CallerFile: "main.go",
+		CallerLine: 12,
+		CallerPkg:  "main",
+		CallerName: "main()",
+		Timestamp:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano(),
+		Format:     "hello",
+	}
+
+	out := captureStdout(t, func() {
+		screenlog.GetScreenLogImpl().Show(log)
+	})
+
+	if !bytes.HasSuffix(out, []byte("\n")) || bytes.Count(out, []byte("\n")) != 1 {
+		t.Fatalf("screen json not one line : %q", out)
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(out, &m); err != nil {
+		t.Fatalf("invalid screen json = %q error = %s", out, err)
+	}
+
+	if m["level"] != "warn" || m["msg"] != "hello" {
+		t.Errorf("screen json = %v", m)
+	}
+}
@@ -0,0 +1,254 @@
+package sink
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ezgroot/ezUtils/zlog/common"
+)
+
+const (
+	defaultDialTimeout      = time.Duration(3000) * time.Millisecond
+	defaultWriteTimeout     = time.Duration(1000) * time.Millisecond
+	defaultRedialBackoff    = time.Duration(100) * time.Millisecond
+	defaultMaxRedialBackoff = time.Duration(30000) * time.Millisecond
+
+	defaultSyslogFacility = 1 // user-level messages
+	syslogVersion         = 1
+	syslogNil             = "-"
+)
+
+// syslogSeverity severity of log level, RFC 5424 6.2.1.
+var syslogSeverity = map[int]int{
+	common.Debug:    7,
+	common.Info:     6,
+	common.Notice:   5,
+	common.Warn:     4,
+	common.Error:    3,
+	common.Critical: 2,
+}
+
+// netConn connection dialed lazily, dropped when write error. It is dialed again at next write
+// after backoff, logs written before that are dropped, so the log manager is not blocked by dialing.
+type netConn struct {
+	mutex    sync.Mutex
+	network  string
+	addr     string
+	conn     net.Conn
+	closed   bool
+	failNum  int       // dial or write failed times in a row
+	redialAt time.Time // drop logs until redial
+}
+
+func (c *netConn) write(b []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return ErrorOfSinkClosed
+	}
+
+	if c.conn == nil {
+		if time.Now().Before(c.redialAt) {
+			return ErrorOfSinkDisconnected
+		}
+
+		conn, err := net.DialTimeout(c.network, c.addr, defaultDialTimeout)
+		if err != nil {
+			c.fail()
+			return err
+		}
+
+		c.conn = conn
+	}
+
+	err := c.conn.SetWriteDeadline(time.Now().Add(defaultWriteTimeout))
+	if err == nil {
+		_, err = c.conn.Write(b)
+	}
+
+	if err != nil {
+		c.conn.Close()
+		c.conn = nil
+		c.fail()
+		return err
+	}
+
+	c.failNum = 0
+
+	return nil
+}
+
+// fail back off redial, the backoff doubles every failure until max.
+func (c *netConn) fail() {
+	backoff := defaultMaxRedialBackoff
+	if c.failNum < 16 {
+		backoff = defaultRedialBackoff << uint(c.failNum)
+		if backoff > defaultMaxRedialBackoff {
+			backoff = defaultMaxRedialBackoff
+		}
+	}
+
+	c.failNum++
+	c.redialAt = time.Now().Add(backoff)
+}
+
+func (c *netConn) close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+
+	return err
+}
+
+// SyslogConfig config of syslog sink.
+type SyslogConfig struct {
+	Network  string // "udp" or "tcp", default "udp"
+	Addr     string // address of syslog server, like 127.0.0.1:514
+	AppName  string // default name of process
+	Hostname string // default hostname of os
+	Facility int    // syslog facility, default 1 means user-level messages
+	Format   int    // format of MSG, FormatOfLog or common.FormatTo*, default string
+}
+
+// Syslog sink send logs to syslog server in RFC 5424, tcp messages are framed by octet counting
+// of RFC 6587.
+type Syslog struct {
+	conn     *netConn
+	isStream bool
+	facility int
+	tail     string // HOSTNAME APP-NAME PROCID
+	format   int
+}
+
+// NewSyslog create a syslog sink, the connection is dialed when first log written.
+func NewSyslog(c SyslogConfig) (*Syslog, error) {
+	if c.Network == "" {
+		c.Network = "udp"
+	}
+
+	if c.Network != "udp" && c.Network != "tcp" {
+		return nil, fmt.Errorf("syslog network = %s not support", c.Network)
+	}
+
+	if c.Addr == "" {
+		return nil, fmt.Errorf("syslog address is empty")
+	}
+
+	if c.Facility <= 0 || c.Facility > 23 {
+		c.Facility = defaultSyslogFacility
+	}
+
+	if c.AppName == "" {
+		c.AppName = filepath.Base(os.Args[0])
+	}
+
+	if c.Hostname == "" {
+		c.Hostname, _ = os.Hostname()
+	}
+
+	tail := syslogField(c.Hostname, 255) + " " + syslogField(c.AppName, 48) + " " + strconv.Itoa(os.Getpid())
+
+	return &Syslog{
+		conn:     &netConn{network: c.Network, addr: c.Addr},
+		isStream: c.Network == "tcp",
+		facility: c.Facility,
+		tail:     tail,
+		format:   c.Format,
+	}, nil
+}
+
+// syslogField replace chars not allowed in header field, max length of field is n.
+func syslogField(s string, n int) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < n; i++ {
+		if s[i] > ' ' && s[i] < 0x7f {
+			b = append(b, s[i])
+		}
+	}
+
+	if len(b) == 0 {
+		return syslogNil
+	}
+
+	return string(b)
+}
+
+// Message get RFC 5424 message of log, without framing.
+func (s *Syslog) Message(log *common.OneLog) []byte {
+	severity, ok := syslogSeverity[log.Level]
+	if !ok {
+		severity = syslogSeverity[common.Info]
+	}
+
+	msg := make([]byte, 0, 256)
+	msg = append(msg, '<')
+	msg = strconv.AppendInt(msg, int64(s.facility*8+severity), 10)
+	msg = append(msg, '>')
+	msg = strconv.AppendInt(msg, syslogVersion, 10)
+	msg = append(msg, ' ')
+	msg = time.Unix(0, log.Timestamp).UTC().AppendFormat(msg, "2006-01-02T15:04:05.000000Z07:00")
+	msg = append(msg, ' ')
+	msg = append(msg, s.tail...)
+	msg = append(msg, " "+syslogNil+" "+syslogNil+" "...) // MSGID STRUCTURED-DATA
+
+	line := encode(log, s.format)
+
+	return append(msg, line[:len(line)-1]...)
+}
+
+// Write implement Sink.
+func (s *Syslog) Write(log *common.OneLog) error {
+	msg := s.Message(log)
+
+	if s.isStream {
+		msg = append(append([]byte(strconv.Itoa(len(msg))), ' '), msg...)
+	}
+
+	return s.conn.write(msg)
+}
+
+// Close implement Sink.
+func (s *Syslog) Close() error {
+	return s.conn.close()
+}
+
+// Unixgram sink send a datagram of each log to unix socket.
+type Unixgram struct {
+	conn   *netConn
+	format int
+}
+
+// NewUnixgram create a unix datagram sink, format is FormatOfLog or common.FormatTo*. The socket
+// is dialed when first log written.
+func NewUnixgram(path string, format int) (*Unixgram, error) {
+	if path == "" {
+		return nil, fmt.Errorf("unix socket path is empty")
+	}
+
+	return &Unixgram{conn: &netConn{network: "unixgram", addr: path}, format: format}, nil
+}
+
+// Write implement Sink.
+func (s *Unixgram) Write(log *common.OneLog) error {
+	line := encode(log, s.format)
+
+	return s.conn.write(line[:len(line)-1])
+}
+
+// Close implement Sink.
+func (s *Unixgram) Close() error {
+	return s.conn.close()
+}
@@ -0,0 +1,86 @@
+package sink
+
+import (
+	"sync"
+
+	"github.com/ezgroot/ezUtils/zlog/common"
+)
+
+const (
+	defaultRingSize = 1024
+)
+
+// Ring sink keep the last logs in memory, such as for a debug endpoint or tests.
+type Ring struct {
+	mutex sync.Mutex
+	logs  []common.OneLog
+	next  int
+	full  bool
+}
+
+// NewRing create a ring sink keep size logs, default 1024.
+func NewRing(size int) *Ring {
+	if size <= 0 {
+		size = defaultRingSize
+	}
+
+	return &Ring{logs: make([]common.OneLog, size)}
+}
+
+// Write implement Sink.
+func (s *Ring) Write(log *common.OneLog) error {
+	l := *log
+	l.Args = append([]interface{}(nil), log.Args...)
+	l.Fields = append([]common.Field(nil), log.Fields...)
+
+	s.mutex.Lock()
+	s.logs[s.next] = l
+	s.next = (s.next + 1) % len(s.logs)
+	if s.next == 0 {
+		s.full = true
+	}
+	s.mutex.Unlock()
+
+	return nil
+}
+
+// Close implement Sink, logs are kept.
+func (s *Ring) Close() error {
+	return nil
+}
+
+// Logs get logs kept, oldest first.
+func (s *Ring) Logs() []common.OneLog {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.full {
+		return append([]common.OneLog(nil), s.logs[:s.next]...)
+	}
+
+	return append(append([]common.OneLog(nil), s.logs[s.next:]...), s.logs[:s.next]...)
+}
+
+// Lines get logs kept encoded by format, oldest first.
+func (s *Ring) Lines(format int) []string {
+	logs := s.Logs()
+
+	lines := make([]string, 0, len(logs))
+	for i := range logs {
+		line := encode(&logs[i], format)
+		lines = append(lines, string(line[:len(line)-1]))
+	}
+
+	return lines
+}
+
+// Reset drop logs kept.
+func (s *Ring) Reset() {
+	s.mutex.Lock()
+	for i := range s.logs {
+		s.logs[i] = common.OneLog{}
+	}
+	s.next = 0
+	s.full = false
+	s.mutex.Unlock()
+}
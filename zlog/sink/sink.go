@@ -0,0 +1,91 @@
+// Package sink destinations of zlog, register by zlog.AddSink.
+package sink
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ezgroot/ezUtils/zlog/common"
+	"github.com/ezgroot/ezUtils/zlog/encoder"
+)
+
+// name of default sinks
+const (
+	NameOfScreen = "screen"
+	NameOfFile   = "file"
+)
+
+// FormatOfLog encode log by its own format, string or key value.
+const FormatOfLog = -1
+
+var (
+	// ErrorOfSinkExist sink name already registered.
+	ErrorOfSinkExist = errors.New("sink already exist")
+	// ErrorOfSinkNotExist sink name not registered.
+	ErrorOfSinkNotExist = errors.New("sink not exist")
+	// ErrorOfSinkClosed sink has been closed.
+	ErrorOfSinkClosed = errors.New("sink closed")
+	// ErrorOfSinkDisconnected network sink wait to redial, the log is dropped.
+	ErrorOfSinkDisconnected = errors.New("sink disconnected, log dropped")
+)
+
+// Sink destination of logs. Write is called by the only goroutine of log manager, the log
+// must not be modified or kept after Write return, copy it if needed.
+type Sink interface {
+	Write(log *common.OneLog) error
+	Close() error
+}
+
+// Syncer sink which buffer logs, Sync write logs buffered and flush them to storage.
+type Syncer interface {
+	Sync(ctx context.Context) error
+}
+
+// Filter decide which logs are written to a sink.
+type Filter struct {
+	Levels  int      // effect log level, 0 means all
+	Modules []string // effect modules, matched if package of caller contain it, empty means all
+	OutTo   int      // effect logs to screen or file, 0 means all
+}
+
+// Match is log pass filter.
+func (f Filter) Match(log *common.OneLog) bool {
+	if f.Levels != 0 && f.Levels&log.Level == 0 {
+		return false
+	}
+
+	if f.OutTo != common.UnifyTypeOfOff && f.OutTo != log.OutTo {
+		return false
+	}
+
+	return MatchModules(f.Modules, log.CallerPkg)
+}
+
+// MatchModules is module matched by modules, like Config.Modules, support "all" and "none".
+func MatchModules(modules []string, module string) bool {
+	if len(modules) == 0 {
+		return true
+	}
+
+	for _, value := range modules {
+		if value == common.ModulesAll {
+			return true
+		} else if value == common.ModulesNone {
+			return false
+		} else if strings.Contains(module, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encode log by format, line feed appended.
+func encode(log *common.OneLog, format int) []byte {
+	if format == FormatOfLog {
+		format = log.FormatType
+	}
+
+	return append(encoder.EncodeAs(log, format), '\n')
+}
@@ -0,0 +1,241 @@
+package sink_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ezgroot/ezUtils/zlog/common"
+	"github.com/ezgroot/ezUtils/zlog/sink"
+)
+
+func newLog(level int, msg string) *common.OneLog {
+	return &common.OneLog{
+		OutTo:      common.UnifyTypeOfScreen,
+		FormatType: common.FormatToJSON,
+		Level:      level,
+		CallerFile: "main.go",
+		CallerLine: 1,
+		CallerPkg:  "github.com/ezgroot/ezUtils/dispatcher",
+		CallerName: "run()",
+		Timestamp:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano(),
+		Format:     msg,
+		Fields:     []common.Field{{Key: "k", Type: common.FieldTypeInt, Integer: 1}},
+	}
+}
+
+func TestFilter(t *testing.T) {
+	log := newLog(common.Warn, "hi")
+
+	cases := []struct {
+		filter sink.Filter
+		want   bool
+	}{
+		{sink.Filter{}, true},
+		{sink.Filter{Levels: common.Warn | common.Error}, true},
+		{sink.Filter{Levels: common.Debug}, false},
+		{sink.Filter{OutTo: common.UnifyTypeOfFile}, false},
+		{sink.Filter{Modules: []string{"dispatcher"}}, true},
+		{sink.Filter{Modules: []string{"zlog"}}, false},
+		{sink.Filter{Modules: []string{common.ModulesNone}}, false},
+		{sink.Filter{Modules: []string{"zlog", common.ModulesAll}}, true},
+	}
+
+	for i, c := range cases {
+		if got := c.filter.Match(log); got != c.want {
+			t.Errorf("case %d filter = %+v match = %v, want %v", i, c.filter, got, c.want)
+		}
+	}
+}
+
+func TestWriterAndRing(t *testing.T) {
+	var buf bytes.Buffer
+	w := sink.NewWriter(&buf, common.FormatToLogfmt)
+	ring := sink.NewRing(2)
+
+	for i := 0; i < 3; i++ {
+		log := newLog(common.Info, "m"+strconv.Itoa(i))
+		if err := w.Write(log); err != nil {
+			t.Fatalf("write error = %s", err)
+		}
+
+		ring.Write(log)
+		log.Fields[0].Integer = 100 // ring keep copy
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[2], "msg=m2 k=1") {
+		t.Errorf("writer lines = %q", lines)
+	}
+
+	got := ring.Lines(common.FormatToLogfmt)
+	if len(got) != 2 || !strings.Contains(got[0], "msg=m1 k=1") || !strings.Contains(got[1], "msg=m2 k=1") {
+		t.Errorf("ring lines = %q", got)
+	}
+
+	w.Close()
+	if err := w.Write(newLog(common.Info, "x")); err == nil {
+		t.Errorf("write closed sink without error")
+	}
+}
+
+var syslogRe = regexp.MustCompile(`^<12>1 2020-01-01T00:00:00\.000000Z host app \d+ - - \{.*"msg":"hi".*\}$`)
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen udp error = %s", err)
+	}
+	defer pc.Close()
+
+	s, err := sink.NewSyslog(sink.SyslogConfig{Addr: pc.LocalAddr().String(), AppName: "app", Hostname: "host",
+		Format: sink.FormatOfLog})
+	if err != nil {
+		t.Fatalf("create syslog error = %s", err)
+	}
+	defer s.Close()
+
+	if err = s.Write(newLog(common.Warn, "hi")); err != nil {
+		t.Fatalf("write error = %s", err)
+	}
+
+	buf := make([]byte, 4096)
+	pc.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read error = %s", err)
+	}
+
+	if !syslogRe.Match(buf[:n]) {
+		t.Errorf("syslog message = %s", buf[:n])
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen tcp error = %s", err)
+	}
+	defer ln.Close()
+
+	s, err := sink.NewSyslog(sink.SyslogConfig{Network: "tcp", Addr: ln.Addr().String(), AppName: "app",
+		Hostname: "host", Format: sink.FormatOfLog})
+	if err != nil {
+		t.Fatalf("create syslog error = %s", err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 2; i++ {
+		if err = s.Write(newLog(common.Warn, "hi")); err != nil {
+			t.Fatalf("write error = %s", err)
+		}
+	}
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept error = %s", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	r := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		length, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatalf("read length error = %s", err)
+		}
+
+		n, _ := strconv.Atoi(strings.TrimSpace(length))
+		msg := make([]byte, n)
+		if _, err = io.ReadFull(r, msg); err != nil {
+			t.Fatalf("read message error = %s", err)
+		}
+
+		if !syslogRe.Match(msg) {
+			t.Errorf("syslog message = %s", msg)
+		}
+	}
+}
+
+func TestUnixgram(t *testing.T) {
+	dir, err := os.MkdirTemp("", "zlog")
+	if err != nil {
+		t.Fatalf("create temp dir error = %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log.sock")
+	pc, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skipf("listen unixgram error = %s", err)
+	}
+	defer pc.Close()
+
+	s, err := sink.NewUnixgram(path, common.FormatToJSON)
+	if err != nil {
+		t.Fatalf("create unixgram error = %s", err)
+	}
+	defer s.Close()
+
+	if err = s.Write(newLog(common.Info, "hi")); err != nil {
+		t.Fatalf("write error = %s", err)
+	}
+
+	buf := make([]byte, 4096)
+	pc.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read error = %s", err)
+	}
+
+	if !bytes.HasPrefix(buf[:n], []byte(`{"level":"info"`)) || !bytes.HasSuffix(buf[:n], []byte(`"k":1}`)) {
+		t.Errorf("datagram = %s", buf[:n])
+	}
+}
+
+func TestUnixgramRedial(t *testing.T) {
+	dir, err := os.MkdirTemp("", "zlog")
+	if err != nil {
+		t.Fatalf("create temp dir error = %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log.sock")
+	s, err := sink.NewUnixgram(path, common.FormatToJSON)
+	if err != nil {
+		t.Fatalf("create unixgram error = %s", err)
+	}
+	defer s.Close()
+
+	if err = s.Write(newLog(common.Info, "hi")); err == nil || err == sink.ErrorOfSinkDisconnected {
+		t.Fatalf("write without server error = %v", err)
+	}
+
+	// logs are dropped without dialing until backoff passed
+	if err = s.Write(newLog(common.Info, "hi")); err != sink.ErrorOfSinkDisconnected {
+		t.Fatalf("write in backoff error = %v", err)
+	}
+
+	pc, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skipf("listen unixgram error = %s", err)
+	}
+	defer pc.Close()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for s.Write(newLog(common.Info, "hi")) != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("not redial after backoff")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
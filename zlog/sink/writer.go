@@ -0,0 +1,58 @@
+package sink
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/ezgroot/ezUtils/zlog/common"
+)
+
+// Writer sink write logs line by line to an io.Writer.
+type Writer struct {
+	mutex  sync.Mutex
+	w      io.Writer
+	format int
+	closed bool
+}
+
+// NewWriter create a writer sink, format is FormatOfLog or common.FormatTo*. The writer is not
+// closed with sink.
+func NewWriter(w io.Writer, format int) *Writer {
+	return &Writer{w: w, format: format}
+}
+
+// Write implement Sink.
+func (s *Writer) Write(log *common.OneLog) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return ErrorOfSinkClosed
+	}
+
+	_, err := s.w.Write(encode(log, s.format))
+
+	return err
+}
+
+// Sync implement Syncer, sync the writer if it is a file.
+func (s *Writer) Sync(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if syncer, ok := s.w.(interface{ Sync() error }); ok && !s.closed {
+		return syncer.Sync()
+	}
+
+	return nil
+}
+
+// Close implement Sink.
+func (s *Writer) Close() error {
+	s.mutex.Lock()
+	s.closed = true
+	s.mutex.Unlock()
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package zlog_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ezgroot/ezUtils/zlog"
+	"github.com/ezgroot/ezUtils/zlog/common"
+)
+
+func TestSyncAndClose(t *testing.T) {
+	dir := t.TempDir()
+	zlog.Init(common.Config{LogFilePath: dir, LogFilePrefix: "sync"})
+
+	// default config and sinks
+	t.Cleanup(func() {
+		zlog.Init(common.Config{})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const num = 1000
+	for i := 0; i < num; i++ {
+		zlog.Infof("line %d", i)
+	}
+
+	if err := zlog.Sync(ctx); err != nil {
+		t.Fatalf("sync error = %s", err)
+	}
+
+	if lines := countLines(t, dir); lines != num {
+		t.Errorf("lines after sync = %d, want %d", lines, num)
+	}
+
+	zlog.InfofKv("last")
+	if err := zlog.Close(ctx); err != nil {
+		t.Fatalf("close error = %s", err)
+	}
+
+	zlog.Infof("dropped")
+	if err := zlog.Sync(ctx); err != nil {
+		t.Fatalf("sync after close error = %s", err)
+	}
+
+	if lines := countLines(t, dir); lines != num+1 {
+		t.Errorf("lines after close = %d, want %d", lines, num+1)
+	}
+}
+
+func countLines(t *testing.T, dir string) int {
+	paths, err := filepath.Glob(filepath.Join(dir, "sync=*.log"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("log files = %v error = %v", paths, err)
+	}
+
+	data, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatalf("read log file error = %s", err)
+	}
+
+	return bytes.Count(data, []byte("\n"))
+}